@@ -1,60 +1,559 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/jonboulle/clockwork"
 	"github.com/scmmishra/slick-deploy/internal/caddy"
+	"github.com/scmmishra/slick-deploy/internal/compose"
 	"github.com/scmmishra/slick-deploy/internal/config"
 	"github.com/scmmishra/slick-deploy/internal/deploy"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/notify"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/scmmishra/slick-deploy/internal/watch"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 type Deployer interface {
-	Deploy(cfg config.DeploymentConfig) error
+	Deploy(ctx context.Context, cfg config.DeploymentConfig, opts deploy.Options) error
 }
 
 type DefaultDeployer struct{}
 
-func (DefaultDeployer) Deploy(cfg config.DeploymentConfig) error {
-	return deploy.Deploy(cfg)
+// Deploy deploys to the host of opts, or to every server of the config when
+// no host is given.
+func (DefaultDeployer) Deploy(ctx context.Context, cfg config.DeploymentConfig, opts deploy.Options) error {
+	if opts.Host == nil && len(cfg.Servers) > 0 {
+		return deployFleet(ctx, cfg, opts)
+	}
+	return deployHost(ctx, cfg, opts)
+}
+
+func deployHost(ctx context.Context, cfg config.DeploymentConfig, opts deploy.Options) error {
+	bus := deploy.NewEventBus()
+	bus.Subscribe(deploy.LogHandler(slog.Default()))
+	// Notifications go out in the background, the deploy only waits for
+	// them once it is done.
+	notifier := notify.NewNotifier(cfg.Notifications)
+	defer notifier.Close()
+	bus.Subscribe(notifier.Handle)
+	return deploy.Deploy(ctx, cfg, bus, opts)
+}
+
+// deployFleet rolls the deploy out to the servers of the config and prints
+// a summary.
+func deployFleet(ctx context.Context, cfg config.DeploymentConfig, opts deploy.Options) error {
+	hosts := make([]*remote.Host, 0, len(cfg.Servers))
+	for _, server := range cfg.Servers {
+		host, err := remote.ParseHost(server)
+		if err != nil {
+			return err
+		}
+		hosts = append(hosts, host)
+	}
+
+	store := stateStoreCreator()
+	fleet := &deploy.Fleet{
+		Hosts:  hosts,
+		Deploy: deployHost,
+		PreviousImage: func(host *remote.Host) string {
+			last, err := store.LastSuccessfulOn(cfg.App.Name, host.String())
+			if err != nil || last == nil {
+				return ""
+			}
+			return last.Image
+		},
+	}
+
+	slog.Info(fmt.Sprintf("Deploying to %d servers", len(hosts)), "parallelism", cfg.Fleet.Parallelism, "on_failure", cfg.Fleet.OnFailure)
+	results, err := fleet.Run(ctx, cfg, opts)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tSTATUS\tDURATION\tERROR")
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Host, result.Status, result.Duration.Round(time.Second), result.Error)
+	}
+	if flushErr := w.Flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+
+	return err
 }
 
 var defaultDeployer Deployer = DefaultDeployer{}
 
+// commandContext returns a context for cmd that is cancelled on Ctrl-C or
+// SIGTERM.
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+}
+
 func runDeploy(cmd *cobra.Command, deployer Deployer, configLoader ConfigLoader) error {
 	cfg, err := configLoader(cmd)
 	if err != nil {
 		return err
 	}
-	return deployer.Deploy(cfg)
+
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		return showDiff(cmd, cfg)
+	}
+
+	if cmd.Flags().Changed("parallel") {
+		cfg.Fleet.Parallelism, _ = cmd.Flags().GetInt("parallel")
+		if cfg.Fleet.Parallelism < 1 {
+			return fmt.Errorf("invalid --parallel %d, expected at least 1", cfg.Fleet.Parallelism)
+		}
+	}
+	if cmd.Flags().Changed("on-failure") {
+		cfg.Fleet.OnFailure, _ = cmd.Flags().GetString("on-failure")
+		switch cfg.Fleet.OnFailure {
+		case config.FleetRollback, config.FleetAbort, config.FleetContinue:
+		default:
+			return fmt.Errorf("invalid --on-failure %q, expected rollback, abort or continue", cfg.Fleet.OnFailure)
+		}
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	hosts, err := statusHosts(cfg)
+	if err != nil {
+		return err
+	}
+	lock, err := lockDeploy(ctx, cmd, cfg.App.Name, hosts)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return deployer.Deploy(ctx, cfg, deployOptions(cmd))
 }
 
-func runStatus() error {
-	dockerService, err := dockerServiceCreator()
+// deployOptions reads the deploy metadata from the --git-sha and --deployer
+// flags, falling back to the environment so CI can set them once.
+func deployOptions(cmd *cobra.Command) deploy.Options {
+	flagOrEnv := func(flag string, envs ...string) string {
+		if value, _ := cmd.Flags().GetString(flag); value != "" {
+			return value
+		}
+		for _, env := range envs {
+			if value := os.Getenv(env); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	opts := deploy.Options{
+		GitSHA:   flagOrEnv("git-sha", "SLICK_GIT_SHA", "GITHUB_SHA", "CI_COMMIT_SHA"),
+		Deployer: flagOrEnv("deployer", "SLICK_DEPLOYER"),
+		Host:     targetHost,
+	}
+	if opts.Deployer == "" {
+		opts.Deployer = state.CurrentUser()
+	}
+
+	return opts
+}
+
+// lockPollInterval is how often --wait retries a held deploy lock.
+var lockPollInterval = time.Second
+
+// deployLocks are the deploy locks of an app on the servers of a command.
+type deployLocks []*state.Lock
+
+// Unlock releases the locks.
+func (l deployLocks) Unlock() {
+	for i := len(l) - 1; i >= 0; i-- {
+		_ = l[i].Unlock()
+	}
+}
+
+// lockDeploy takes the deploy lock of app on every host, in order, honoring
+// the --force-unlock and --wait flags.
+func lockDeploy(ctx context.Context, cmd *cobra.Command, app string, hosts []*remote.Host) (deployLocks, error) {
+	locks := make(deployLocks, 0, len(hosts))
+	for _, host := range hosts {
+		lock, err := lockDeployOn(ctx, cmd, app, host.Name())
+		if err != nil {
+			locks.Unlock()
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+func lockDeployOn(ctx context.Context, cmd *cobra.Command, app, server string) (*state.Lock, error) {
+	store := stateStoreCreator()
+
+	forceUnlock, _ := cmd.Flags().GetBool("force-unlock")
+	if forceUnlock {
+		if holder, _ := store.LockHolder(app, server); holder != nil {
+			slog.Warn("Removing deploy lock", "held_by", holder.String())
+		}
+		if err := store.ForceUnlock(app, server); err != nil {
+			return nil, err
+		}
+	}
+
+	wait, _ := cmd.Flags().GetBool("wait")
+	if !wait {
+		lock, err := store.Lock(app, server)
+		var locked *state.LockedError
+		if errors.As(err, &locked) {
+			return nil, fmt.Errorf("%w, use --wait to wait for it to finish", err)
+		}
+		return lock, err
+	}
+
+	lock, err := store.Lock(app, server)
+	var locked *state.LockedError
+	if errors.As(err, &locked) {
+		slog.Info("Waiting for the running deploy to finish", "held_by", locked.Info.String())
+		return store.LockWait(ctx, app, server, lockPollInterval)
+	}
+	return lock, err
+}
+
+func runHistory(cmd *cobra.Command, configLoader ConfigLoader) error {
+	output, err := outputFormat(cmd)
 	if err != nil {
 		return err
 	}
-	return dockerService.GetStatus()
+
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	history, err := stateStoreCreator().History(cfg.App.Name)
+	if err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		if history == nil {
+			history = []state.Deployment{}
+		}
+		return writeJSON(os.Stdout, history)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "DEPLOY ID\tSERVER\tIMAGE\tSTATUS\tSTARTED\tDURATION\tGIT SHA\tDEPLOYER\tERROR")
+	// Newest deployments first
+	for i := len(history) - 1; i >= 0; i-- {
+		d := history[i]
+		server := d.Host
+		if server == "" {
+			server = "local"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.ID,
+			server,
+			d.Image,
+			d.Status,
+			d.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			d.FinishedAt.Sub(d.StartedAt).Round(time.Second),
+			shortSHA(d.GitSHA),
+			d.Deployer,
+			d.Error)
+	}
+
+	return w.Flush()
+}
+
+// shortSHA abbreviates a git commit hash the way git does.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+var stateStoreCreator = func() *state.Store {
+	return state.NewStore(state.DefaultDir())
+}
+
+// selectAccessories returns the accessory named in args, or all accessories
+// of the config when no name is given.
+func selectAccessories(cfg config.DeploymentConfig, args []string) ([]config.Accessory, error) {
+	if len(args) == 0 {
+		return cfg.Accessories, nil
+	}
+
+	for _, accessory := range cfg.Accessories {
+		if accessory.Name == args[0] {
+			return []config.Accessory{accessory}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no accessory named %s in the config", args[0])
+}
+
+func runAccessoryStart(cmd *cobra.Command, args []string, configLoader ConfigLoader) error {
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	accessories, err := selectAccessories(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	dockerService, err := dockerServiceCreator(targetHost)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	for _, accessory := range accessories {
+		if _, err := dockerService.StartAccessory(ctx, cfg.App.Name, accessory); err != nil {
+			return err
+		}
+		slog.Info("Accessory is running", "accessory", accessory.Name)
+	}
+
+	return nil
+}
+
+func runAccessoryStop(cmd *cobra.Command, args []string, configLoader ConfigLoader) error {
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	accessories, err := selectAccessories(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	dockerService, err := dockerServiceCreator(targetHost)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	for _, accessory := range accessories {
+		if err := dockerService.StopAccessory(ctx, cfg.App.Name, accessory.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func runLogs(cmd *cobra.Command, configLoader ConfigLoader) error {
+func runAccessoryLogs(cmd *cobra.Command, args []string, configLoader ConfigLoader) error {
 	cfg, err := configLoader(cmd)
 	if err != nil {
 		return err
 	}
 
-	dockerService, err := dockerServiceCreator()
+	dockerService, err := dockerServiceCreator(targetHost)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	opts, grep, err := logOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	containerID, err := dockerService.FindAccessory(ctx, cfg.App.Name, args[0])
+	if err != nil {
+		return err
+	}
+
+	stdout, stderr := newLogWriter(os.Stdout, grep, ""), newLogWriter(os.Stderr, grep, stderrColor())
+	defer stdout.Flush()
+	defer stderr.Flush()
+	return dockerService.StreamLogs(ctx, containerID, opts, stdout, stderr)
+}
+
+func runInit(cmd *cobra.Command) error {
+	configPath, _ := cmd.Flags().GetString("config")
+	force, _ := cmd.Flags().GetBool("force")
+	if _, err := os.Stat(configPath); err == nil && !force {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", configPath)
+	}
+
+	composePath, _ := cmd.Flags().GetString("from-compose")
+	if composePath != "" {
+		return initFromCompose(cmd, configPath, composePath)
+	}
+
+	answers, err := askScaffold(cmd)
+	if err != nil {
+		return err
+	}
+
+	data, err := answers.render()
 	if err != nil {
 		return err
 	}
 
-	container := dockerService.FindContainer(cfg.App.ImageName)
-	if container == nil {
-		return fmt.Errorf("no container found")
+	if err := writeValidatedConfig(configPath, data); err != nil {
+		return err
 	}
+	slog.Info(fmt.Sprintf("Wrote %s, list the env variables of the app under app.env before deploying", configPath))
 
-	tail, _ := cmd.Flags().GetString("tail")
-	return dockerService.StreamLogs(container.ID, tail)
+	return nil
+}
+
+// askScaffold asks for the settings of a new config. With --probe the image
+// is pulled to suggest the container port.
+func askScaffold(cmd *cobra.Command) (scaffold, error) {
+	p := newPrompter(cmd.InOrStdin(), cmd.ErrOrStderr())
+	answers := scaffold{}
+
+	var err error
+	defaultName := ""
+	if wd, wdErr := os.Getwd(); wdErr == nil {
+		defaultName = filepath.Base(wd)
+	}
+	if answers.Name, err = p.require("App name", defaultName, notEmpty("app name")); err != nil {
+		return answers, err
+	}
+	if answers.Image, err = p.require("Image", "", notEmpty("image")); err != nil {
+		return answers, err
+	}
+
+	defaultPort := ""
+	if probe, _ := cmd.Flags().GetBool("probe"); probe {
+		defaultPort = suggestPort(cmd, answers.Image)
+	}
+	port, err := p.require("Container port", defaultPort, validPort)
+	if err != nil {
+		return answers, err
+	}
+	answers.Port, _ = strconv.Atoi(port)
+
+	defaultDomain, _ := cmd.Flags().GetString("domain")
+	if defaultDomain == "" {
+		defaultDomain = "localhost"
+	}
+	for _, domain := range strings.Split(p.ask("Domains, comma separated", defaultDomain), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			answers.Domains = append(answers.Domains, domain)
+		}
+	}
+	if len(answers.Domains) == 0 {
+		answers.Domains = []string{defaultDomain}
+	}
+
+	answers.HealthEndpoint = p.ask("Health check endpoint", "/")
+	if !strings.HasPrefix(answers.HealthEndpoint, "/") {
+		answers.HealthEndpoint = "/" + answers.HealthEndpoint
+	}
+
+	answers.OnDemandTLS = p.confirm("Issue certificates on demand", false)
+	if answers.OnDemandTLS {
+		if answers.AskURL, err = p.require("URL Caddy asks before issuing a certificate", "", notEmpty("ask URL")); err != nil {
+			return answers, err
+		}
+	}
+
+	return answers, nil
+}
+
+// suggestPort returns the first port exposed by image, or "" when the
+// image can't be probed.
+func suggestPort(cmd *cobra.Command, image string) string {
+	dockerService, err := dockerServiceCreator(targetHost)
+	if err != nil {
+		slog.Warn("Unable to probe the image", "error", err)
+		return ""
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	ports, err := dockerService.ImagePorts(ctx, image)
+	if err != nil {
+		slog.Warn("Unable to probe the image", "image", image, "error", err)
+		return ""
+	}
+	if len(ports) == 0 {
+		slog.Info("The image does not expose any port", "image", image)
+		return ""
+	}
+
+	return strconv.Itoa(ports[0])
+}
+
+func initFromCompose(cmd *cobra.Command, configPath, composePath string) error {
+	file, err := compose.Load(composePath)
+	if err != nil {
+		return err
+	}
+
+	serviceName, _ := cmd.Flags().GetString("service")
+	service, err := file.PickService(serviceName)
+	if err != nil {
+		return err
+	}
+
+	domain, _ := cmd.Flags().GetString("domain")
+	cfg, unmapped, err := file.Convert(service, domain)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg); err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+
+	if err := writeValidatedConfig(configPath, buf.Bytes()); err != nil {
+		return err
+	}
+
+	for _, item := range unmapped {
+		slog.Warn("Not mapped: " + item)
+	}
+	slog.Info(fmt.Sprintf("Wrote %s from compose service %s", configPath, service))
+
+	return nil
 }
 
 func runCaddyInspect(cmd *cobra.Command, configLoader ConfigLoader) error {
@@ -67,3 +566,97 @@ func runCaddyInspect(cmd *cobra.Command, configLoader ConfigLoader) error {
 	fmt.Println(caddyConfig)
 	return nil
 }
+
+type Watcher interface {
+	Run(ctx context.Context) error
+}
+
+type WatcherCreator func(cfg config.DeploymentConfig, emit func(watch.Event)) (Watcher, error)
+
+var watcherCreator WatcherCreator = func(cfg config.DeploymentConfig, emit func(watch.Event)) (Watcher, error) {
+	cli, err := dockerClientCreator(targetHost)()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+
+	watcher := &watch.Watcher{
+		Config:   cfg,
+		Docker:   docker.NewDockerService(cli),
+		Store:    stateStoreCreator(),
+		Clock:    clockwork.NewRealClock(),
+		Redeploy: lockedRedeploy,
+		Host:     targetHost.Name(),
+		Emit:     emit,
+	}
+	if targetHost != nil {
+		watcher.Docker.Remote = true
+		watcher.Transport = targetHost.Transport()
+	}
+
+	return watcher, nil
+}
+
+// lockedRedeploy redeploys from the watcher, skipping the redeploy while
+// another deploy of the app is in progress.
+func lockedRedeploy(ctx context.Context, cfg config.DeploymentConfig) error {
+	lock, err := stateStoreCreator().Lock(cfg.App.Name, targetHost.Name())
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return defaultDeployer.Deploy(ctx, cfg, deploy.Options{Deployer: "slick watch", Host: targetHost})
+}
+
+func runWatch(cmd *cobra.Command, configLoader ConfigLoader) error {
+	output, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	// --json predates --output json and is kept for existing scripts.
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		output = outputJSON
+	}
+
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Events are JSON lines on stdout for machines, log lines for humans.
+	encoder := json.NewEncoder(os.Stdout)
+	emit := func(e watch.Event) {
+		if output == outputJSON {
+			if err := encoder.Encode(e); err != nil {
+				slog.Warn("Unable to write watch event", "error", err)
+			}
+			return
+		}
+
+		level := slog.LevelInfo
+		if e.Type != watch.EventHealthy {
+			level = slog.LevelWarn
+		}
+
+		message := e.Message
+		if message == "" {
+			message = e.Type
+		}
+
+		slog.Log(context.Background(), level, message,
+			"event", e.Type,
+			"app", e.App,
+			"container_id", e.ContainerID,
+			"failures", e.Failures)
+	}
+
+	watcher, err := watcherCreator(cfg, emit)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	return watcher.Run(ctx)
+}
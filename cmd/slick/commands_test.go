@@ -2,15 +2,27 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/deploy"
 	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/scmmishra/slick-deploy/internal/watch"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 var mockLoadConfig func(*cobra.Command) (config.DeploymentConfig, error)
@@ -19,8 +31,8 @@ type MockDeployer struct {
 	mock.Mock
 }
 
-func (m *MockDeployer) Deploy(cfg config.DeploymentConfig) error {
-	args := m.Called(cfg)
+func (m *MockDeployer) Deploy(ctx context.Context, cfg config.DeploymentConfig, opts deploy.Options) error {
+	args := m.Called(ctx, cfg, opts)
 	return args.Error(0)
 }
 
@@ -28,24 +40,87 @@ type MockDockerService struct {
 	mock.Mock
 }
 
-func (m *MockDockerService) GetStatus() error {
-	args := m.Called()
-	return args.Error(0)
+func (m *MockDockerService) AppContainers(ctx context.Context, app string) ([]docker.AppContainer, error) {
+	args := m.Called(app)
+	containers, _ := args.Get(0).([]docker.AppContainer)
+	return containers, args.Error(1)
 }
 
-func (m *MockDockerService) FindContainer(imageName string) *docker.Container {
-	args := m.Called(imageName)
+func (m *MockDockerService) Processes(ctx context.Context, app, deployID string) ([]docker.Process, error) {
+	args := m.Called(app, deployID)
+	processes, _ := args.Get(0).([]docker.Process)
+	return processes, args.Error(1)
+}
+
+func (m *MockDockerService) FindContainer(ctx context.Context, app string) *docker.Container {
+	args := m.Called(app)
 	if args.Get(0) == nil {
 		return nil
 	}
 	return args.Get(0).(*docker.Container)
 }
 
-func (m *MockDockerService) StreamLogs(containerID, tail string) error {
-	args := m.Called(containerID, tail)
+func (m *MockDockerService) RunningSpec(ctx context.Context, containerID string) (docker.Spec, error) {
+	args := m.Called(containerID)
+	return args.Get(0).(docker.Spec), args.Error(1)
+}
+
+func (m *MockDockerService) DesiredSpec(ctx context.Context, appCfg config.App) (docker.Spec, error) {
+	args := m.Called(appCfg)
+	return args.Get(0).(docker.Spec), args.Error(1)
+}
+
+func (m *MockDockerService) StopContainer(ctx context.Context, containerID string) error {
+	args := m.Called(containerID)
+	return args.Error(0)
+}
+
+func (m *MockDockerService) Exec(ctx context.Context, containerID string, opts docker.ExecOptions) (int, error) {
+	args := m.Called(containerID, opts.Cmd, opts.TTY)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockDockerService) RunOneOff(ctx context.Context, imageName string, appCfg config.App, cmd []string, stdout, stderr io.Writer) (int, error) {
+	args := m.Called(imageName, cmd)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockDockerService) RetireContainer(ctx context.Context, containerID string) error {
+	args := m.Called(containerID)
+	return args.Error(0)
+}
+
+func (m *MockDockerService) StreamLogs(ctx context.Context, containerID string, opts docker.LogOptions, stdout, stderr io.Writer) error {
+	args := m.Called(containerID, opts, stdout, stderr)
+	return args.Error(0)
+}
+
+func (m *MockDockerService) StartAccessory(ctx context.Context, app string, accessory config.Accessory) (string, error) {
+	args := m.Called(app, accessory)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockDockerService) StopAccessory(ctx context.Context, app, name string) error {
+	args := m.Called(app, name)
 	return args.Error(0)
 }
 
+func (m *MockDockerService) ImagePorts(ctx context.Context, imageName string) ([]int, error) {
+	args := m.Called(imageName)
+	ports, _ := args.Get(0).([]int)
+	return ports, args.Error(1)
+}
+
+func (m *MockDockerService) Prune(ctx context.Context, app string, opts docker.PruneOptions) (docker.PruneReport, error) {
+	args := m.Called(app, opts)
+	return args.Get(0).(docker.PruneReport), args.Error(1)
+}
+
+func (m *MockDockerService) FindAccessory(ctx context.Context, app, name string) (string, error) {
+	args := m.Called(app, name)
+	return args.String(0), args.Error(1)
+}
+
 // Helper function to create a cobra command for testing
 func createTestCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -53,12 +128,78 @@ func createTestCommand() *cobra.Command {
 	}
 	cmd.Flags().String("config", "", "Path to the configuration file")
 	cmd.Flags().String("env", "", "Path to the env file")
+	cmd.Flags().Duration("timeout", 0, "")
+	cmd.Flags().Bool("wait", false, "")
+	cmd.Flags().Bool("force-unlock", false, "")
+	cmd.Flags().String("git-sha", "", "")
+	cmd.Flags().String("deployer", "", "")
+	cmd.Flags().String("from-compose", "", "")
+	cmd.Flags().String("service", "", "")
+	cmd.Flags().String("domain", "", "")
+	cmd.Flags().Bool("force", false, "")
+	cmd.Flags().Bool("probe", false, "")
+	cmd.Flags().Int("parallel", 1, "")
+	cmd.Flags().String("on-failure", "rollback", "")
+	cmd.Flags().Bool("dry-run", false, "")
+	cmd.Flags().Int("keep", 0, "")
+	cmd.Flags().String("since", "", "")
+	cmd.Flags().String("until", "", "")
+	cmd.Flags().Bool("timestamps", false, "")
+	cmd.Flags().Bool("no-follow", false, "")
+	cmd.Flags().String("grep", "", "")
+	cmd.Flags().Bool("no-tty", false, "")
 	return cmd
 }
 
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	old := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = old }()
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r)
+		done <- buf.String()
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+func useTempStateStore(t *testing.T) *state.Store {
+	store := state.NewStore(t.TempDir())
+	originalStateStoreCreator := stateStoreCreator
+	stateStoreCreator = func() *state.Store { return store }
+	t.Cleanup(func() { stateStoreCreator = originalStateStoreCreator })
+	return store
+}
+
+func useMockDeployer(t *testing.T, m *MockDeployer) {
+	originalDeployer := defaultDeployer
+	defaultDeployer = m
+	t.Cleanup(func() { defaultDeployer = originalDeployer })
+}
+
+func useMockDockerService(t *testing.T, m *MockDockerService) {
+	original := dockerServiceCreator
+	dockerServiceCreator = func(*remote.Host) (DockerService, error) {
+		return m, nil
+	}
+	t.Cleanup(func() { dockerServiceCreator = original })
+}
+
 func TestRunDeploy(t *testing.T) {
+	useTempStateStore(t)
 	mockDeployer := new(MockDeployer)
-	mockDeployer.On("Deploy", mock.Anything).Return(nil)
+	mockDeployer.On("Deploy", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
 		return config.DeploymentConfig{}, nil
@@ -85,192 +226,551 @@ func TestRunDeploy_ConfigLoaderError(t *testing.T) {
 	mockDeployer.AssertNotCalled(t, "Deploy")
 }
 
-func TestRunLogs(t *testing.T) {
-	mockDockerService := new(MockDockerService)
-	mockDockerService.On("FindContainer", mock.Anything).Return(&docker.Container{ID: "test-container"})
-	mockDockerService.On("StreamLogs", "test-container", "all").Return(nil)
-
+func TestRunCaddyInspect(t *testing.T) {
 	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
 		return config.DeploymentConfig{
-			App: config.App{ImageName: "test-image"},
+			Caddy: config.CaddyConfig{
+				Rules: []config.Rule{
+					{Match: "http://example.com"},
+				},
+			},
 		}, nil
 	}
 
-	originalDockerServiceCreator := dockerServiceCreator
-	dockerServiceCreator = func() (DockerService, error) {
-		return mockDockerService, nil
+	cmd := createTestCommand()
+	var err error
+	output := captureStdout(t, func() {
+		err = runCaddyInspect(cmd, mockConfigLoader)
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "http://")
+}
+
+func TestRunCaddyInspect_ConfigError(t *testing.T) {
+	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{}, errors.New("config load error")
 	}
-	defer func() { dockerServiceCreator = originalDockerServiceCreator }()
 
 	cmd := createTestCommand()
-	cmd.Flags().String("tail", "all", "")
-	err := runLogs(cmd, mockConfigLoader)
+	err := runCaddyInspect(cmd, mockConfigLoader)
 
-	assert.NoError(t, err)
-	mockDockerService.AssertExpectations(t)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "config load error")
 }
 
-func TestRunLogs_NoContainer(t *testing.T) {
+func TestRunDeploy_DryRun(t *testing.T) {
+	useTempStateStore(t)
+	adminAPI := diffCaddyServer(t, `{}`, `{}`)
+
 	mockDockerService := new(MockDockerService)
-	mockDockerService.On("FindContainer", mock.Anything).Return(nil)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{}, nil)
+	mockDockerService.On("DesiredSpec", mock.Anything).Return(docker.Spec{Image: "example/image:v2"}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	mockDeployer := new(MockDeployer)
+
+	cmd := createTestCommand()
+	assert.NoError(t, cmd.Flags().Set("dry-run", "true"))
+	var err error
+	output := captureStdout(t, func() {
+		err = runDeploy(cmd, mockDeployer, statusConfigLoader(adminAPI))
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "compared with not running")
+	assert.Regexp(t, `image\s+\(none\) -> example/image:v2`, output)
+	mockDeployer.AssertNotCalled(t, "Deploy", mock.Anything, mock.Anything, mock.Anything)
+	holder, err := stateStoreCreator().LockHolder("memos", "")
+	assert.NoError(t, err)
+	assert.Nil(t, holder)
+}
+
+type MockWatcher struct {
+	mock.Mock
+	emit func(watch.Event)
+}
+
+func (m *MockWatcher) Run(ctx context.Context) error {
+	args := m.Called(ctx)
+	if m.emit != nil {
+		m.emit(watch.Event{Time: time.Now(), Type: watch.EventHealthy, Message: "container recovered"})
+	}
+	return args.Error(0)
+}
+
+func TestRunWatch(t *testing.T) {
+	mockWatcher := new(MockWatcher)
+	mockWatcher.On("Run", mock.Anything).Return(nil)
+
+	originalWatcherCreator := watcherCreator
+	watcherCreator = func(cfg config.DeploymentConfig, emit func(watch.Event)) (Watcher, error) {
+		assert.Equal(t, "test-app", cfg.App.Name)
+		mockWatcher.emit = emit
+		return mockWatcher, nil
+	}
+	defer func() { watcherCreator = originalWatcherCreator }()
+
+	var logs bytes.Buffer
+	originalLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	defer slog.SetDefault(originalLogger)
 
 	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
-		return config.DeploymentConfig{
-			App: config.App{ImageName: "test-image"},
-		}, nil
+		return config.DeploymentConfig{App: config.App{Name: "test-app"}}, nil
+	}
+
+	cmd := createTestCommand()
+	err := runWatch(cmd, mockConfigLoader)
+
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), `"event":"healthy"`)
+	assert.Contains(t, logs.String(), `"msg":"container recovered"`)
+	mockWatcher.AssertExpectations(t)
+}
+
+func TestRunWatch_JSON(t *testing.T) {
+	mockWatcher := new(MockWatcher)
+	mockWatcher.On("Run", mock.Anything).Return(nil)
+
+	originalWatcherCreator := watcherCreator
+	watcherCreator = func(cfg config.DeploymentConfig, emit func(watch.Event)) (Watcher, error) {
+		mockWatcher.emit = emit
+		return mockWatcher, nil
+	}
+	defer func() { watcherCreator = originalWatcherCreator }()
+
+	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{App: config.App{Name: "test-app"}}, nil
 	}
 
-	originalDockerServiceCreator := dockerServiceCreator
-	dockerServiceCreator = func() (DockerService, error) {
-		return mockDockerService, nil
+	for _, flag := range []string{"output", "json"} {
+		cmd := createTestCommand()
+		if flag == "output" {
+			cmd.Flags().String("output", "json", "")
+		} else {
+			cmd.Flags().Bool("json", true, "")
+		}
+
+		var err error
+		output := captureStdout(t, func() {
+			err = runWatch(cmd, mockConfigLoader)
+		})
+
+		assert.NoError(t, err)
+		var event watch.Event
+		assert.NoError(t, json.Unmarshal([]byte(output), &event), flag)
+		assert.Equal(t, watch.EventHealthy, event.Type)
+		assert.Equal(t, "container recovered", event.Message)
+	}
+}
+
+func TestRunWatch_CreatorFails(t *testing.T) {
+	originalWatcherCreator := watcherCreator
+	watcherCreator = func(config.DeploymentConfig, func(watch.Event)) (Watcher, error) {
+		return nil, errors.New("failed to create Docker client")
+	}
+	defer func() { watcherCreator = originalWatcherCreator }()
+
+	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{}, nil
 	}
-	defer func() { dockerServiceCreator = originalDockerServiceCreator }()
 
 	cmd := createTestCommand()
-	cmd.Flags().String("tail", "all", "")
-	err := runLogs(cmd, mockConfigLoader)
+	err := runWatch(cmd, mockConfigLoader)
 
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "no container found")
-	mockDockerService.AssertExpectations(t)
+	assert.Contains(t, err.Error(), "failed to create Docker client")
 }
 
-func TestRunLogs_DockerServiceCreatorFails(t *testing.T) {
+func TestRunWatch_ConfigError(t *testing.T) {
 	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
-		return config.DeploymentConfig{
-			App: config.App{ImageName: "test-image"},
-		}, nil
+		return config.DeploymentConfig{}, errors.New("config load error")
 	}
 
-	originalDockerServiceCreator := dockerServiceCreator
-	dockerServiceCreator = func() (DockerService, error) {
-		return nil, errors.New("failed to create Docker service")
+	cmd := createTestCommand()
+	err := runWatch(cmd, mockConfigLoader)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "config load error")
+}
+
+func TestRunHistory(t *testing.T) {
+	store := useTempStateStore(t)
+
+	now := time.Now()
+	assert.NoError(t, store.Record(state.Deployment{ID: "first", App: "test-app", Image: "example/image:v1", Status: state.StatusSucceeded, StartedAt: now, FinishedAt: now}))
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "test-app", Image: "example/image:v2", Status: state.StatusFailed, Error: "unhealthy", StartedAt: now, FinishedAt: now}))
+
+	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{App: config.App{Name: "test-app"}}, nil
 	}
-	defer func() { dockerServiceCreator = originalDockerServiceCreator }()
 
+	for _, output := range []string{"text", "json"} {
+		cmd := createTestCommand()
+		cmd.Flags().String("output", output, "")
+		var err error
+		stdout := captureStdout(t, func() {
+			err = runHistory(cmd, mockConfigLoader)
+		})
+
+		assert.NoError(t, err)
+		assert.Contains(t, stdout, "example/image:v2")
+		if output == "text" {
+			assert.Less(t, strings.Index(stdout, "second"), strings.Index(stdout, "first"))
+		} else {
+			assert.Contains(t, stdout, `"error": "unhealthy"`)
+		}
+	}
+}
+
+func TestRunHistory_InvalidOutput(t *testing.T) {
 	cmd := createTestCommand()
-	cmd.Flags().String("tail", "all", "")
-	err := runLogs(cmd, mockConfigLoader)
+	cmd.Flags().String("output", "xml", "")
+
+	err := runHistory(cmd, func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{}, nil
+	})
 
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to create Docker service")
 }
 
-func TestRunLogs_ConfigLoaderFails(t *testing.T) {
+func TestRunDeploy_Timeout(t *testing.T) {
+	useTempStateStore(t)
+	mockDeployer := new(MockDeployer)
+	mockDeployer.On("Deploy", mock.MatchedBy(func(ctx context.Context) bool {
+		_, hasDeadline := ctx.Deadline()
+		return hasDeadline
+	}), mock.Anything, mock.Anything).Return(nil)
+
 	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
-		return config.DeploymentConfig{}, errors.New("config loading failed")
+		return config.DeploymentConfig{}, nil
 	}
 
-	mockDockerService := new(MockDockerService)
+	cmd := createTestCommand()
+	assert.NoError(t, cmd.Flags().Set("timeout", "5m"))
+	err := runDeploy(cmd, mockDeployer, mockConfigLoader)
 
-	originalDockerServiceCreator := dockerServiceCreator
-	dockerServiceCreator = func() (DockerService, error) {
-		return mockDockerService, nil
+	assert.NoError(t, err)
+	mockDeployer.AssertExpectations(t)
+}
+
+func TestRunDeploy_Locked(t *testing.T) {
+	store := useTempStateStore(t)
+	lock, err := store.Lock("test-app", "")
+	assert.NoError(t, err)
+	defer lock.Unlock()
+
+	mockDeployer := new(MockDeployer)
+	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{App: config.App{Name: "test-app"}}, nil
+	}
+
+	err = runDeploy(createTestCommand(), mockDeployer, mockConfigLoader)
+
+	var locked *state.LockedError
+	assert.ErrorAs(t, err, &locked)
+	mockDeployer.AssertNotCalled(t, "Deploy", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRunDeploy_Wait(t *testing.T) {
+	store := useTempStateStore(t)
+	lock, err := store.Lock("test-app", "")
+	assert.NoError(t, err)
+
+	originalInterval := lockPollInterval
+	lockPollInterval = 10 * time.Millisecond
+	defer func() { lockPollInterval = originalInterval }()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = lock.Unlock()
+	}()
+
+	mockDeployer := new(MockDeployer)
+	mockDeployer.On("Deploy", mock.Anything, mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+		// The lock is held while deploying
+		holder, _ := store.LockHolder("test-app", "")
+		assert.NotNil(t, holder)
+	}).Return(nil)
+	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{App: config.App{Name: "test-app"}}, nil
 	}
-	defer func() { dockerServiceCreator = originalDockerServiceCreator }()
 
 	cmd := createTestCommand()
-	cmd.Flags().String("tail", "all", "")
-	err := runLogs(cmd, mockConfigLoader)
+	assert.NoError(t, cmd.Flags().Set("wait", "true"))
+	err = runDeploy(cmd, mockDeployer, mockConfigLoader)
 
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "config loading failed")
+	assert.NoError(t, err)
+	mockDeployer.AssertExpectations(t)
 
-	// Ensure that no methods on mockDockerService were called
-	mockDockerService.AssertNotCalled(t, "FindContainer")
-	mockDockerService.AssertNotCalled(t, "StreamLogs")
+	holder, err := store.LockHolder("test-app", "")
+	assert.NoError(t, err)
+	assert.Nil(t, holder)
 }
 
-func TestRunCaddyInspect(t *testing.T) {
+func TestRunDeploy_LocksEveryServer(t *testing.T) {
+	store := useTempStateStore(t)
+	lock, err := store.Lock("test-app", "ssh://web2.example.com")
+	require.NoError(t, err)
+	defer lock.Unlock()
+
+	mockDeployer := new(MockDeployer)
 	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
 		return config.DeploymentConfig{
-			Caddy: config.CaddyConfig{
-				Rules: []config.Rule{
-					{Match: "http://example.com"},
-				},
-			},
+			App:     config.App{Name: "test-app"},
+			Servers: []string{"ssh://web1.example.com", "ssh://web2.example.com"},
 		}, nil
 	}
 
-	old := os.Stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
+	err = runDeploy(createTestCommand(), mockDeployer, mockConfigLoader)
 
-	cmd := createTestCommand()
-	err := runCaddyInspect(cmd, mockConfigLoader)
+	var locked *state.LockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, "ssh://web2.example.com", locked.Info.Server)
+	mockDeployer.AssertNotCalled(t, "Deploy", mock.Anything, mock.Anything, mock.Anything)
 
-	w.Close()
-	os.Stdout = old
+	// The lock taken on the first server is released again
+	holder, err := store.LockHolder("test-app", "ssh://web1.example.com")
+	require.NoError(t, err)
+	assert.Nil(t, holder)
 
-	var buf bytes.Buffer
-	_, _ = buf.ReadFrom(r)
-	output := buf.String()
+	// A deploy to another server does not wait for web2
+	mockDeployer.On("Deploy", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	originalHost := targetHost
+	targetHost = &remote.Host{Hostname: "web3.example.com"}
+	defer func() { targetHost = originalHost }()
+	assert.NoError(t, runDeploy(createTestCommand(), mockDeployer, mockConfigLoader))
+}
 
+func TestRunDeploy_ForceUnlock(t *testing.T) {
+	store := useTempStateStore(t)
+	lock, err := store.Lock("test-app", "")
 	assert.NoError(t, err)
-	assert.Contains(t, output, "http://")
-}
+	defer lock.Unlock()
 
-func TestRunCaddyInspect_ConfigError(t *testing.T) {
+	mockDeployer := new(MockDeployer)
+	mockDeployer.On("Deploy", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
-		return config.DeploymentConfig{}, errors.New("config load error")
+		return config.DeploymentConfig{App: config.App{Name: "test-app"}}, nil
 	}
 
 	cmd := createTestCommand()
-	err := runCaddyInspect(cmd, mockConfigLoader)
+	assert.NoError(t, cmd.Flags().Set("force-unlock", "true"))
+	err = runDeploy(cmd, mockDeployer, mockConfigLoader)
 
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "config load error")
+	assert.NoError(t, err)
+	mockDeployer.AssertExpectations(t)
+}
+
+func TestDeployOptions(t *testing.T) {
+	t.Setenv("SLICK_GIT_SHA", "")
+	t.Setenv("GITHUB_SHA", "abc123")
+	t.Setenv("CI_COMMIT_SHA", "")
+	t.Setenv("SLICK_DEPLOYER", "ci")
+
+	cmd := createTestCommand()
+	opts := deployOptions(cmd)
+	assert.Equal(t, deploy.Options{GitSHA: "abc123", Deployer: "ci"}, opts)
+
+	// Flags win over the environment
+	assert.NoError(t, cmd.Flags().Set("git-sha", "def456"))
+	assert.NoError(t, cmd.Flags().Set("deployer", "alice"))
+	opts = deployOptions(cmd)
+	assert.Equal(t, deploy.Options{GitSHA: "def456", Deployer: "alice"}, opts)
+}
+
+func accessoryConfigLoader(*cobra.Command) (config.DeploymentConfig, error) {
+	return config.DeploymentConfig{
+		App: config.App{Name: "memos"},
+		Accessories: []config.Accessory{
+			{Name: "db", Image: "postgres:16"},
+			{Name: "redis", Image: "redis:7"},
+		},
+	}, nil
 }
 
-func TestRunStatus(t *testing.T) {
+func TestRunAccessoryStart_All(t *testing.T) {
 	mockDockerService := new(MockDockerService)
-	mockDockerService.On("GetStatus").Return(nil)
+	mockDockerService.On("StartAccessory", "memos", config.Accessory{Name: "db", Image: "postgres:16"}).Return("db-id", nil)
+	mockDockerService.On("StartAccessory", "memos", config.Accessory{Name: "redis", Image: "redis:7"}).Return("redis-id", nil)
+	useMockDockerService(t, mockDockerService)
 
-	// Save the original dockerServiceCreator
-	originalDockerServiceCreator := dockerServiceCreator
+	err := runAccessoryStart(createTestCommand(), nil, accessoryConfigLoader)
 
-	// Replace dockerServiceCreator with a mock version
-	dockerServiceCreator = func() (DockerService, error) {
-		return mockDockerService, nil
-	}
+	assert.NoError(t, err)
+	mockDockerService.AssertExpectations(t)
+}
 
-	// Restore the original dockerServiceCreator after the test
-	defer func() {
-		dockerServiceCreator = originalDockerServiceCreator
-	}()
+func TestRunAccessoryStart_Unknown(t *testing.T) {
+	mockDockerService := new(MockDockerService)
+	useMockDockerService(t, mockDockerService)
+
+	err := runAccessoryStart(createTestCommand(), []string{"mysql"}, accessoryConfigLoader)
+
+	assert.EqualError(t, err, "no accessory named mysql in the config")
+	mockDockerService.AssertNotCalled(t, "StartAccessory", mock.Anything, mock.Anything)
+}
+
+func TestRunAccessoryStop_Named(t *testing.T) {
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("StopAccessory", "memos", "redis").Return(nil)
+	useMockDockerService(t, mockDockerService)
 
-	err := runStatus()
+	err := runAccessoryStop(createTestCommand(), []string{"redis"}, accessoryConfigLoader)
 
 	assert.NoError(t, err)
 	mockDockerService.AssertExpectations(t)
 }
 
-func TestRunStatus_Error(t *testing.T) {
+func TestRunAccessoryLogs(t *testing.T) {
 	mockDockerService := new(MockDockerService)
-	mockDockerService.On("GetStatus").Return(errors.New("status error"))
+	mockDockerService.On("FindAccessory", "memos", "db").Return("db-id", nil)
+	mockDockerService.On("StreamLogs", "db-id", docker.LogOptions{Tail: "20", Follow: true}, mock.Anything, mock.Anything).Return(nil)
+	useMockDockerService(t, mockDockerService)
 
-	originalDockerServiceCreator := dockerServiceCreator
-	dockerServiceCreator = func() (DockerService, error) {
-		return mockDockerService, nil
-	}
-	defer func() { dockerServiceCreator = originalDockerServiceCreator }()
+	cmd := createTestCommand()
+	cmd.Flags().String("tail", "20", "")
+	err := runAccessoryLogs(cmd, []string{"db"}, accessoryConfigLoader)
 
-	err := runStatus()
+	assert.NoError(t, err)
+	mockDockerService.AssertExpectations(t)
+}
 
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "status error")
+func TestRunInit_FromCompose(t *testing.T) {
+	dir := t.TempDir()
+	composePath := filepath.Join(dir, "docker-compose.yml")
+	configPath := filepath.Join(dir, "slick.yml")
+	err := os.WriteFile(composePath, []byte(`
+services:
+  web:
+    image: ghcr.io/usememos/memos
+    ports: ["5230:5230"]
+    environment: [SECRET_KEY]
+  redis:
+    image: redis:7
+`), 0o644)
+	assert.NoError(t, err)
+
+	cmd := createTestCommand()
+	cmd.Flags().Set("config", configPath)
+	cmd.Flags().Set("from-compose", composePath)
+	cmd.Flags().Set("domain", "memos.example.com")
+
+	err = runInit(cmd)
+	assert.NoError(t, err)
+
+	cfg, err := config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "web", cfg.App.Name)
+	assert.Equal(t, 5230, cfg.App.ContainerPort)
+	assert.Equal(t, []string{"SECRET_KEY"}, cfg.App.ENV)
+	assert.Equal(t, "memos.example.com", cfg.Caddy.Rules[0].Match)
+	assert.Equal(t, "redis", cfg.Accessories[0].Name)
+
+	err = runInit(cmd)
+	assert.EqualError(t, err, configPath+" already exists, use --force to overwrite it")
+
+	cmd.Flags().Set("force", "true")
+	assert.NoError(t, runInit(cmd))
+}
+
+func TestRunInit_Interactive(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "slick.yml")
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("ImagePorts", "ghcr.io/usememos/memos").Return([]int{5230, 9090}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	cmd := createTestCommand()
+	cmd.Flags().Set("config", configPath)
+	cmd.Flags().Set("probe", "true")
+	cmd.SetIn(strings.NewReader("memos\nghcr.io/usememos/memos\n\nmemos.example.com, www.memos.example.com\nhealth\ny\n\nhttp://localhost:3000/ask\n"))
+	var prompts bytes.Buffer
+	cmd.SetErr(&prompts)
+
+	err := runInit(cmd)
+	assert.NoError(t, err)
+	assert.Contains(t, prompts.String(), "Container port [5230]: ")
+	assert.Contains(t, prompts.String(), "ask URL is required")
+
+	cfg, err := config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "memos", cfg.App.Name)
+	assert.Equal(t, "ghcr.io/usememos/memos", cfg.App.ImageName)
+	assert.Equal(t, 5230, cfg.App.ContainerPort)
+	assert.Equal(t, "/health", cfg.HealthCheck.Endpoint)
+	assert.Equal(t, "http://localhost:3000/ask", cfg.Caddy.Global.OnDemandTls.Ask)
+	if assert.Len(t, cfg.Caddy.Rules, 2) {
+		assert.Equal(t, "www.memos.example.com", cfg.Caddy.Rules[1].Match)
+		assert.Equal(t, "on_demand", cfg.Caddy.Rules[1].Tls)
+		assert.Equal(t, "localhost:{port}", cfg.Caddy.Rules[1].ReverseProxy[0].To)
+	}
+
+	data, err := os.ReadFile(configPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "# Port the app listens on inside the container.")
 	mockDockerService.AssertExpectations(t)
 }
 
-func TestRunStatus_DockerServiceCreatorFails(t *testing.T) {
-	originalDockerServiceCreator := dockerServiceCreator
-	dockerServiceCreator = func() (DockerService, error) {
-		return nil, errors.New("failed to create Docker service")
+func TestRunInit_Defaults(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "slick.yml")
+
+	cmd := createTestCommand()
+	cmd.Flags().Set("config", configPath)
+	cmd.SetIn(strings.NewReader("app\nnginx\nhttp\n8080\n"))
+	cmd.SetErr(io.Discard)
+
+	err := runInit(cmd)
+	assert.NoError(t, err)
+
+	cfg, err := config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 8080, cfg.App.ContainerPort)
+	assert.Equal(t, "localhost", cfg.Caddy.Rules[0].Match)
+	assert.Equal(t, "/", cfg.HealthCheck.Endpoint)
+	assert.Empty(t, cfg.Caddy.Global.OnDemandTls.Ask)
+}
+
+func TestRunInit_MissingAnswers(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "slick.yml")
+
+	cmd := createTestCommand()
+	cmd.Flags().Set("config", configPath)
+	cmd.SetIn(strings.NewReader("app\n"))
+	cmd.SetErr(io.Discard)
+
+	err := runInit(cmd)
+	assert.EqualError(t, err, "image is required")
+	assert.NoFileExists(t, configPath)
+}
+
+func TestRunDeploy_FleetFlags(t *testing.T) {
+	useTempStateStore(t)
+
+	mockDeployer := new(MockDeployer)
+	mockDeployer.On("Deploy", mock.Anything, mock.MatchedBy(func(cfg config.DeploymentConfig) bool {
+		return cfg.Fleet.Parallelism == 3 && cfg.Fleet.OnFailure == config.FleetContinue
+	}), mock.Anything).Return(nil)
+
+	loader := func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{
+			App:     config.App{Name: "memos"},
+			Servers: []string{"ssh://web1", "ssh://web2"},
+			Fleet:   config.FleetConfig{Parallelism: 1, OnFailure: config.FleetRollback},
+		}, nil
 	}
-	defer func() { dockerServiceCreator = originalDockerServiceCreator }()
 
-	err := runStatus()
+	cmd := createTestCommand()
+	cmd.Flags().Set("parallel", "3")
+	cmd.Flags().Set("on-failure", "continue")
 
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to create Docker service")
+	err := runDeploy(cmd, mockDeployer, loader)
+	assert.NoError(t, err)
+	mockDeployer.AssertExpectations(t)
+
+	cmd = createTestCommand()
+	cmd.Flags().Set("on-failure", "retry")
+	err = runDeploy(cmd, mockDeployer, loader)
+	assert.EqualError(t, err, `invalid --on-failure "retry", expected rollback, abort or continue`)
 }
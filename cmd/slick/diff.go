@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/scmmishra/slick-deploy/internal/caddy"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+// change is a value before and after a deploy.
+type change struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// deployDiff is what a deploy of the config would change on one server.
+// Env values are compared but never shown.
+type deployDiff struct {
+	App    string `json:"app"`
+	Server string `json:"server"`
+	// Container is the running container the config is compared with,
+	// empty when the app is not running.
+	Container      string   `json:"container,omitempty"`
+	Image          *change  `json:"image,omitempty"`
+	Digest         *change  `json:"digest,omitempty"`
+	EnvAdded       []string `json:"env_added,omitempty"`
+	EnvRemoved     []string `json:"env_removed,omitempty"`
+	EnvChanged     []string `json:"env_changed,omitempty"`
+	VolumesAdded   []string `json:"volumes_added,omitempty"`
+	VolumesRemoved []string `json:"volumes_removed,omitempty"`
+	Network        *change  `json:"network,omitempty"`
+	// Caddy is a unified diff of the running and the new Caddy config.
+	Caddy    string   `json:"caddy,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// empty reports whether the deploy changes nothing but the container.
+func (d deployDiff) empty() bool {
+	return d.Image == nil && d.Digest == nil && d.Network == nil && d.Caddy == "" &&
+		len(d.EnvAdded)+len(d.EnvRemoved)+len(d.EnvChanged)+len(d.VolumesAdded)+len(d.VolumesRemoved) == 0
+}
+
+func runDiff(cmd *cobra.Command, configLoader ConfigLoader) error {
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	return showDiff(cmd, cfg)
+}
+
+// showDiff prints what a deploy of cfg would change, touching nothing.
+func showDiff(cmd *cobra.Command, cfg config.DeploymentConfig) error {
+	output, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	hosts, err := statusHosts(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	diffs := make([]deployDiff, 0, len(hosts))
+	for _, host := range hosts {
+		diff, err := diffOn(ctx, cfg, host)
+		if err != nil {
+			return fmt.Errorf("error comparing with %s: %w", serverName(host), err)
+		}
+		diffs = append(diffs, diff)
+	}
+
+	if output == outputJSON {
+		return writeJSON(os.Stdout, diffs)
+	}
+
+	for i, diff := range diffs {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printDiff(os.Stdout, diff); err != nil {
+			return err
+		}
+		for _, warning := range diff.Warnings {
+			slog.Warn(warning, "app", diff.App, "server", diff.Server)
+		}
+	}
+
+	return nil
+}
+
+// diffOn compares the running app on host, nil for the local machine, with
+// what a deploy of cfg would create.
+func diffOn(ctx context.Context, cfg config.DeploymentConfig, host *remote.Host) (deployDiff, error) {
+	diff := deployDiff{App: cfg.App.Name, Server: serverName(host)}
+
+	dockerService, transport, err := dockerServiceOn(host)
+	if err != nil {
+		return diff, err
+	}
+
+	containers, err := dockerService.AppContainers(ctx, cfg.App.Name)
+	if err != nil {
+		return diff, fmt.Errorf("error listing containers of %s: %w", cfg.App.Name, err)
+	}
+
+	current := docker.Spec{}
+	upstream := caddy.Upstream{}
+	if running := currentContainer(cfg, host, containers); running != nil {
+		diff.Container = running.Name
+		current, err = dockerService.RunningSpec(ctx, running.ID)
+		if err != nil {
+			return diff, fmt.Errorf("error inspecting container %s: %w", running.Name, err)
+		}
+		// Keep the upstream of the running container, it changes on every
+		// deploy and would hide the changes that matter.
+		upstream = caddy.Upstream{Host: running.Alias, Port: running.Port}
+		if upstream.Host == "" {
+			upstream.Host = running.IP
+		}
+	}
+
+	desired, err := dockerService.DesiredSpec(ctx, cfg.App)
+	if err != nil {
+		return diff, err
+	}
+
+	compareSpecs(&diff, current, desired)
+
+	caddyDiff, err := diffCaddy(ctx, cfg, transport, upstream)
+	if err != nil {
+		diff.Warnings = append(diff.Warnings, fmt.Sprintf("Unable to compare the Caddy config: %v", err))
+	}
+	diff.Caddy = caddyDiff
+
+	return diff, nil
+}
+
+// currentContainer returns the container of the last successful deploy, or
+// the newest one when it is not running. Nil when nothing runs.
+func currentContainer(cfg config.DeploymentConfig, host *remote.Host, containers []docker.AppContainer) *docker.AppContainer {
+	if len(containers) == 0 {
+		return nil
+	}
+
+	last, err := stateStoreCreator().LastSuccessfulOn(cfg.App.Name, host.Name())
+	if err == nil && last != nil && last.ContainerID != "" {
+		for i := range containers {
+			if sameContainer(containers[i].ID, last.ContainerID) {
+				return &containers[i]
+			}
+		}
+	}
+
+	return &containers[0]
+}
+
+// compareSpecs records the differences between the running and the desired
+// spec in diff.
+func compareSpecs(diff *deployDiff, current, desired docker.Spec) {
+	if current.Image != desired.Image {
+		diff.Image = &change{From: current.Image, To: desired.Image}
+	}
+	if current.Digest != desired.Digest && desired.Digest != "" {
+		diff.Digest = &change{From: current.Digest, To: desired.Digest}
+	}
+	if current.Network != desired.Network {
+		diff.Network = &change{From: current.Network, To: desired.Network}
+	}
+
+	for key, value := range desired.Env {
+		currentValue, ok := current.Env[key]
+		switch {
+		case !ok:
+			diff.EnvAdded = append(diff.EnvAdded, key)
+		case currentValue != value:
+			diff.EnvChanged = append(diff.EnvChanged, key)
+		}
+	}
+	for key := range current.Env {
+		if _, ok := desired.Env[key]; !ok {
+			diff.EnvRemoved = append(diff.EnvRemoved, key)
+		}
+	}
+
+	diff.VolumesAdded = missing(desired.Volumes, current.Volumes)
+	diff.VolumesRemoved = missing(current.Volumes, desired.Volumes)
+
+	for _, keys := range [][]string{diff.EnvAdded, diff.EnvRemoved, diff.EnvChanged} {
+		sort.Strings(keys)
+	}
+}
+
+// missing returns the values of a that are not in b.
+func missing(a, b []string) []string {
+	var values []string
+	for _, value := range a {
+		found := false
+		for _, other := range b {
+			if value == other {
+				found = true
+			}
+		}
+		if !found {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// diffCaddy returns a unified diff of the config Caddy runs and the one a
+// deploy of cfg would load, both as JSON adapted by Caddy itself.
+func diffCaddy(ctx context.Context, cfg config.DeploymentConfig, transport http.RoundTripper, upstream caddy.Upstream) (string, error) {
+	client := &caddy.CaddyClient{
+		BaseURL:    cfg.Caddy.AdminAPI,
+		HTTPClient: &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}
+
+	running, err := client.Config(ctx)
+	if err != nil {
+		return "", err
+	}
+	adapted, err := client.Adapt(ctx, caddy.ConvertToCaddyfileForUpstream(cfg.Caddy, upstream))
+	if err != nil {
+		return "", err
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(running)),
+		B:        difflib.SplitLines(string(adapted)),
+		FromFile: "caddy (running)",
+		ToFile:   "caddy (new)",
+		Context:  3,
+	})
+}
+
+func printDiff(out io.Writer, diff deployDiff) error {
+	if diff.empty() {
+		fmt.Fprintf(out, "No changes to %s on %s\n", diff.App, diff.Server)
+		return nil
+	}
+
+	from := "not running"
+	if diff.Container != "" {
+		from = "container " + diff.Container
+	}
+	fmt.Fprintf(out, "Changes to %s on %s, compared with %s:\n", diff.App, diff.Server, from)
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	printChange := func(name string, c *change, none string) {
+		if c != nil {
+			fmt.Fprintf(w, "  %s\t%s -> %s\n", name, orDefault(c.From, none), orDefault(c.To, none))
+		}
+	}
+	printList := func(name, sign string, values []string) {
+		for _, value := range values {
+			fmt.Fprintf(w, "  %s\t%s %s\n", name, sign, value)
+		}
+	}
+
+	printChange("image", diff.Image, "(none)")
+	printChange("digest", diff.Digest, "(unknown)")
+	printList("env", "+", diff.EnvAdded)
+	printList("env", "-", diff.EnvRemoved)
+	printList("env", "~", diff.EnvChanged)
+	printList("volume", "+", diff.VolumesAdded)
+	printList("volume", "-", diff.VolumesRemoved)
+	printChange("network", diff.Network, "(default)")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if diff.Caddy != "" {
+		fmt.Fprint(out, diff.Caddy)
+	}
+	return nil
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
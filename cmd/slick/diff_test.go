@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCompareSpecs(t *testing.T) {
+	current := docker.Spec{
+		Image:   "example/image:v1",
+		Digest:  "sha256:aaa",
+		Env:     map[string]string{"KEPT": "1", "CHANGED": "old", "REMOVED": "1"},
+		Volumes: []string{"/data:/data", "/old:/old"},
+	}
+	desired := docker.Spec{
+		Image:   "example/image:v2",
+		Digest:  "sha256:bbb",
+		Env:     map[string]string{"KEPT": "1", "CHANGED": "new", "ADDED": "1", "ALSO_ADDED": "1"},
+		Volumes: []string{"/data:/data", "/new:/new"},
+		Network: "web",
+	}
+
+	var diff deployDiff
+	compareSpecs(&diff, current, desired)
+
+	assert.Equal(t, &change{From: "example/image:v1", To: "example/image:v2"}, diff.Image)
+	assert.Equal(t, &change{From: "sha256:aaa", To: "sha256:bbb"}, diff.Digest)
+	assert.Equal(t, &change{To: "web"}, diff.Network)
+	assert.Equal(t, []string{"ADDED", "ALSO_ADDED"}, diff.EnvAdded)
+	assert.Equal(t, []string{"REMOVED"}, diff.EnvRemoved)
+	assert.Equal(t, []string{"CHANGED"}, diff.EnvChanged)
+	assert.Equal(t, []string{"/new:/new"}, diff.VolumesAdded)
+	assert.Equal(t, []string{"/old:/old"}, diff.VolumesRemoved)
+
+	diff = deployDiff{}
+	compareSpecs(&diff, current, current)
+	assert.True(t, diff.empty())
+}
+
+// diffCaddyServer fakes the Caddy admin API, running one config and adapting
+// every Caddyfile into another.
+func diffCaddyServer(t *testing.T, running, adapted string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/config/":
+			_, _ = rw.Write([]byte(running))
+		case "/adapt":
+			_, _ = rw.Write([]byte(`{"result":` + adapted + `}`))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestRunDiff(t *testing.T) {
+	useTempStateStore(t)
+	adminAPI := diffCaddyServer(t, `{"apps":{"http":{"servers":{"srv0":{"listen":[":443"]}}}}}`, `{"apps":{"http":{"servers":{"srv0":{"listen":[":443",":80"]}}}}}`)
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{
+		{Container: docker.Container{ID: "abc123", Port: 8001, IP: "127.0.0.1"}, Name: "memos-first"},
+	}, nil)
+	mockDockerService.On("RunningSpec", "abc123").Return(docker.Spec{Image: "example/image:v1", Env: map[string]string{"SECRET": "s3cr3t-old"}}, nil)
+	mockDockerService.On("DesiredSpec", mock.Anything).Return(docker.Spec{Image: "example/image:v2", Env: map[string]string{"SECRET": "s3cr3t-new"}}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runDiff(createTestCommand(), statusConfigLoader(adminAPI))
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Changes to memos on local, compared with container memos-first:")
+	assert.Regexp(t, `image\s+example/image:v1 -> example/image:v2`, output)
+	assert.Regexp(t, `env\s+~ SECRET\n`, output)
+	assert.NotContains(t, output, "s3cr3t")
+	assert.Contains(t, output, "--- caddy (running)\n+++ caddy (new)\n")
+	assert.Contains(t, output, `+            ":80"`)
+	mockDockerService.AssertExpectations(t)
+}
@@ -1,21 +1,71 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 
+	"github.com/scmmishra/slick-deploy/internal/config"
 	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/spf13/cobra"
 )
 
 type DockerService interface {
-	GetStatus() error
-	FindContainer(imageName string) *docker.Container
-	StreamLogs(containerID string, tail string) error
+	AppContainers(ctx context.Context, app string) ([]docker.AppContainer, error)
+	Processes(ctx context.Context, app, deployID string) ([]docker.Process, error)
+	RunningSpec(ctx context.Context, containerID string) (docker.Spec, error)
+	DesiredSpec(ctx context.Context, appCfg config.App) (docker.Spec, error)
+	FindContainer(ctx context.Context, app string) *docker.Container
+	StopContainer(ctx context.Context, containerID string) error
+	RetireContainer(ctx context.Context, containerID string) error
+	Exec(ctx context.Context, containerID string, opts docker.ExecOptions) (int, error)
+	RunOneOff(ctx context.Context, imageName string, appCfg config.App, cmd []string, stdout, stderr io.Writer) (int, error)
+	StreamLogs(ctx context.Context, containerID string, opts docker.LogOptions, stdout, stderr io.Writer) error
+	StartAccessory(ctx context.Context, app string, accessory config.Accessory) (string, error)
+	StopAccessory(ctx context.Context, app, name string) error
+	FindAccessory(ctx context.Context, app, name string) (string, error)
+	ImagePorts(ctx context.Context, imageName string) ([]int, error)
+	Prune(ctx context.Context, app string, opts docker.PruneOptions) (docker.PruneReport, error)
 }
 
-type DockerServiceCreator func() (DockerService, error)
+// DockerServiceCreator connects to the Docker daemon of host, the local one
+// when host is nil.
+type DockerServiceCreator func(host *remote.Host) (DockerService, error)
 
-var dockerServiceCreator DockerServiceCreator = func() (DockerService, error) {
-	return newDockerService(docker.NewDockerClient)
+var dockerServiceCreator DockerServiceCreator = func(host *remote.Host) (DockerService, error) {
+	return newDockerService(dockerClientCreator(host))
+}
+
+// targetHost is the server given with --host, nil for the local daemon.
+var targetHost *remote.Host
+
+// setupHost reads the server to work on from --host or $SLICK_HOST.
+func setupHost(cmd *cobra.Command) error {
+	raw, _ := cmd.Flags().GetString("host")
+	if raw == "" {
+		raw = os.Getenv("SLICK_HOST")
+	}
+	if raw == "" {
+		targetHost = nil
+		return nil
+	}
+
+	host, err := remote.ParseHost(raw)
+	if err != nil {
+		return err
+	}
+	targetHost = host
+	return nil
+}
+
+// dockerClientCreator returns the client creator for host.
+func dockerClientCreator(host *remote.Host) DockerClientCreator {
+	if host != nil {
+		return host.DockerClient
+	}
+	return docker.NewDockerClient
 }
 
 type DockerClientCreator func() (docker.DockerClient, error)
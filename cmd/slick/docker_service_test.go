@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,3 +19,26 @@ func TestNewDockerService(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create Docker client")
 }
+
+func TestSetupHost(t *testing.T) {
+	t.Cleanup(func() { targetHost = nil })
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("host", "", "")
+
+	t.Setenv("SLICK_HOST", "")
+	assert.NoError(t, setupHost(cmd))
+	assert.Nil(t, targetHost)
+
+	t.Setenv("SLICK_HOST", "ssh://deploy@example.com")
+	assert.NoError(t, setupHost(cmd))
+	assert.Equal(t, "ssh://deploy@example.com", targetHost.String())
+
+	cmd.Flags().Set("host", "ssh://root@10.0.0.2:2222")
+	assert.NoError(t, setupHost(cmd))
+	assert.Equal(t, "ssh://root@10.0.0.2:2222", targetHost.String())
+	assert.Equal(t, targetHost, deployOptions(createTestCommand()).Host)
+
+	cmd.Flags().Set("host", "tcp://10.0.0.2:2375")
+	assert.Error(t, setupHost(cmd))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/moby/term"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+// shellCommand starts bash when the image has it, sh otherwise.
+var shellCommand = []string{"/bin/sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"}
+
+// exitCodeError makes slick exit with the exit code of a command it ran in
+// a container.
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.code)
+}
+
+// exitCode returns the exit code of the command err comes from, false
+// when err is an error of slick itself.
+func exitCode(err error) (int, bool) {
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.code, true
+	}
+	return 0, false
+}
+
+func runExec(cmd *cobra.Command, args []string, configLoader ConfigLoader) error {
+	return execInApp(cmd, args, configLoader)
+}
+
+func runShell(cmd *cobra.Command, configLoader ConfigLoader) error {
+	return execInApp(cmd, shellCommand, configLoader)
+}
+
+// execInApp runs command in the running container of the app, or of the
+// worker given with --service.
+func execInApp(cmd *cobra.Command, command []string, configLoader ConfigLoader) error {
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	dockerService, err := dockerServiceCreator(targetHost)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	service, _ := cmd.Flags().GetString("service")
+	if service == "" {
+		service = docker.ServiceWeb
+	}
+	process, err := appProcess(ctx, cfg, dockerService, service)
+	if err != nil {
+		return err
+	}
+
+	noTTY, _ := cmd.Flags().GetBool("no-tty")
+	return execIn(ctx, dockerService, process.ID, command, !noTTY)
+}
+
+// appProcess returns the running container of service, docker.ServiceWeb
+// or a worker, found the same way slick logs finds them. When several run,
+// the one of the last successful deploy wins, or else the first.
+func appProcess(ctx context.Context, cfg config.DeploymentConfig, dockerService DockerService, service string) (*docker.Process, error) {
+	processes, err := dockerService.Processes(ctx, cfg.App.Name, "")
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers of %s: %w", cfg.App.Name, err)
+	}
+
+	var found []docker.Process
+	for _, p := range processes {
+		if p.Service == service {
+			found = append(found, p)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no %s container of %s is running", service, cfg.App.Name)
+	}
+
+	last, err := stateStoreCreator().LastSuccessfulOn(cfg.App.Name, targetHost.Name())
+	if err == nil && last != nil {
+		for i := range found {
+			if found[i].DeployID == last.ID {
+				return &found[i], nil
+			}
+		}
+	}
+
+	return &found[0], nil
+}
+
+// execIn runs command in a container with the standard streams of slick
+// attached. With tty, and when slick runs in a terminal, the command gets
+// a terminal too and the local one is switched to raw mode meanwhile.
+func execIn(ctx context.Context, dockerService DockerService, containerID string, command []string, tty bool) error {
+	opts := docker.ExecOptions{
+		Cmd:    command,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+
+	fd, stdinTerminal := term.GetFdInfo(os.Stdin)
+	_, stdoutTerminal := term.GetFdInfo(os.Stdout)
+	if tty && stdinTerminal && stdoutTerminal {
+		opts.TTY = true
+		if size, err := term.GetWinsize(fd); err == nil {
+			opts.Size = [2]uint{uint(size.Height), uint(size.Width)}
+		}
+
+		state, err := term.SetRawTerminal(fd)
+		if err != nil {
+			return fmt.Errorf("error switching the terminal to raw mode: %w", err)
+		}
+		defer term.RestoreTerminal(fd, state)
+
+		resize, stopResize := watchResize(fd)
+		defer stopResize()
+		opts.Resize = resize
+	}
+
+	code, err := dockerService.Exec(ctx, containerID, opts)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return &exitCodeError{code: code}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunExec(t *testing.T) {
+	store := useTempStateStore(t)
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", Status: state.StatusSucceeded}))
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{
+		{ID: "first-web", Name: "memos-first", Service: docker.ServiceWeb, DeployID: "first", Running: true},
+		{ID: "second-web", Name: "memos-second", Service: docker.ServiceWeb, DeployID: "second", Running: true},
+		{ID: "second-jobs", Name: "memos-jobs-second", Service: "jobs", DeployID: "second", Running: true},
+	}, nil)
+	mockDockerService.On("Exec", "second-web", []string{"rails", "console"}, false).Return(0, nil)
+	useMockDockerService(t, mockDockerService)
+
+	err := runExec(createTestCommand(), []string{"rails", "console"}, statusConfigLoader(""))
+
+	assert.NoError(t, err)
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunExec_ExitCode(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{
+		{ID: "web", Name: "memos-abc", Service: docker.ServiceWeb, Running: true},
+		{ID: "jobs", Name: "memos-jobs-abc", Service: "jobs", Running: true},
+	}, nil)
+	mockDockerService.On("Exec", "jobs", []string{"false"}, false).Return(3, nil)
+	useMockDockerService(t, mockDockerService)
+
+	cmd := createTestCommand()
+	assert.NoError(t, cmd.Flags().Set("service", "jobs"))
+	assert.NoError(t, cmd.Flags().Set("no-tty", "true"))
+	err := runExec(cmd, []string{"false"}, statusConfigLoader(""))
+
+	code, ok := exitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3, code)
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunExec_NoContainer(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{
+		{ID: "web", Name: "memos-abc", Service: docker.ServiceWeb, Running: true},
+	}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	cmd := createTestCommand()
+	assert.NoError(t, cmd.Flags().Set("service", "jobs"))
+	err := runExec(cmd, []string{"ls"}, statusConfigLoader(""))
+
+	assert.EqualError(t, err, "no jobs container of memos is running")
+	_, ok := exitCode(err)
+	assert.False(t, ok)
+}
+
+func TestRunShell(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{
+		{ID: "web", Name: "memos-abc", Service: docker.ServiceWeb, Running: true},
+	}, nil)
+	mockDockerService.On("Exec", "web", shellCommand, false).Return(0, nil)
+	useMockDockerService(t, mockDockerService)
+
+	err := runShell(createTestCommand(), statusConfigLoader(""))
+
+	assert.NoError(t, err)
+	mockDockerService.AssertExpectations(t)
+}
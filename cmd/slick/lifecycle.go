@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/caddy"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/deploy"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// defaultMaintenanceMessage is what Caddy answers while the app is stopped.
+const defaultMaintenanceMessage = "Service Unavailable"
+
+func runStop(cmd *cobra.Command, configLoader ConfigLoader) error {
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	message, _ := cmd.Flags().GetString("message")
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+
+	hosts, err := statusHosts(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	lock, err := lockDeploy(ctx, cmd, cfg.App.Name, hosts)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	for _, host := range hosts {
+		if err := stopOn(ctx, cfg, host, message); err != nil {
+			return fmt.Errorf("error stopping %s on %s: %w", cfg.App.Name, serverName(host), err)
+		}
+	}
+
+	return nil
+}
+
+// stopOn points Caddy at a maintenance response and stops the web and
+// worker containers of the app on host. The containers are kept until they
+// are pruned, like the ones a deploy replaces. Accessories keep running.
+func stopOn(ctx context.Context, cfg config.DeploymentConfig, host *remote.Host, message string) error {
+	store := stateStoreCreator()
+	stopped, err := store.StoppedOn(cfg.App.Name, host.Name())
+	if err != nil {
+		return err
+	}
+	if stopped != nil {
+		slog.Info(fmt.Sprintf("%s is already stopped on %s", cfg.App.Name, serverName(host)))
+		return nil
+	}
+
+	dockerService, transport, err := dockerServiceOn(host)
+	if err != nil {
+		return err
+	}
+
+	// Move the traffic away first, so no request reaches a stopping container.
+	client := &caddy.CaddyClient{
+		BaseURL:    cfg.Caddy.AdminAPI,
+		HTTPClient: &http.Client{Transport: transport},
+		Logger:     slog.Default(),
+	}
+	if err := caddy.SetupMaintenanceWithClient(ctx, client, cfg, message); err != nil {
+		return fmt.Errorf("error switching Caddy to maintenance: %w", err)
+	}
+
+	processes, err := dockerService.Processes(ctx, cfg.App.Name, "")
+	if err != nil {
+		return fmt.Errorf("error listing containers of %s: %w", cfg.App.Name, err)
+	}
+	for _, p := range processes {
+		slog.Info("Stopping " + p.Name)
+		if err := dockerService.RetireContainer(ctx, p.ID); err != nil {
+			return fmt.Errorf("error stopping %s: %w", p.Name, err)
+		}
+	}
+
+	now := time.Now()
+	record := state.Deployment{
+		ID:         state.NewDeploymentID(now),
+		App:        cfg.App.Name,
+		Status:     state.StatusStopped,
+		Deployer:   state.CurrentUser(),
+		Host:       host.Name(),
+		StartedAt:  now,
+		FinishedAt: now,
+	}
+	if last, err := store.LastSuccessfulOn(cfg.App.Name, host.Name()); err == nil && last != nil {
+		record.Image = last.Image
+	}
+	if err := store.Record(record); err != nil {
+		return err
+	}
+
+	slog.Info(fmt.Sprintf("Stopped %s on %s", cfg.App.Name, serverName(host)))
+	return nil
+}
+
+func runStart(cmd *cobra.Command, configLoader ConfigLoader) error {
+	return redeployLast(cmd, configLoader, "slick start", startOn)
+}
+
+func runRestart(cmd *cobra.Command, configLoader ConfigLoader) error {
+	return redeployLast(cmd, configLoader, "slick restart", nil)
+}
+
+// redeployLast rolls the last successful deploy out again on every server,
+// through the regular deploy: a fresh container takes the traffic once it
+// is healthy and the old one is stopped, so nothing goes down. The image is
+// not pulled again and the pre_deploy and post_deploy hooks do not rerun.
+// A non-nil skip tells the servers to leave alone.
+func redeployLast(cmd *cobra.Command, configLoader ConfigLoader, deployer string, skip func(context.Context, config.DeploymentConfig, *remote.Host) (bool, error)) error {
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	hosts, err := statusHosts(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	lock, err := lockDeploy(ctx, cmd, cfg.App.Name, hosts)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	for _, host := range hosts {
+		last, err := stateStoreCreator().LastSuccessfulOn(cfg.App.Name, host.Name())
+		if err != nil {
+			return err
+		}
+		if last == nil || last.Image == "" {
+			return fmt.Errorf("%s was never deployed to %s, run slick deploy first", cfg.App.Name, serverName(host))
+		}
+
+		if skip != nil {
+			skipped, err := skip(ctx, cfg, host)
+			if err != nil {
+				return err
+			}
+			if skipped {
+				continue
+			}
+		}
+
+		redeployCfg := cfg
+		redeployCfg.App.ImageName = last.Image
+		opts := deploy.Options{GitSHA: last.GitSHA, Deployer: deployer, Host: host, Restart: true}
+		if err := defaultDeployer.Deploy(ctx, redeployCfg, opts); err != nil {
+			return fmt.Errorf("error deploying %s to %s: %w", last.Image, serverName(host), err)
+		}
+	}
+
+	return nil
+}
+
+// startOn skips the servers where the app was not stopped and still runs.
+func startOn(ctx context.Context, cfg config.DeploymentConfig, host *remote.Host) (bool, error) {
+	stopped, err := stateStoreCreator().StoppedOn(cfg.App.Name, host.Name())
+	if err != nil || stopped != nil {
+		return false, err
+	}
+
+	dockerService, _, err := dockerServiceOn(host)
+	if err != nil {
+		return false, err
+	}
+	processes, err := dockerService.Processes(ctx, cfg.App.Name, "")
+	if err != nil {
+		return false, fmt.Errorf("error listing containers of %s: %w", cfg.App.Name, err)
+	}
+	for _, p := range processes {
+		if p.Service == docker.ServiceWeb {
+			slog.Info(fmt.Sprintf("%s is already running on %s, use slick restart to replace its containers", cfg.App.Name, serverName(host)))
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
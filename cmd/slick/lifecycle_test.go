@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/deploy"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRunStop(t *testing.T) {
+	store := useTempStateStore(t)
+	adminAPI, loaded := reconcileCaddy(t, "localhost:8002")
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{
+		{ID: "web", Name: "memos-second", Service: docker.ServiceWeb, Running: true},
+		{ID: "jobs", Name: "memos-jobs-second", Service: "jobs", Running: true},
+	}, nil)
+	mockDockerService.On("RetireContainer", "web").Return(nil)
+	mockDockerService.On("RetireContainer", "jobs").Return(nil)
+	useMockDockerService(t, mockDockerService)
+
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", Image: "example/image:v2", Status: state.StatusSucceeded}))
+
+	cmd := createTestCommand()
+	cmd.Flags().String("message", "Back soon", "")
+	err := runStop(cmd, statusConfigLoader(adminAPI))
+
+	assert.NoError(t, err)
+	if assert.Len(t, *loaded, 1) {
+		assert.Contains(t, (*loaded)[0], `respond "Back soon" 503`)
+		assert.NotContains(t, (*loaded)[0], "reverse_proxy")
+	}
+	mockDockerService.AssertExpectations(t)
+
+	stopped, err := store.StoppedOn("memos", "")
+	assert.NoError(t, err)
+	if assert.NotNil(t, stopped) {
+		assert.Equal(t, "example/image:v2", stopped.Image)
+	}
+}
+
+func TestRunStop_AlreadyStopped(t *testing.T) {
+	store := useTempStateStore(t)
+	adminAPI, loaded := reconcileCaddy(t)
+	mockDockerService := new(MockDockerService)
+	useMockDockerService(t, mockDockerService)
+
+	assert.NoError(t, store.Record(state.Deployment{ID: "third", App: "memos", Status: state.StatusStopped}))
+
+	err := runStop(createTestCommand(), statusConfigLoader(adminAPI))
+
+	assert.NoError(t, err)
+	assert.Empty(t, *loaded)
+	mockDockerService.AssertNotCalled(t, "RetireContainer", mock.Anything)
+}
+
+func TestRunStart(t *testing.T) {
+	store := useTempStateStore(t)
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", Image: "example/image:v2", GitSHA: "abc123", Status: state.StatusSucceeded}))
+	assert.NoError(t, store.Record(state.Deployment{ID: "third", App: "memos", Image: "example/image:v2", Status: state.StatusStopped}))
+
+	mockDeployer := new(MockDeployer)
+	mockDeployer.On("Deploy", mock.Anything, mock.MatchedBy(func(cfg config.DeploymentConfig) bool {
+		return cfg.App.ImageName == "example/image:v2"
+	}), deploy.Options{GitSHA: "abc123", Deployer: "slick start", Restart: true}).Return(nil)
+	useMockDeployer(t, mockDeployer)
+
+	err := runStart(createTestCommand(), statusConfigLoader(""))
+
+	assert.NoError(t, err)
+	mockDeployer.AssertExpectations(t)
+}
+
+func TestRunStart_AlreadyRunning(t *testing.T) {
+	store := useTempStateStore(t)
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", Image: "example/image:v2", Status: state.StatusSucceeded}))
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{
+		{ID: "web", Name: "memos-second", Service: docker.ServiceWeb, Running: true},
+	}, nil)
+	useMockDockerService(t, mockDockerService)
+	mockDeployer := new(MockDeployer)
+	useMockDeployer(t, mockDeployer)
+
+	err := runStart(createTestCommand(), statusConfigLoader(""))
+
+	assert.NoError(t, err)
+	mockDeployer.AssertNotCalled(t, "Deploy", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRunStart_NeverDeployed(t *testing.T) {
+	useTempStateStore(t)
+
+	err := runStart(createTestCommand(), statusConfigLoader(""))
+
+	assert.EqualError(t, err, "memos was never deployed to local, run slick deploy first")
+}
+
+func TestRunRestart(t *testing.T) {
+	store := useTempStateStore(t)
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", Image: "example/image:v2", Status: state.StatusSucceeded}))
+	assert.NoError(t, store.Record(state.Deployment{ID: "third", App: "memos", Image: "example/image:v3", Status: state.StatusFailed}))
+
+	mockDeployer := new(MockDeployer)
+	mockDeployer.On("Deploy", mock.Anything, mock.MatchedBy(func(cfg config.DeploymentConfig) bool {
+		return cfg.App.ImageName == "example/image:v2"
+	}), deploy.Options{Deployer: "slick restart", Restart: true}).Return(errors.New("unhealthy"))
+	useMockDeployer(t, mockDeployer)
+
+	err := runRestart(createTestCommand(), statusConfigLoader(""))
+
+	assert.EqualError(t, err, "error deploying example/image:v2 to local: unhealthy")
+	mockDeployer.AssertExpectations(t)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/scmmishra/slick-deploy/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+func setupLogging(cmd *cobra.Command) error {
+	format, _ := cmd.Flags().GetString("log-format")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	// Logs go to stderr so command output on stdout stays machine readable.
+	_, err := logging.Setup(logging.Options{
+		Format:  format,
+		Quiet:   quiet,
+		Verbose: verbose,
+	}, os.Stderr)
+	return err
+}
+
+// outputFormat returns the --output flag of cmd, text when it is not set.
+func outputFormat(cmd *cobra.Command) (string, error) {
+	output, _ := cmd.Flags().GetString("output")
+	switch output {
+	case "", outputText:
+		return outputText, nil
+	case outputJSON:
+		return outputJSON, nil
+	}
+	return "", fmt.Errorf("invalid output format %q, expected text or json", output)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupLogging(t *testing.T) {
+	original := slog.Default()
+	defer slog.SetDefault(original)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("log-format", "json", "")
+	cmd.Flags().Bool("quiet", false, "")
+	cmd.Flags().Bool("verbose", true, "")
+
+	assert.NoError(t, setupLogging(cmd))
+	assert.True(t, slog.Default().Enabled(context.Background(), slog.LevelDebug))
+}
+
+func TestSetupLogging_InvalidFormat(t *testing.T) {
+	original := slog.Default()
+	defer slog.SetDefault(original)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("log-format", "yaml", "")
+
+	assert.Error(t, setupLogging(cmd))
+}
+
+func TestOutputFormat(t *testing.T) {
+	cmd := &cobra.Command{}
+	format, err := outputFormat(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, outputText, format)
+
+	cmd.Flags().String("output", "json", "")
+	format, err = outputFormat(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, outputJSON, format)
+
+	cmd.Flags().Set("output", "xml")
+	_, err = outputFormat(cmd)
+	assert.Error(t, err)
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeJSON(&buf, map[string]int{"port": 8000}))
+	assert.Equal(t, "{\n  \"port\": 8000\n}\n", buf.String())
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// logsPollInterval is how often a followed log looks for the container
+// that replaced the one it followed.
+var logsPollInterval = time.Second
+
+// colorRed and colorReset wrap the stderr lines of a container on a
+// terminal.
+const (
+	colorRed   = "\x1b[31m"
+	colorReset = "\x1b[0m"
+)
+
+// prefixColors tell the containers apart when the logs of several are
+// shown together.
+var prefixColors = []string{"\x1b[36m", "\x1b[33m", "\x1b[32m", "\x1b[35m", "\x1b[34m"}
+
+func addLogFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("tail", "t", "all", "Number of lines to show from the end of the logs, or all")
+	cmd.Flags().String("since", "", "Show logs since a timestamp (2024-01-02T15:04:05Z) or a duration (10m)")
+	cmd.Flags().String("until", "", "Show logs before a timestamp (2024-01-02T15:04:05Z) or a duration (10m)")
+	cmd.Flags().Bool("timestamps", false, "Prefix every line with the time it was logged")
+	cmd.Flags().Bool("no-follow", false, "Print the logs and exit instead of following them")
+	cmd.Flags().String("grep", "", "Only show lines matching this regular expression")
+}
+
+// logOptions reads the flags added by addLogFlags.
+func logOptions(cmd *cobra.Command) (docker.LogOptions, *regexp.Regexp, error) {
+	tail, _ := cmd.Flags().GetString("tail")
+	since, _ := cmd.Flags().GetString("since")
+	until, _ := cmd.Flags().GetString("until")
+	timestamps, _ := cmd.Flags().GetBool("timestamps")
+	noFollow, _ := cmd.Flags().GetBool("no-follow")
+	opts := docker.LogOptions{
+		Tail:       tail,
+		Since:      since,
+		Until:      until,
+		Timestamps: timestamps,
+		Follow:     !noFollow,
+	}
+
+	pattern, _ := cmd.Flags().GetString("grep")
+	if pattern == "" {
+		return opts, nil, nil
+	}
+	grep, err := regexp.Compile(pattern)
+	if err != nil {
+		return opts, nil, fmt.Errorf("invalid --grep %q: %w", pattern, err)
+	}
+	return opts, grep, nil
+}
+
+func runLogs(cmd *cobra.Command, configLoader ConfigLoader) error {
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts, grep, err := logOptions(cmd)
+	if err != nil {
+		return err
+	}
+	deployID, _ := cmd.Flags().GetString("deployment")
+
+	dockerService, err := dockerServiceCreator(targetHost)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	processes, err := dockerService.Processes(ctx, cfg.App.Name, deployID)
+	if err != nil {
+		return fmt.Errorf("error listing containers of %s: %w", cfg.App.Name, err)
+	}
+	if len(processes) == 0 {
+		if deployID != "" {
+			return fmt.Errorf("no containers of deploy %s are left, they may have been pruned", deployID)
+		}
+		return fmt.Errorf("no container of %s is running", cfg.App.Name)
+	}
+
+	since := opts.Since
+	streamed := map[string]bool{}
+	var ended time.Time
+	for {
+		streams := make([]logStream, 0, len(processes))
+		for _, p := range processes {
+			stream := logStream{Process: p, opts: opts}
+			if streamed[p.ID] {
+				stream.opts.Since = strconv.FormatInt(ended.Unix(), 10)
+			} else if !ended.IsZero() {
+				slog.Info("Following the logs of " + p.Name)
+				stream.opts.Tail = "all"
+				stream.opts.Since = since
+			}
+			streamed[p.ID] = true
+			streams = append(streams, stream)
+		}
+
+		if err := streamLogs(ctx, dockerService, streams, grep); err != nil {
+			return err
+		}
+		// The logs of a past deploy end with its containers.
+		if !opts.Follow || opts.Until != "" || deployID != "" || ctx.Err() != nil {
+			return nil
+		}
+		ended = time.Now()
+
+		// The containers stopped, keep following the app in the ones a
+		// deploy replaced them with.
+		processes, err = waitForProcesses(ctx, cfg, dockerService)
+		if processes == nil {
+			return err
+		}
+	}
+}
+
+// logStream is a container whose logs are streamed with opts.
+type logStream struct {
+	docker.Process
+	opts docker.LogOptions
+}
+
+// streamLogs streams the logs of all streams at once. With more than one,
+// every line is prefixed with the name of its container, like docker
+// compose logs does.
+func streamLogs(ctx context.Context, dockerService DockerService, streams []logStream, grep *regexp.Regexp) error {
+	if len(streams) == 1 {
+		stdout, stderr := newLogWriter(os.Stdout, grep, ""), newLogWriter(os.Stderr, grep, stderrColor())
+		defer stdout.Flush()
+		defer stderr.Flush()
+		return dockerService.StreamLogs(ctx, streams[0].ID, streams[0].opts, stdout, stderr)
+	}
+
+	width := 0
+	for _, stream := range streams {
+		width = max(width, len(stream.Name))
+	}
+
+	var mu sync.Mutex
+	errs := make([]error, len(streams))
+	var wg sync.WaitGroup
+	for i, stream := range streams {
+		prefix := fmt.Sprintf("%-*s | ", width, stream.Name)
+		if colorEnabled(os.Stdout) {
+			prefix = prefixColors[i%len(prefixColors)] + prefix + colorReset
+		}
+		stdout, stderr := newLogWriter(os.Stdout, grep, ""), newLogWriter(os.Stderr, grep, stderrColor())
+		stdout.prefix, stderr.prefix = prefix, prefix
+		stdout.mu, stderr.mu = &mu, &mu
+
+		wg.Add(1)
+		go func(i int, stream logStream) {
+			defer wg.Done()
+			errs[i] = dockerService.StreamLogs(ctx, stream.ID, stream.opts, stdout, stderr)
+			stdout.Flush()
+			stderr.Flush()
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("error reading the logs of %s: %w", stream.Name, errs[i])
+			}
+		}(i, stream)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// waitForProcesses polls until a container of the app runs. It returns nil
+// when ctx is done first.
+func waitForProcesses(ctx context.Context, cfg config.DeploymentConfig, dockerService DockerService) ([]docker.Process, error) {
+	ticker := time.NewTicker(logsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-ticker.C:
+		}
+
+		processes, err := dockerService.Processes(ctx, cfg.App.Name, "")
+		if err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("error listing containers of %s: %w", cfg.App.Name, err)
+		}
+		if len(processes) > 0 {
+			return processes, nil
+		}
+	}
+}
+
+// colorEnabled reports whether output to f is colored, only on a terminal
+// and when NO_COLOR is unset.
+func colorEnabled(f *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && logging.IsTerminal(f)
+}
+
+// stderrColor is the color of stderr lines.
+func stderrColor() string {
+	if !colorEnabled(os.Stderr) {
+		return ""
+	}
+	return colorRed
+}
+
+// logWriter writes the log lines matching grep to out, wrapped in color
+// and behind prefix when they are set. Without any of them it passes the
+// output through untouched. Writers sharing out share mu, so lines of
+// different containers never mix.
+type logWriter struct {
+	out    io.Writer
+	grep   *regexp.Regexp
+	color  string
+	prefix string
+	mu     *sync.Mutex
+	line   []byte
+}
+
+func newLogWriter(out io.Writer, grep *regexp.Regexp, color string) *logWriter {
+	return &logWriter{out: out, grep: grep, color: color}
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	if w.grep == nil && w.color == "" && w.prefix == "" {
+		return w.out.Write(p)
+	}
+
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.writeLine(w.line[:i]); err != nil {
+			return 0, err
+		}
+		w.line = w.line[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes a last line that did not end in a newline.
+func (w *logWriter) Flush() {
+	if len(w.line) > 0 {
+		_ = w.writeLine(w.line)
+		w.line = nil
+	}
+}
+
+func (w *logWriter) writeLine(line []byte) error {
+	if w.grep != nil && !w.grep.Match(line) {
+		return nil
+	}
+
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	var err error
+	if w.color != "" {
+		_, err = fmt.Fprintf(w.out, "%s%s%s%s\n", w.prefix, w.color, line, colorReset)
+	} else {
+		_, err = fmt.Fprintf(w.out, "%s%s\n", w.prefix, line)
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRunLogs(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{
+		{ID: "test-container", Name: "memos-abc", Service: docker.ServiceWeb, Running: true},
+	}, nil)
+	mockDockerService.On("StreamLogs", "test-container", docker.LogOptions{Tail: "10", Since: "5m", Timestamps: true}, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			stdout := args.Get(2).(io.Writer)
+			_, _ = io.WriteString(stdout, "GET /health 200\nGET /api 500\nPOST /api")
+			_, _ = io.WriteString(stdout, " 500\n")
+		}).Return(nil)
+	useMockDockerService(t, mockDockerService)
+
+	cmd := createTestCommand()
+	cmd.Flags().String("tail", "10", "")
+	assert.NoError(t, cmd.Flags().Set("since", "5m"))
+	assert.NoError(t, cmd.Flags().Set("timestamps", "true"))
+	assert.NoError(t, cmd.Flags().Set("no-follow", "true"))
+	assert.NoError(t, cmd.Flags().Set("grep", "500"))
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runLogs(cmd, statusConfigLoader(""))
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "GET /api 500\nPOST /api 500\n", output)
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunLogs_FollowsReplacement(t *testing.T) {
+	useTempStateStore(t)
+	original := logsPollInterval
+	logsPollInterval = time.Millisecond
+	t.Cleanup(func() { logsPollInterval = original })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{
+		{ID: "old", Name: "memos-old", Service: docker.ServiceWeb, Running: true},
+	}, nil).Once()
+	mockDockerService.On("StreamLogs", "old", docker.LogOptions{Tail: "5", Follow: true}, mock.Anything, mock.Anything).Return(nil).Once()
+	// The old container is gone while the deploy switches over.
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{}, nil).Once()
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{
+		{ID: "new", Name: "memos-new", Service: docker.ServiceWeb, Running: true},
+	}, nil).Once()
+	mockDockerService.On("StreamLogs", "new", docker.LogOptions{Tail: "all", Follow: true}, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { cancel() }).Return(nil).Once()
+	useMockDockerService(t, mockDockerService)
+
+	cmd := createTestCommand()
+	cmd.SetContext(ctx)
+	cmd.Flags().String("tail", "5", "")
+
+	err := runLogs(cmd, statusConfigLoader(""))
+
+	assert.NoError(t, err)
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunLogs_Deployment(t *testing.T) {
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "20240102150405-abc123").Return([]docker.Process{
+		{ID: "web", Name: "memos-abc123", Service: docker.ServiceWeb},
+		{ID: "jobs", Name: "memos-jobs-abc123", Service: "jobs"},
+	}, nil)
+	for id, line := range map[string]string{"web": "listening\n", "jobs": "processed 3 jobs\n"} {
+		line := line
+		mockDockerService.On("StreamLogs", id, docker.LogOptions{Tail: "all", Follow: true}, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				_, _ = io.WriteString(args.Get(2).(io.Writer), line)
+			}).Return(nil).Once()
+	}
+	useMockDockerService(t, mockDockerService)
+
+	cmd := createTestCommand()
+	cmd.Flags().String("tail", "all", "")
+	cmd.Flags().String("deployment", "20240102150405-abc123", "")
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runLogs(cmd, statusConfigLoader(""))
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "memos-abc123      | listening\n")
+	assert.Contains(t, output, "memos-jobs-abc123 | processed 3 jobs\n")
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunLogs_DeploymentPruned(t *testing.T) {
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "old").Return([]docker.Process{}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	cmd := createTestCommand()
+	cmd.Flags().String("deployment", "old", "")
+	err := runLogs(cmd, statusConfigLoader(""))
+
+	assert.EqualError(t, err, "no containers of deploy old are left, they may have been pruned")
+}
+
+func TestRunLogs_InvalidGrep(t *testing.T) {
+	cmd := createTestCommand()
+	assert.NoError(t, cmd.Flags().Set("grep", "("))
+
+	err := runLogs(cmd, statusConfigLoader(""))
+
+	assert.ErrorContains(t, err, "invalid --grep")
+}
+
+func TestRunLogs_NoContainer(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Processes", "memos", "").Return([]docker.Process{}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	cmd := createTestCommand()
+	cmd.Flags().String("tail", "all", "")
+	err := runLogs(cmd, statusConfigLoader(""))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no container of memos is running")
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestLogWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := newLogWriter(&out, regexp.MustCompile("error"), colorRed)
+
+	_, err := w.Write([]byte("ok\nan err"))
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("or\ntrailing error"))
+	assert.NoError(t, err)
+	w.Flush()
+
+	assert.Equal(t, colorRed+"an error"+colorReset+"\n"+colorRed+"trailing error"+colorReset+"\n", out.String())
+}
+
+func TestRunLogs_DockerServiceCreatorFails(t *testing.T) {
+	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{
+			App: config.App{ImageName: "test-image"},
+		}, nil
+	}
+
+	originalDockerServiceCreator := dockerServiceCreator
+	dockerServiceCreator = func(*remote.Host) (DockerService, error) {
+		return nil, errors.New("failed to create Docker service")
+	}
+	defer func() { dockerServiceCreator = originalDockerServiceCreator }()
+
+	cmd := createTestCommand()
+	cmd.Flags().String("tail", "all", "")
+	err := runLogs(cmd, mockConfigLoader)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create Docker service")
+}
+
+func TestRunLogs_ConfigLoaderFails(t *testing.T) {
+	mockConfigLoader := func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{}, errors.New("config loading failed")
+	}
+
+	mockDockerService := new(MockDockerService)
+
+	originalDockerServiceCreator := dockerServiceCreator
+	dockerServiceCreator = func(*remote.Host) (DockerService, error) {
+		return mockDockerService, nil
+	}
+	defer func() { dockerServiceCreator = originalDockerServiceCreator }()
+
+	cmd := createTestCommand()
+	cmd.Flags().String("tail", "all", "")
+	err := runLogs(cmd, mockConfigLoader)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "config loading failed")
+
+	// Ensure that no methods on mockDockerService were called
+	mockDockerService.AssertNotCalled(t, "Processes")
+	mockDockerService.AssertNotCalled(t, "StreamLogs")
+}
@@ -9,20 +9,56 @@ import (
 
 type CommandFunctions struct {
 	RunDeploy       func(cmd *cobra.Command, deployer Deployer, configLoader ConfigLoader) error
-	RunStatus       func() error
+	RunStatus       func(cmd *cobra.Command, configLoader ConfigLoader) error
+	RunHistory      func(cmd *cobra.Command, configLoader ConfigLoader) error
 	RunLogs         func(cmd *cobra.Command, configLoader ConfigLoader) error
 	RunCaddyInspect func(cmd *cobra.Command, configLoader ConfigLoader) error
+	RunWatch        func(cmd *cobra.Command, configLoader ConfigLoader) error
+	RunInit         func(cmd *cobra.Command) error
+	RunReconcile    func(cmd *cobra.Command, configLoader ConfigLoader) error
+	RunDiff         func(cmd *cobra.Command, configLoader ConfigLoader) error
+	RunPrune        func(cmd *cobra.Command, configLoader ConfigLoader) error
+	RunExec         func(cmd *cobra.Command, args []string, configLoader ConfigLoader) error
+	RunShell        func(cmd *cobra.Command, configLoader ConfigLoader) error
+	RunRun          func(cmd *cobra.Command, args []string, configLoader ConfigLoader) error
+	RunStop         func(cmd *cobra.Command, configLoader ConfigLoader) error
+	RunStart        func(cmd *cobra.Command, configLoader ConfigLoader) error
+	RunRestart      func(cmd *cobra.Command, configLoader ConfigLoader) error
+
+	RunAccessoryStart func(cmd *cobra.Command, args []string, configLoader ConfigLoader) error
+	RunAccessoryStop  func(cmd *cobra.Command, args []string, configLoader ConfigLoader) error
+	RunAccessoryLogs  func(cmd *cobra.Command, args []string, configLoader ConfigLoader) error
 }
 
 var cmdFunctions = CommandFunctions{
 	RunDeploy:       runDeploy,
 	RunStatus:       runStatus,
+	RunHistory:      runHistory,
 	RunLogs:         runLogs,
 	RunCaddyInspect: runCaddyInspect,
+	RunWatch:        runWatch,
+	RunInit:         runInit,
+	RunReconcile:    runReconcile,
+	RunDiff:         runDiff,
+	RunPrune:        runPrune,
+	RunExec:         runExec,
+	RunShell:        runShell,
+	RunRun:          runRun,
+	RunStop:         runStop,
+	RunStart:        runStart,
+	RunRestart:      runRestart,
+
+	RunAccessoryStart: runAccessoryStart,
+	RunAccessoryStop:  runAccessoryStop,
+	RunAccessoryLogs:  runAccessoryLogs,
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
+		// The command already reported why it failed.
+		if code, ok := exitCode(err); ok {
+			os.Exit(code)
+		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -32,6 +68,12 @@ var rootCmd = &cobra.Command{
 	Use:   "slick",
 	Short: "Slick is a CLI tool for zero-downtime deployment using Docker and Caddy",
 	Long:  "Slick is designed to simplify your deployment process ensuring zero downtime and easy configuration management.",
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		if err := setupLogging(cmd); err != nil {
+			return err
+		}
+		return setupHost(cmd)
+	},
 }
 
 var deployCmd = &cobra.Command{
@@ -46,16 +88,116 @@ var deployCmd = &cobra.Command{
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Get the status of your application",
-	Long:  "The status command shows the status of your application.",
-	RunE: func(_ *cobra.Command, _ []string) error {
-		return cmdFunctions.RunStatus()
+	Long:  "The status command shows the running containers of your application with their image, port, Docker health and a live probe of the health endpoint, where Caddy sends traffic and the last deploy. It warns when Caddy and Docker disagree.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunStatus(cmd, defaultConfigLoader)
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show what a deploy would change",
+	Long:  "The diff command compares the running container with the config without touching anything: image and digest, env variable names, volumes and network, and a unified diff of the running and the new Caddy config. It is the same as deploy --dry-run.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunDiff(cmd, defaultConfigLoader)
+	},
+}
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Bring containers and Caddy back in line with the last deploy",
+	Long:  "The reconcile command compares the last successful deploy and the config with the running containers and the routes of Caddy, and prints a plan to bring them back in sync. With --apply it redeploys a missing container, points Caddy at the right one and removes orphaned containers.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunReconcile(cmd, defaultConfigLoader)
+	},
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old images and stopped containers of your application",
+	Long:  "The prune command removes the exited containers of your application and the images of its repository that none of the last deploys used, keeping prune.keep_images of them for rollbacks. Accessories are never removed. Set prune.after_deploy to prune after every successful deploy.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunPrune(cmd, defaultConfigLoader)
+	},
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec -- <command> [args...]",
+	Short: "Run a command in the running app container",
+	Long:  "The exec command runs a command in the running container of your application, or of a worker with --service, like 'docker exec -it'. Stdin is passed through, a terminal is allocated when slick runs in one, and slick exits with the exit code of the command.",
+	Args:  cobra.MinimumNArgs(1),
+	// The command reports its own errors, slick only passes on its exit code.
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmdFunctions.RunExec(cmd, args, defaultConfigLoader)
+	},
+}
+
+var shellCmd = &cobra.Command{
+	Use:           "shell",
+	Short:         "Open a shell in the running app container",
+	Long:          "The shell command opens bash, or sh when the image has no bash, in the running container of your application, or of a worker with --service.",
+	Args:          cobra.NoArgs,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunShell(cmd, defaultConfigLoader)
+	},
+}
+
+var runCmd = &cobra.Command{
+	Use:           "run -- <command> [args...]",
+	Short:         "Run a one-off command in a new app container",
+	Long:          "The run command starts a short-lived container from the deployed image with the env, volumes and network of your application, streams its output and removes it once the command exits. It takes no traffic and is not recorded as a deploy. slick exits with the exit code of the command.",
+	Args:          cobra.MinimumNArgs(1),
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmdFunctions.RunRun(cmd, args, defaultConfigLoader)
+	},
+}
+
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop your application",
+	Long:  "The stop command makes Caddy answer the domains of your application with a 503 maintenance response and stops its web and worker containers. Accessories keep running. The app stays down, also for slick watch and slick reconcile, until slick start or the next deploy.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunStop(cmd, defaultConfigLoader)
+	},
+}
+
+var startCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start your application again after slick stop",
+	Long:  "The start command deploys the image of the last successful deploy again, which brings a stopped application back and points Caddy at it once it is healthy. It leaves a running application alone.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunStart(cmd, defaultConfigLoader)
+	},
+}
+
+var restartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Replace the containers of your application with zero downtime",
+	Long:  "The restart command deploys the image of the last successful deploy again: fresh containers take the traffic once they are healthy and the old ones are stopped, like a deploy.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunRestart(cmd, defaultConfigLoader)
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show past deployments of your application",
+	Long:  "The history command lists the recorded deployments of your application, newest first.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunHistory(cmd, defaultConfigLoader)
 	},
 }
 
 var logsCmd = &cobra.Command{
 	Use:   "logs",
 	Short: "Tail and follow app logs",
-	Long:  "The logs command shows the logs output of your application. It is similar to running 'docker logs -f <container-id>'",
+	Long:  "The logs command follows the logs of the running containers of your application and its workers, like 'docker compose logs -f'. With several containers every line is prefixed with the container it came from. Lines written to stderr are shown in red on a terminal. The logs keep following the new containers when a deploy replaces them. With --deployment it shows the logs of the stopped containers of a past deploy instead.",
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		return cmdFunctions.RunLogs(cmd, defaultConfigLoader)
 	},
@@ -70,14 +212,121 @@ var caddyInspectCmd = &cobra.Command{
 	},
 }
 
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Monitor the health of your application",
+	Long:  "The watch command keeps checking the health of the running container and restarts or redeploys it after repeated failures.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunWatch(cmd, defaultConfigLoader)
+	},
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a config file for your application",
+	Long:  "The init command asks a few questions and writes a commented slick config file. With --from-compose it translates a service of a Docker Compose file instead and reports the features that could not be mapped.",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmdFunctions.RunInit(cmd)
+	},
+}
+
+var accessoryCmd = &cobra.Command{
+	Use:   "accessory",
+	Short: "Manage the accessories of your application",
+	Long:  "The accessory commands manage long-lived services like databases that run next to your application and are kept across deploys.",
+}
+
+var accessoryStartCmd = &cobra.Command{
+	Use:   "start [name]",
+	Short: "Start accessories",
+	Long:  "The accessory start command starts the named accessory, or all of them when no name is given.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmdFunctions.RunAccessoryStart(cmd, args, defaultConfigLoader)
+	},
+}
+
+var accessoryStopCmd = &cobra.Command{
+	Use:   "stop [name]",
+	Short: "Stop accessories",
+	Long:  "The accessory stop command stops the named accessory, or all of them when no name is given. The containers are kept so their state survives a restart.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmdFunctions.RunAccessoryStop(cmd, args, defaultConfigLoader)
+	},
+}
+
+var accessoryLogsCmd = &cobra.Command{
+	Use:   "logs <name>",
+	Short: "Tail and follow accessory logs",
+	Long:  "The accessory logs command shows the logs output of an accessory.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmdFunctions.RunAccessoryLogs(cmd, args, defaultConfigLoader)
+	},
+}
+
 func init() {
 	rootCmd.PersistentFlags().StringP("config", "c", "slick.yml", "Path to the configuration file")
 	rootCmd.PersistentFlags().StringP("env", "e", ".env", "Path to the env file")
+	rootCmd.PersistentFlags().String("log-format", "text", "Log format, text or json")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only log warnings and errors")
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Log debug output")
+	rootCmd.PersistentFlags().StringP("output", "o", "text", "Output format for command results, text or json")
+	rootCmd.PersistentFlags().StringP("host", "H", "", "Server to work on over SSH, ssh://[user@]host[:port], defaults to $SLICK_HOST or the local Docker daemon")
 
 	rootCmd.AddCommand(deployCmd)
 	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(reconcileCmd)
+	rootCmd.AddCommand(pruneCmd)
+	rootCmd.AddCommand(historyCmd)
 	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(shellCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(stopCmd)
+	rootCmd.AddCommand(startCmd)
+	rootCmd.AddCommand(restartCmd)
 	rootCmd.AddCommand(caddyInspectCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(accessoryCmd)
+	rootCmd.AddCommand(initCmd)
+
+	accessoryCmd.AddCommand(accessoryStartCmd)
+	accessoryCmd.AddCommand(accessoryStopCmd)
+	accessoryCmd.AddCommand(accessoryLogsCmd)
 
-	logsCmd.Flags().StringP("tail", "t", "all", "Tail logs")
+	deployCmd.Flags().Duration("timeout", 0, "Abort and roll back the deploy if it takes longer than this, e.g. 5m")
+	deployCmd.Flags().String("git-sha", "", "Git commit being deployed, defaults to $SLICK_GIT_SHA, $GITHUB_SHA or $CI_COMMIT_SHA")
+	deployCmd.Flags().String("deployer", "", "Who or what is deploying, defaults to $SLICK_DEPLOYER or the current user")
+	deployCmd.Flags().Bool("wait", false, "Wait for a running deploy of the app to finish instead of failing")
+	deployCmd.Flags().Bool("force-unlock", false, "Remove the deploy lock of the app before deploying")
+	deployCmd.Flags().Bool("dry-run", false, "Show what the deploy would change without deploying, like slick diff")
+	deployCmd.Flags().Int("parallel", 1, "How many servers to deploy to at once, overrides fleet.parallelism")
+	deployCmd.Flags().String("on-failure", "rollback", "What to do when a server fails: rollback, abort or continue, overrides fleet.on_failure")
+	reconcileCmd.Flags().Bool("apply", false, "Make the changes of the plan instead of only printing it")
+	pruneCmd.Flags().Int("keep", 0, "How many of the last deployed images to keep, overrides prune.keep_images")
+	pruneCmd.Flags().Bool("dry-run", false, "Show what would be removed without removing anything")
+	pruneCmd.Flags().Bool("wait", false, "Wait for a running deploy of the app to finish instead of failing")
+	pruneCmd.Flags().Bool("force-unlock", false, "Remove the deploy lock of the app before pruning")
+	stopCmd.Flags().String("message", defaultMaintenanceMessage, "Response Caddy serves while the app is stopped")
+	for _, c := range []*cobra.Command{stopCmd, startCmd, restartCmd} {
+		c.Flags().Bool("wait", false, "Wait for a running deploy of the app to finish instead of failing")
+		c.Flags().Bool("force-unlock", false, "Remove the deploy lock of the app first")
+	}
+	watchCmd.Flags().Bool("json", false, "Emit events as JSON lines on stdout")
+	_ = watchCmd.Flags().MarkDeprecated("json", "use --output json instead")
+	addLogFlags(logsCmd)
+	logsCmd.Flags().String("deployment", "", "Show the logs of the containers of a past deploy, by its id from slick history")
+	for _, c := range []*cobra.Command{execCmd, shellCmd} {
+		c.Flags().String("service", "web", "Container to run in, web for the app or the name of a worker")
+		c.Flags().BoolP("no-tty", "T", false, "Do not allocate a terminal, for scripts")
+	}
+	initCmd.Flags().String("from-compose", "", "Docker Compose file to translate, e.g. docker-compose.yml")
+	initCmd.Flags().String("service", "", "Compose service to deploy as the app, the others become accessories")
+	initCmd.Flags().String("domain", "", "Domain Caddy serves the app on, defaults to <service>.localhost")
+	initCmd.Flags().Bool("force", false, "Overwrite an existing config file")
+	initCmd.Flags().Bool("probe", false, "Pull the image to suggest the container port from the ports it exposes")
+	addLogFlags(accessoryLogsCmd)
 }
@@ -26,7 +26,7 @@ func TestStatusCmd_RunE(t *testing.T) {
 	oldCmdFunctions := cmdFunctions
 	defer func() { cmdFunctions = oldCmdFunctions }()
 
-	cmdFunctions.RunStatus = func() error {
+	cmdFunctions.RunStatus = func(cmd *cobra.Command, configLoader ConfigLoader) error {
 		return nil // Simulate successful status check
 	}
 
@@ -36,6 +36,20 @@ func TestStatusCmd_RunE(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestHistoryCmd_RunE(t *testing.T) {
+	oldCmdFunctions := cmdFunctions
+	defer func() { cmdFunctions = oldCmdFunctions }()
+
+	cmdFunctions.RunHistory = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+		return nil // Simulate successful history listing
+	}
+
+	cmd := &cobra.Command{}
+	err := historyCmd.RunE(cmd, []string{})
+
+	assert.NoError(t, err)
+}
+
 func TestLogsCmd_RunE(t *testing.T) {
 	oldCmdFunctions := cmdFunctions
 	defer func() { cmdFunctions = oldCmdFunctions }()
@@ -64,6 +78,121 @@ func TestCaddyInspectCmd_RunE(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestWatchCmd_RunE(t *testing.T) {
+	oldCmdFunctions := cmdFunctions
+	defer func() { cmdFunctions = oldCmdFunctions }()
+
+	cmdFunctions.RunWatch = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+		return nil // Simulate watch exiting cleanly
+	}
+
+	cmd := &cobra.Command{}
+	err := watchCmd.RunE(cmd, []string{})
+
+	assert.NoError(t, err)
+}
+
+func TestReconcileCmd_RunE(t *testing.T) {
+	oldCmdFunctions := cmdFunctions
+	defer func() { cmdFunctions = oldCmdFunctions }()
+
+	cmdFunctions.RunReconcile = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+		return nil // Simulate a reconcile with nothing to do
+	}
+
+	cmd := &cobra.Command{}
+	err := reconcileCmd.RunE(cmd, []string{})
+
+	assert.NoError(t, err)
+}
+
+func TestPruneCmd_RunE(t *testing.T) {
+	oldCmdFunctions := cmdFunctions
+	defer func() { cmdFunctions = oldCmdFunctions }()
+
+	cmdFunctions.RunPrune = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+		return nil // Simulate a prune with nothing to remove
+	}
+
+	cmd := &cobra.Command{}
+	err := pruneCmd.RunE(cmd, []string{})
+
+	assert.NoError(t, err)
+}
+
+func TestExecCmd_RunE(t *testing.T) {
+	oldCmdFunctions := cmdFunctions
+	defer func() { cmdFunctions = oldCmdFunctions }()
+
+	var got []string
+	cmdFunctions.RunExec = func(cmd *cobra.Command, args []string, configLoader ConfigLoader) error {
+		got = args
+		return nil
+	}
+
+	cmd := &cobra.Command{}
+	err := execCmd.RunE(cmd, []string{"rake", "db:migrate"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rake", "db:migrate"}, got)
+}
+
+func TestShellCmd_RunE(t *testing.T) {
+	oldCmdFunctions := cmdFunctions
+	defer func() { cmdFunctions = oldCmdFunctions }()
+
+	cmdFunctions.RunShell = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+		return nil
+	}
+
+	cmd := &cobra.Command{}
+	err := shellCmd.RunE(cmd, []string{})
+
+	assert.NoError(t, err)
+}
+
+func TestRunCmd_RunE(t *testing.T) {
+	oldCmdFunctions := cmdFunctions
+	defer func() { cmdFunctions = oldCmdFunctions }()
+
+	var got []string
+	cmdFunctions.RunRun = func(cmd *cobra.Command, args []string, configLoader ConfigLoader) error {
+		got = args
+		return nil
+	}
+
+	cmd := &cobra.Command{}
+	err := runCmd.RunE(cmd, []string{"rake", "db:seed"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rake", "db:seed"}, got)
+}
+
+func TestLifecycleCmds_RunE(t *testing.T) {
+	oldCmdFunctions := cmdFunctions
+	defer func() { cmdFunctions = oldCmdFunctions }()
+
+	var called []string
+	cmdFunctions.RunStop = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+		called = append(called, "stop")
+		return nil
+	}
+	cmdFunctions.RunStart = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+		called = append(called, "start")
+		return nil
+	}
+	cmdFunctions.RunRestart = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+		called = append(called, "restart")
+		return nil
+	}
+
+	for _, c := range []*cobra.Command{stopCmd, startCmd, restartCmd} {
+		assert.NoError(t, c.RunE(&cobra.Command{}, []string{}))
+	}
+
+	assert.Equal(t, []string{"stop", "start", "restart"}, called)
+}
+
 func TestCommands_RunE_Error(t *testing.T) {
 	testCases := []struct {
 		name    string
@@ -83,7 +212,7 @@ func TestCommands_RunE_Error(t *testing.T) {
 			name: "Status Error",
 			cmd:  statusCmd,
 			setupFn: func() {
-				cmdFunctions.RunStatus = func() error {
+				cmdFunctions.RunStatus = func(cmd *cobra.Command, configLoader ConfigLoader) error {
 					return errors.New("status error")
 				}
 			},
@@ -106,6 +235,24 @@ func TestCommands_RunE_Error(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "History Error",
+			cmd:  historyCmd,
+			setupFn: func() {
+				cmdFunctions.RunHistory = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+					return errors.New("history error")
+				}
+			},
+		},
+		{
+			name: "Watch Error",
+			cmd:  watchCmd,
+			setupFn: func() {
+				cmdFunctions.RunWatch = func(cmd *cobra.Command, configLoader ConfigLoader) error {
+					return errors.New("watch error")
+				}
+			},
+		},
 	}
 
 	for _, tc := range testCases {
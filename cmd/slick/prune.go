@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/deploy"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+// pruneResult is what slick prune removed from one server.
+type pruneResult struct {
+	App    string `json:"app"`
+	Server string `json:"server"`
+	DryRun bool   `json:"dry_run"`
+	docker.PruneReport
+}
+
+func runPrune(cmd *cobra.Command, configLoader ConfigLoader) error {
+	output, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	keep, _ := cmd.Flags().GetInt("keep")
+	if keep == 0 {
+		keep = cfg.Prune.KeepImages
+	}
+	if keep < 1 {
+		return fmt.Errorf("invalid --keep %d, expected at least 1", keep)
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	hosts, err := statusHosts(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	// A deploy running next to the prune could lose its freshly pulled image.
+	if !dryRun {
+		lock, err := lockDeploy(ctx, cmd, cfg.App.Name, hosts)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
+
+	results := make([]pruneResult, 0, len(hosts))
+	for _, host := range hosts {
+		result, err := pruneOn(ctx, cfg, host, keep, dryRun)
+		if err != nil {
+			return fmt.Errorf("error pruning %s: %w", serverName(host), err)
+		}
+		results = append(results, result)
+	}
+
+	if output == outputJSON {
+		return writeJSON(os.Stdout, results)
+	}
+
+	for _, result := range results {
+		if len(result.Containers)+len(result.Images) == 0 {
+			slog.Info(fmt.Sprintf("Nothing to prune for %s on %s", result.App, result.Server))
+			continue
+		}
+		if err := printPrune(os.Stdout, result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneOn removes the exited containers and the images of the app on host
+// that are older than the last keep deploys there.
+func pruneOn(ctx context.Context, cfg config.DeploymentConfig, host *remote.Host, keep int, dryRun bool) (pruneResult, error) {
+	result := pruneResult{App: cfg.App.Name, Server: serverName(host), DryRun: dryRun}
+
+	opts, err := deploy.PruneOptions(stateStoreCreator(), cfg, host.Name(), keep)
+	if err != nil {
+		return result, err
+	}
+	opts.DryRun = dryRun
+
+	dockerService, _, err := dockerServiceOn(host)
+	if err != nil {
+		return result, err
+	}
+
+	result.PruneReport, err = dockerService.Prune(ctx, cfg.App.Name, opts)
+	return result, err
+}
+
+func printPrune(out io.Writer, result pruneResult) error {
+	verb, reclaimed := "Pruned", "Reclaimed"
+	if result.DryRun {
+		verb, reclaimed = "Would prune", "Would reclaim"
+	}
+	fmt.Fprintf(out, "%s %s on %s:\n", verb, result.App, result.Server)
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	for _, name := range result.Containers {
+		fmt.Fprintf(w, "  container\t%s\n", name)
+	}
+	for _, name := range result.Images {
+		fmt.Fprintf(w, "  image\t%s\n", name)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s %s\n", reclaimed, units.HumanSize(float64(result.SpaceReclaimed)))
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func pruneConfigLoader(cmd *cobra.Command) (config.DeploymentConfig, error) {
+	return config.DeploymentConfig{
+		App:   config.App{Name: "memos", ImageName: "memos:4"},
+		Prune: config.PruneConfig{KeepImages: 2},
+	}, nil
+}
+
+func TestRunPrune(t *testing.T) {
+	store := useTempStateStore(t)
+	for i, image := range []string{"memos:1", "memos:2", "memos:3"} {
+		assert.NoError(t, store.Record(state.Deployment{ID: fmt.Sprint(i), App: "memos", Image: image, Status: state.StatusSucceeded}))
+	}
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Prune", "memos", docker.PruneOptions{Keep: []string{"memos:3", "memos:2", "memos:4"}, KeepDeploys: []string{"2", "1"}}).Return(docker.PruneReport{
+		Containers:     []string{"memos-old"},
+		Images:         []string{"memos:1"},
+		SpaceReclaimed: 2048,
+	}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	var err error
+	output := captureStdout(t, func() {
+		err = runPrune(createTestCommand(), pruneConfigLoader)
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Pruned memos on local:\n")
+	assert.Regexp(t, `container\s+memos-old\n`, output)
+	assert.Regexp(t, `image\s+memos:1\n`, output)
+	assert.Contains(t, output, "Reclaimed 2.048kB\n")
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunPrune_DryRunKeep(t *testing.T) {
+	store := useTempStateStore(t)
+	assert.NoError(t, store.Record(state.Deployment{ID: "1", App: "memos", Image: "memos:3", Status: state.StatusSucceeded}))
+	assert.NoError(t, store.Record(state.Deployment{ID: "2", App: "memos", Image: "memos:2", Status: state.StatusSucceeded}))
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("Prune", "memos", docker.PruneOptions{Keep: []string{"memos:2", "memos:4"}, KeepDeploys: []string{"2"}, DryRun: true}).Return(docker.PruneReport{}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	cmd := createTestCommand()
+	assert.NoError(t, cmd.Flags().Set("keep", "1"))
+	assert.NoError(t, cmd.Flags().Set("dry-run", "true"))
+	lock, err := store.Lock("memos", "")
+	assert.NoError(t, err)
+	defer lock.Unlock()
+
+	// A dry run does not need the deploy lock.
+	err = runPrune(cmd, pruneConfigLoader)
+	assert.NoError(t, err)
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunPrune_Locked(t *testing.T) {
+	store := useTempStateStore(t)
+	lock, err := store.Lock("memos", "")
+	assert.NoError(t, err)
+	defer lock.Unlock()
+
+	mockDockerService := new(MockDockerService)
+	useMockDockerService(t, mockDockerService)
+
+	err = runPrune(createTestCommand(), pruneConfigLoader)
+	assert.ErrorContains(t, err, "use --wait")
+	mockDockerService.AssertNotCalled(t, "Prune", mock.Anything, mock.Anything)
+}
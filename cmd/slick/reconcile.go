@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/scmmishra/slick-deploy/internal/caddy"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/deploy"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// Changes slick reconcile makes to bring a server back to the last deploy.
+const (
+	actionRedeploy = "redeploy"
+	actionRoute    = "route"
+	actionRemove   = "remove"
+)
+
+// reconcileAction is a single change of a reconcile plan.
+type reconcileAction struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+
+	// image is redeployed, container is routed to or removed.
+	image     string
+	container docker.AppContainer
+}
+
+// reconcilePlan lists the changes that bring the app on one server back to
+// its last successful deploy.
+type reconcilePlan struct {
+	App     string            `json:"app"`
+	Server  string            `json:"server"`
+	Actions []reconcileAction `json:"actions"`
+	Applied bool              `json:"applied"`
+	// Stopped is set for an app stopped with slick stop, which is left
+	// alone until slick start.
+	Stopped bool `json:"stopped,omitempty"`
+
+	host          *remote.Host
+	dockerService DockerService
+	transport     http.RoundTripper
+}
+
+func runReconcile(cmd *cobra.Command, configLoader ConfigLoader) error {
+	output, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	hosts, err := statusHosts(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	// Hold the lock from planning on, so no deploy changes the containers
+	// between the plan and its apply.
+	apply, _ := cmd.Flags().GetBool("apply")
+	if apply {
+		lock, err := lockDeploy(ctx, cmd, cfg.App.Name, hosts)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	}
+
+	plans := make([]reconcilePlan, 0, len(hosts))
+	changes := 0
+	for _, host := range hosts {
+		plan, err := planReconcileOn(ctx, cfg, host)
+		if err != nil {
+			return fmt.Errorf("error planning reconcile on %s: %w", serverName(host), err)
+		}
+		plans = append(plans, plan)
+		changes += len(plan.Actions)
+	}
+
+	if apply && changes > 0 {
+		for i := range plans {
+			if err := applyReconcile(ctx, cfg, &plans[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if output == outputJSON {
+		return writeJSON(os.Stdout, plans)
+	}
+
+	printed := false
+	for _, plan := range plans {
+		if plan.Stopped {
+			slog.Info(fmt.Sprintf("%s is stopped on %s, run slick start to bring it back", plan.App, plan.Server))
+			continue
+		}
+		if len(plan.Actions) == 0 {
+			slog.Info(fmt.Sprintf("%s is in sync on %s", plan.App, plan.Server))
+			continue
+		}
+		if apply {
+			continue
+		}
+		if printed {
+			fmt.Println()
+		}
+		if err := printPlan(os.Stdout, plan); err != nil {
+			return err
+		}
+		printed = true
+	}
+	if !apply && changes > 0 {
+		slog.Info("Run slick reconcile --apply to make these changes")
+	}
+
+	return nil
+}
+
+// planReconcileOn compares the last successful deploy of the app on host
+// with the containers running there and the routes of Caddy.
+func planReconcileOn(ctx context.Context, cfg config.DeploymentConfig, host *remote.Host) (reconcilePlan, error) {
+	plan := reconcilePlan{
+		App:     cfg.App.Name,
+		Server:  serverName(host),
+		Actions: []reconcileAction{},
+		host:    host,
+	}
+
+	stopped, err := stateStoreCreator().StoppedOn(cfg.App.Name, host.Name())
+	if err != nil {
+		return plan, err
+	}
+	if stopped != nil {
+		plan.Stopped = true
+		return plan, nil
+	}
+
+	dockerService, transport, err := dockerServiceOn(host)
+	if err != nil {
+		return plan, err
+	}
+	plan.dockerService = dockerService
+	plan.transport = transport
+
+	containers, err := dockerService.AppContainers(ctx, cfg.App.Name)
+	if err != nil {
+		return plan, fmt.Errorf("error listing containers of %s: %w", cfg.App.Name, err)
+	}
+
+	upstreams, err := caddyUpstreams(ctx, cfg, transport)
+	if err != nil {
+		return plan, fmt.Errorf("unable to read the upstreams from Caddy: %w", err)
+	}
+
+	last, err := stateStoreCreator().LastSuccessfulOn(cfg.App.Name, host.Name())
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Actions = planReconcile(cfg, containers, upstreams, last)
+	return plan, nil
+}
+
+// planReconcile returns the actions that make containers and upstreams
+// match the last successful deploy. Without a record of it, the container
+// Caddy routes to, or else the newest one, is kept.
+func planReconcile(cfg config.DeploymentConfig, containers []docker.AppContainer, upstreams []string, last *state.Deployment) []reconcileAction {
+	actions := []reconcileAction{}
+
+	desired := -1
+	reason := ""
+	if last != nil && last.ContainerID != "" {
+		reason = "not part of deploy " + last.ID
+		for i, c := range containers {
+			if sameContainer(c.ID, last.ContainerID) {
+				desired = i
+			}
+		}
+
+		if desired < 0 {
+			actions = append(actions, reconcileAction{
+				Action: actionRedeploy,
+				Target: last.Image,
+				Reason: fmt.Sprintf("the container of deploy %s is not running", last.ID),
+				image:  last.Image,
+			})
+			for _, c := range containers {
+				actions = append(actions, removeAction(c, reason))
+			}
+			return actions
+		}
+	} else {
+		if len(containers) == 0 {
+			return actions
+		}
+		desired = 0
+		for i, c := range containers {
+			if containsAll(upstreams, expectedUpstreams(cfg.Caddy, c.Container)) {
+				desired = i
+				break
+			}
+		}
+		reason = "not the container Caddy routes to"
+	}
+
+	keep := containers[desired]
+	expected := expectedUpstreams(cfg.Caddy, keep.Container)
+	if !sameUpstreams(expected, upstreams) {
+		routeReason := "Caddy has no route to it"
+		if len(upstreams) > 0 {
+			routeReason = "Caddy sends traffic to " + strings.Join(upstreams, ", ")
+		}
+		actions = append(actions, reconcileAction{
+			Action:    actionRoute,
+			Target:    keep.Name,
+			Reason:    routeReason,
+			container: keep,
+		})
+	}
+
+	for i, c := range containers {
+		if i != desired {
+			actions = append(actions, removeAction(c, reason))
+		}
+	}
+
+	return actions
+}
+
+func removeAction(c docker.AppContainer, reason string) reconcileAction {
+	return reconcileAction{
+		Action:    actionRemove,
+		Target:    c.Name,
+		Reason:    reason,
+		container: c,
+	}
+}
+
+// sameContainer compares container IDs that may be abbreviated.
+func sameContainer(a, b string) bool {
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sameUpstreams(expected, upstreams []string) bool {
+	a := map[string]bool{}
+	for _, upstream := range expected {
+		a[upstream] = true
+	}
+	b := map[string]bool{}
+	for _, upstream := range upstreams {
+		b[upstream] = true
+	}
+	if len(a) != len(b) {
+		return false
+	}
+	for upstream := range a {
+		if !b[upstream] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyReconcile makes the changes of plan. Redeploys go through the
+// regular deploy, which also switches Caddy over.
+func applyReconcile(ctx context.Context, cfg config.DeploymentConfig, plan *reconcilePlan) error {
+	for _, action := range plan.Actions {
+		slog.Info(fmt.Sprintf("Reconciling: %s %s", action.Action, action.Target), "app", plan.App, "server", plan.Server, "reason", action.Reason)
+
+		switch action.Action {
+		case actionRedeploy:
+			redeployCfg := cfg
+			redeployCfg.App.ImageName = action.image
+			opts := deploy.Options{Deployer: "slick reconcile", Host: plan.host}
+			if err := defaultDeployer.Deploy(ctx, redeployCfg, opts); err != nil {
+				return fmt.Errorf("error redeploying %s: %w", action.image, err)
+			}
+
+		case actionRoute:
+			upstream := caddy.Upstream{Host: action.container.Alias, Port: action.container.Port}
+			if upstream.Host == "" {
+				upstream.Host = action.container.IP
+			}
+			client := &caddy.CaddyClient{
+				BaseURL:    cfg.Caddy.AdminAPI,
+				HTTPClient: &http.Client{Transport: plan.transport},
+				Logger:     slog.Default(),
+			}
+			if err := caddy.SetupCaddyWithClient(ctx, client, upstream, cfg); err != nil {
+				return fmt.Errorf("error pointing Caddy at %s: %w", action.Target, err)
+			}
+
+		case actionRemove:
+			// A redeploy may already have removed the container.
+			err := plan.dockerService.StopContainer(ctx, action.container.ID)
+			if err != nil && !errdefs.IsNotFound(err) {
+				return fmt.Errorf("error removing %s: %w", action.Target, err)
+			}
+		}
+	}
+
+	plan.Applied = true
+	slog.Info(fmt.Sprintf("Reconciled %s on %s", plan.App, plan.Server), "changes", len(plan.Actions))
+	return nil
+}
+
+func printPlan(out io.Writer, plan reconcilePlan) error {
+	fmt.Fprintf(out, "Plan for %s on %s:\n", plan.App, plan.Server)
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tTARGET\tREASON")
+	for _, action := range plan.Actions {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", action.Action, action.Target, action.Reason)
+	}
+	return w.Flush()
+}
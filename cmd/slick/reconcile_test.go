@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/deploy"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// reconcileCaddy fakes the Caddy admin API, reporting upstreams and
+// recording the Caddyfiles loaded into it.
+func reconcileCaddy(t *testing.T, upstreams ...string) (string, *[]string) {
+	var loaded []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/load":
+			body, _ := io.ReadAll(req.Body)
+			loaded = append(loaded, string(body))
+		case "/reverse_proxy/upstreams":
+			body := []map[string]any{}
+			for _, upstream := range upstreams {
+				body = append(body, map[string]any{"address": upstream})
+			}
+			_ = json.NewEncoder(rw).Encode(body)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &loaded
+}
+
+func runReconcileCommand(t *testing.T, apply bool, configLoader ConfigLoader) (string, error) {
+	cmd := createTestCommand()
+	cmd.Flags().Bool("apply", apply, "")
+	var err error
+	output := captureStdout(t, func() {
+		err = runReconcile(cmd, configLoader)
+	})
+	return output, err
+}
+
+func TestPlanReconcile(t *testing.T) {
+	cfg, _ := statusConfigLoader("")(nil)
+	current := docker.AppContainer{Container: docker.Container{ID: "abc123", Port: 8002, IP: "127.0.0.1"}, Name: "memos-second"}
+	stale := docker.AppContainer{Container: docker.Container{ID: "def456", Port: 8001, IP: "127.0.0.1"}, Name: "memos-first"}
+	last := &state.Deployment{ID: "second", Image: "example/image:v2", ContainerID: "abc", Status: state.StatusSucceeded}
+
+	tests := []struct {
+		name       string
+		containers []docker.AppContainer
+		upstreams  []string
+		last       *state.Deployment
+		want       []string
+	}{
+		{
+			name:       "in sync",
+			containers: []docker.AppContainer{current},
+			upstreams:  []string{"localhost:8002"},
+			last:       last,
+			want:       []string{},
+		},
+		{
+			name:       "caddy restarted",
+			containers: []docker.AppContainer{current},
+			upstreams:  []string{},
+			last:       last,
+			want:       []string{"route memos-second: Caddy has no route to it"},
+		},
+		{
+			name:       "orphan still routed",
+			containers: []docker.AppContainer{current, stale},
+			upstreams:  []string{"localhost:8001"},
+			last:       last,
+			want: []string{
+				"route memos-second: Caddy sends traffic to localhost:8001",
+				"remove memos-first: not part of deploy second",
+			},
+		},
+		{
+			name:       "container removed",
+			containers: []docker.AppContainer{stale},
+			upstreams:  []string{"localhost:8002"},
+			last:       last,
+			want: []string{
+				"redeploy example/image:v2: the container of deploy second is not running",
+				"remove memos-first: not part of deploy second",
+			},
+		},
+		{
+			name:       "no deploy record",
+			containers: []docker.AppContainer{current, stale},
+			upstreams:  []string{"localhost:8001"},
+			want:       []string{"remove memos-second: not the container Caddy routes to"},
+		},
+		{
+			name: "nothing deployed",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, action := range planReconcile(cfg, tt.containers, tt.upstreams, tt.last) {
+				got = append(got, action.Action+" "+action.Target+": "+action.Reason)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunReconcile_Plan(t *testing.T) {
+	store := useTempStateStore(t)
+	adminAPI, loaded := reconcileCaddy(t)
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{
+		{Container: docker.Container{ID: "abc123", Port: 8002, IP: "127.0.0.1"}, Name: "memos-second"},
+	}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", ContainerID: "abc123", Status: state.StatusSucceeded}))
+
+	output, err := runReconcileCommand(t, false, statusConfigLoader(adminAPI))
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Plan for memos on local:")
+	assert.Regexp(t, `route\s+memos-second\s+Caddy has no route to it`, output)
+	assert.Empty(t, *loaded)
+	mockDockerService.AssertNotCalled(t, "StopContainer", mock.Anything)
+}
+
+func TestRunReconcile_Apply(t *testing.T) {
+	store := useTempStateStore(t)
+	adminAPI, loaded := reconcileCaddy(t, "localhost:8001")
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{
+		{Container: docker.Container{ID: "abc123", Port: 8002, IP: "127.0.0.1"}, Name: "memos-second"},
+		{Container: docker.Container{ID: "def456", Port: 8001, IP: "127.0.0.1"}, Name: "memos-first"},
+	}, nil)
+	mockDockerService.On("StopContainer", "def456").Return(nil)
+	useMockDockerService(t, mockDockerService)
+
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", ContainerID: "abc123", Status: state.StatusSucceeded}))
+
+	_, err := runReconcileCommand(t, true, statusConfigLoader(adminAPI))
+	assert.NoError(t, err)
+	if assert.Len(t, *loaded, 1) {
+		assert.Contains(t, (*loaded)[0], "reverse_proxy  localhost:8002")
+	}
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunReconcile_ApplyRedeploy(t *testing.T) {
+	store := useTempStateStore(t)
+	adminAPI, _ := reconcileCaddy(t, "localhost:8002")
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	mockDeployer := new(MockDeployer)
+	mockDeployer.On("Deploy", mock.Anything, mock.MatchedBy(func(cfg config.DeploymentConfig) bool {
+		return cfg.App.ImageName == "example/image:v2"
+	}), deploy.Options{Deployer: "slick reconcile"}).Return(nil)
+	originalDeployer := defaultDeployer
+	defaultDeployer = mockDeployer
+	defer func() { defaultDeployer = originalDeployer }()
+
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", Image: "example/image:v2", ContainerID: "abc123", Status: state.StatusSucceeded}))
+
+	output, err := runReconcileCommand(t, true, statusConfigLoader(adminAPI))
+	assert.NoError(t, err)
+	assert.Empty(t, output)
+	mockDeployer.AssertExpectations(t)
+}
+
+func TestRunReconcile_ApplyLocked(t *testing.T) {
+	store := useTempStateStore(t)
+	lock, err := store.Lock("memos", "")
+	require.NoError(t, err)
+	defer lock.Unlock()
+
+	mockDockerService := new(MockDockerService)
+	useMockDockerService(t, mockDockerService)
+
+	_, err = runReconcileCommand(t, true, statusConfigLoader("http://127.0.0.1:1"))
+	assert.ErrorContains(t, err, "use --wait")
+	mockDockerService.AssertNotCalled(t, "AppContainers", mock.Anything, mock.Anything)
+}
+
+func TestRunReconcile_CaddyUnreachable(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	_, err := runReconcileCommand(t, false, statusConfigLoader("http://127.0.0.1:1"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to read the upstreams from Caddy")
+}
+
+func TestRunReconcile_Stopped(t *testing.T) {
+	store := useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	useMockDockerService(t, mockDockerService)
+
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", ContainerID: "abc123", Status: state.StatusSucceeded}))
+	assert.NoError(t, store.Record(state.Deployment{ID: "third", App: "memos", Status: state.StatusStopped}))
+
+	output, err := runReconcileCommand(t, true, statusConfigLoader("http://127.0.0.1:1"))
+	assert.NoError(t, err)
+	assert.Empty(t, output)
+	mockDockerService.AssertNotCalled(t, "AppContainers", mock.Anything)
+}
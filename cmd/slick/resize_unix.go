@@ -0,0 +1,45 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/moby/term"
+)
+
+// watchResize sends the size of the terminal fd every time it changes,
+// until stop is called.
+func watchResize(fd uintptr) (sizes <-chan [2]uint, stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+
+	out := make(chan [2]uint, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				size, err := term.GetWinsize(fd)
+				if err != nil {
+					continue
+				}
+				select {
+				case out <- [2]uint{uint(size.Height), uint(size.Width)}:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return out, func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
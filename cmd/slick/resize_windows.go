@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+// watchResize does nothing on Windows, which has no SIGWINCH. The terminal
+// keeps the size it started with.
+func watchResize(uintptr) (sizes <-chan [2]uint, stop func()) {
+	return nil, func() {}
+}
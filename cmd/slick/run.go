@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func runRun(cmd *cobra.Command, args []string, configLoader ConfigLoader) error {
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	dockerService, err := dockerServiceCreator(targetHost)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	image := deployedImage(cfg)
+	slog.Debug("Running one-off container", "image", image)
+
+	code, err := dockerService.RunOneOff(ctx, image, cfg.App, args, os.Stdout, os.Stderr)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return &exitCodeError{code: code}
+	}
+	return nil
+}
+
+// deployedImage returns the image of the last successful deploy on the
+// target host, or the image of the config before the first deploy.
+func deployedImage(cfg config.DeploymentConfig) string {
+	last, err := stateStoreCreator().LastSuccessfulOn(cfg.App.Name, targetHost.Name())
+	if err == nil && last != nil && last.Image != "" {
+		return last.Image
+	}
+	return cfg.App.ImageName
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRunRun(t *testing.T) {
+	store := useTempStateStore(t)
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", Image: "example/image:v2", Status: state.StatusSucceeded}))
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("RunOneOff", "example/image:v2", []string{"rake", "db:seed"}).Return(0, nil)
+	useMockDockerService(t, mockDockerService)
+
+	err := runRun(createTestCommand(), []string{"rake", "db:seed"}, statusConfigLoader(""))
+
+	assert.NoError(t, err)
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunRun_ExitCode(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	// Before the first deploy the image of the config is used.
+	mockDockerService.On("RunOneOff", mock.Anything, []string{"false"}).Return(2, nil)
+	useMockDockerService(t, mockDockerService)
+
+	err := runRun(createTestCommand(), []string{"false"}, statusConfigLoader(""))
+
+	code, ok := exitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, code)
+}
+
+func TestRunRun_Error(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("RunOneOff", mock.Anything, []string{"true"}).Return(-1, errors.New("no such image"))
+	useMockDockerService(t, mockDockerService)
+
+	err := runRun(createTestCommand(), []string{"true"}, statusConfigLoader(""))
+
+	assert.EqualError(t, err, "no such image")
+	_, ok := exitCode(err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+)
+
+// scaffold holds the answers used to generate a new config.
+type scaffold struct {
+	Name           string
+	Image          string
+	Port           int
+	Domains        []string
+	HealthEndpoint string
+	OnDemandTLS    bool
+	AskURL         string
+}
+
+var scaffoldTemplate = template.Must(template.New("slick.yml").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`# Generated by slick init, see the README for all options.
+app:
+  name: {{quote .Name}}
+  image: {{quote .Image}}
+  # Port the app listens on inside the container.
+  container_port: {{.Port}}
+  # Names of env variables passed to the container, read from the
+  # environment or the file given with --env.
+  env: []
+  # Host ports slick picks from for each new container.
+  port_range:
+    start: 8000
+    end: 9000
+
+caddy:
+  admin_api: "http://localhost:2019"
+{{- if .OnDemandTLS}}
+  global:
+    on_demand_tls:
+      # Caddy asks this endpoint whether it may issue a certificate for a
+      # domain, it must answer 200 for the domains you serve.
+      ask: {{quote .AskURL}}
+{{- end}}
+  rules:
+{{- range .Domains}}
+    - match: {{quote .}}
+{{- if $.OnDemandTLS}}
+      tls: "on_demand"
+{{- end}}
+      reverse_proxy:
+        - path: ""
+          to: "localhost:{port}"
+{{- end}}
+
+health_check:
+  # Must answer with a 2xx status before traffic switches to a new
+  # container.
+  endpoint: {{quote .HealthEndpoint}}
+  timeout_seconds: 5
+`))
+
+// render returns the commented config for the answers.
+func (s scaffold) render() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := scaffoldTemplate.Execute(&buf, s); err != nil {
+		return nil, fmt.Errorf("error rendering config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// prompter asks questions on out and reads the answers line by line from in.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	eof bool
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out}
+}
+
+// ask returns the answer to question, or def when the answer is empty or
+// the input has ended.
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+
+	if p.eof {
+		fmt.Fprintln(p.out)
+		return def
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil {
+		p.eof = true
+		if line == "" {
+			fmt.Fprintln(p.out)
+		}
+	}
+
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		return def
+	}
+	return answer
+}
+
+// require asks question until it gets an answer that check accepts.
+func (p *prompter) require(question, def string, check func(string) error) (string, error) {
+	for {
+		answer := p.ask(question, def)
+		err := check(answer)
+		if err == nil {
+			return answer, nil
+		}
+		if p.eof {
+			return "", err
+		}
+		fmt.Fprintln(p.out, err)
+	}
+}
+
+// confirm asks a yes or no question.
+func (p *prompter) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+
+	for {
+		switch strings.ToLower(p.ask(question+" ("+hint+")", "")) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		if p.eof {
+			return def
+		}
+	}
+}
+
+func notEmpty(name string) func(string) error {
+	return func(answer string) error {
+		if answer == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+		return nil
+	}
+}
+
+func validPort(answer string) error {
+	port, err := strconv.Atoi(answer)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("container port must be a number between 1 and 65535")
+	}
+	return nil
+}
+
+// writeValidatedConfig writes data to path once config.LoadConfig accepts
+// it, so a broken config never replaces the file.
+func writeValidatedConfig(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".slick-*.yml")
+	if err != nil {
+		return fmt.Errorf("error writing config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing config: %w", err)
+	}
+
+	if _, err := config.LoadConfig(tmp.Name()); err != nil {
+		return fmt.Errorf("generated config is invalid: %w", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("error writing config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing config: %w", err)
+	}
+
+	return nil
+}
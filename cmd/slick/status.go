@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/caddy"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/health"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/spf13/cobra"
+)
+
+// appStatus is the state of an app on one server.
+type appStatus struct {
+	App        string            `json:"app"`
+	Server     string            `json:"server"`
+	Containers []containerStatus `json:"containers"`
+	// Upstreams are the addresses Caddy sends the traffic of the app to,
+	// nil when the admin API could not be reached.
+	Upstreams  []string          `json:"caddy_upstreams"`
+	LastDeploy *state.Deployment `json:"last_deploy,omitempty"`
+	Warnings   []string          `json:"warnings"`
+}
+
+// containerStatus is the state of a web container of the app.
+type containerStatus struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Image        string `json:"image"`
+	Digest       string `json:"digest,omitempty"`
+	Port         int    `json:"port"`
+	DockerHealth string `json:"docker_health"`
+	// Probe is "healthy" or why the health endpoint failed, empty when no
+	// endpoint is configured.
+	Probe     string    `json:"probe,omitempty"`
+	Routed    bool      `json:"routed"`
+	DeployID  string    `json:"deploy_id,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func runStatus(cmd *cobra.Command, configLoader ConfigLoader) error {
+	output, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := configLoader(cmd)
+	if err != nil {
+		return err
+	}
+
+	hosts, err := statusHosts(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext(cmd)
+	defer stop()
+
+	locks, err := stateStoreCreator().ActiveLocks()
+	if err != nil {
+		slog.Warn("Unable to read deploy locks", "error", err)
+	}
+	for _, lock := range locks {
+		if lock.App != cfg.App.Name {
+			continue
+		}
+		server := lock.Server
+		if server == "" {
+			server = "local"
+		}
+		slog.Info(fmt.Sprintf("Deploy of %s to %s in progress by %s", lock.App, server, lock), "app", lock.App, "pid", lock.PID)
+	}
+
+	statuses := make([]appStatus, 0, len(hosts))
+	for _, host := range hosts {
+		status, err := collectStatusOn(ctx, cfg, host)
+		if err != nil {
+			// A single unreachable server should not hide the others.
+			if len(hosts) == 1 {
+				return err
+			}
+			status = appStatus{App: cfg.App.Name, Server: serverName(host), Containers: []containerStatus{}, Warnings: []string{err.Error()}}
+		}
+		statuses = append(statuses, status)
+	}
+
+	if output == outputJSON {
+		return writeJSON(os.Stdout, statuses)
+	}
+
+	for i, status := range statuses {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printStatus(os.Stdout, status, time.Now()); err != nil {
+			return err
+		}
+		for _, warning := range status.Warnings {
+			slog.Warn(warning, "app", status.App, "server", status.Server)
+		}
+	}
+
+	return nil
+}
+
+// statusHosts returns the servers to report on: the one given with --host,
+// every server of the config, or the local machine as nil.
+func statusHosts(cfg config.DeploymentConfig) ([]*remote.Host, error) {
+	if targetHost != nil || len(cfg.Servers) == 0 {
+		return []*remote.Host{targetHost}, nil
+	}
+
+	hosts := make([]*remote.Host, 0, len(cfg.Servers))
+	for _, server := range cfg.Servers {
+		host, err := remote.ParseHost(server)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+func serverName(host *remote.Host) string {
+	if host == nil {
+		return "local"
+	}
+	return host.String()
+}
+
+// collectStatusOn gathers the status of the app on host, nil for the local
+// machine.
+func collectStatusOn(ctx context.Context, cfg config.DeploymentConfig, host *remote.Host) (appStatus, error) {
+	dockerService, transport, err := dockerServiceOn(host)
+	if err != nil {
+		return appStatus{}, err
+	}
+
+	return collectStatus(ctx, cfg, dockerService, transport, host)
+}
+
+// dockerServiceOn creates the Docker service of host, nil for the local
+// machine, along with the transport that reaches the ports of its
+// containers.
+func dockerServiceOn(host *remote.Host) (DockerService, http.RoundTripper, error) {
+	dockerService, err := dockerServiceCreator(host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if host == nil {
+		return dockerService, nil, nil
+	}
+	return dockerService, host.Transport(), nil
+}
+
+func collectStatus(ctx context.Context, cfg config.DeploymentConfig, dockerService DockerService, transport http.RoundTripper, host *remote.Host) (appStatus, error) {
+	status := appStatus{
+		App:        cfg.App.Name,
+		Server:     serverName(host),
+		Containers: []containerStatus{},
+		Warnings:   []string{},
+	}
+
+	containers, err := dockerService.AppContainers(ctx, cfg.App.Name)
+	if err != nil {
+		return status, fmt.Errorf("error listing containers of %s: %w", cfg.App.Name, err)
+	}
+
+	upstreams, caddyErr := caddyUpstreams(ctx, cfg, transport)
+	if caddyErr != nil {
+		status.Warnings = append(status.Warnings, fmt.Sprintf("Unable to read the upstreams from Caddy: %v", caddyErr))
+	} else {
+		status.Upstreams = upstreams
+	}
+
+	routed := map[string]bool{}
+	for _, c := range containers {
+		cs := containerStatus{
+			ID:           c.ID,
+			Name:         c.Name,
+			Image:        c.Image,
+			Digest:       c.Digest,
+			Port:         c.Port,
+			DockerHealth: c.Health,
+			DeployID:     c.DeployID,
+			StartedAt:    c.StartedAt,
+		}
+
+		if cfg.HealthCheck.Endpoint != "" && c.Port != 0 {
+			cs.Probe = "healthy"
+			if err := health.Probe(ctx, "http://"+c.Address(), cfg.HealthCheck, transport); err != nil {
+				cs.Probe = err.Error()
+			}
+		}
+
+		for _, address := range expectedUpstreams(cfg.Caddy, c.Container) {
+			for _, upstream := range upstreams {
+				if upstream == address {
+					cs.Routed = true
+					routed[upstream] = true
+				}
+			}
+		}
+
+		status.Containers = append(status.Containers, cs)
+	}
+
+	last, err := stateStoreCreator().LastOn(cfg.App.Name, host.Name())
+	if err != nil {
+		slog.Warn("Unable to read deploy history", "error", err)
+	}
+	status.LastDeploy = last
+
+	status.Warnings = append(status.Warnings, driftWarnings(status, caddyErr == nil, routed)...)
+
+	return status, nil
+}
+
+// caddyUpstreams returns the upstreams Caddy sends the traffic of the app
+// to. Fixed targets written out in the rules, which belong to other
+// services, are left out.
+func caddyUpstreams(ctx context.Context, cfg config.DeploymentConfig, transport http.RoundTripper) ([]string, error) {
+	client := &caddy.CaddyClient{
+		BaseURL:    cfg.Caddy.AdminAPI,
+		HTTPClient: &http.Client{Transport: transport, Timeout: 5 * time.Second},
+	}
+	upstreams, err := client.Upstreams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fixed := map[string]bool{}
+	for _, rule := range cfg.Caddy.Rules {
+		for _, proxy := range rule.ReverseProxy {
+			if !strings.Contains(proxy.To, "{") {
+				fixed[dialAddress(proxy.To)] = true
+			}
+		}
+	}
+
+	app := []string{}
+	for _, upstream := range upstreams {
+		if !fixed[upstream] {
+			app = append(app, upstream)
+		}
+	}
+	return app, nil
+}
+
+// expectedUpstreams returns the addresses Caddy dials when the app traffic
+// goes to c, the way a deploy renders the rules.
+func expectedUpstreams(caddyCfg config.CaddyConfig, c docker.Container) []string {
+	upstream := caddy.Upstream{Host: c.Alias, Port: c.Port}
+	if upstream.Host == "" {
+		upstream.Host = c.IP
+	}
+
+	var addresses []string
+	for _, rule := range caddyCfg.Rules {
+		for _, proxy := range rule.ReverseProxy {
+			if strings.Contains(proxy.To, "{") {
+				addresses = append(addresses, dialAddress(upstream.Expand(proxy.To)))
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		addresses = append(addresses, upstream.Address())
+	}
+	return addresses
+}
+
+// dialAddress strips the scheme from a reverse_proxy target, leaving the
+// host:port Caddy reports for it.
+func dialAddress(to string) string {
+	if _, address, ok := strings.Cut(to, "://"); ok {
+		return address
+	}
+	return to
+}
+
+// driftWarnings reports where Docker, Caddy and the deploy history disagree.
+func driftWarnings(status appStatus, caddyKnown bool, routed map[string]bool) []string {
+	var warnings []string
+
+	// An app stopped with slick stop is expected to run no containers.
+	stopped := status.LastDeploy != nil && status.LastDeploy.Status == state.StatusStopped
+	if len(status.Containers) == 0 && !stopped {
+		warnings = append(warnings, fmt.Sprintf("No container of %s is running", status.App))
+	}
+
+	if caddyKnown {
+		for _, c := range status.Containers {
+			if !c.Routed {
+				warnings = append(warnings, fmt.Sprintf("Container %s is running but Caddy does not send traffic to it", c.Name))
+			}
+		}
+		for _, upstream := range status.Upstreams {
+			if !routed[upstream] {
+				warnings = append(warnings, fmt.Sprintf("Caddy sends traffic to %s but no container of %s listens there", upstream, status.App))
+			}
+		}
+	}
+
+	if last := status.LastDeploy; last != nil && last.Status == state.StatusSucceeded && last.ContainerID != "" {
+		found := false
+		for _, c := range status.Containers {
+			if strings.HasPrefix(c.ID, last.ContainerID) || strings.HasPrefix(last.ContainerID, c.ID) {
+				found = true
+			}
+		}
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("The container of the last deploy %s is no longer running", last.ID))
+		}
+	}
+
+	return warnings
+}
+
+func printStatus(out io.Writer, status appStatus, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintf(w, "APP:\t%s\n", status.App)
+	fmt.Fprintf(w, "SERVER:\t%s\n", status.Server)
+	caddyUpstreams := "unknown"
+	if status.Upstreams != nil {
+		caddyUpstreams = strings.Join(status.Upstreams, ", ")
+		if caddyUpstreams == "" {
+			caddyUpstreams = "none"
+		}
+	}
+	fmt.Fprintf(w, "CADDY UPSTREAM:\t%s\n", caddyUpstreams)
+	lastDeploy := "none"
+	if last := status.LastDeploy; last != nil {
+		lastDeploy = fmt.Sprintf("%s %s, %s ago", last.ID, last.Status, formatUptime(now.Sub(last.FinishedAt)))
+		if last.Error != "" {
+			lastDeploy += ": " + last.Error
+		}
+	}
+	fmt.Fprintf(w, "LAST DEPLOY:\t%s\n", lastDeploy)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER\tIMAGE\tDIGEST\tPORT\tDOCKER HEALTH\tPROBE\tROUTED\tUPTIME\tDEPLOY ID")
+	for _, c := range status.Containers {
+		probe := c.Probe
+		if probe == "" {
+			probe = "-"
+		}
+		routed := "no"
+		if c.Routed {
+			routed = "yes"
+		}
+		uptime := "-"
+		if !c.StartedAt.IsZero() {
+			uptime = formatUptime(now.Sub(c.StartedAt))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			c.Name,
+			c.Image,
+			shortDigest(c.Digest),
+			c.Port,
+			c.DockerHealth,
+			probe,
+			routed,
+			uptime,
+			c.DeployID)
+	}
+
+	return w.Flush()
+}
+
+// formatUptime rounds d to the two largest units, such as 3h12m or 2d4h.
+func formatUptime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+}
+
+// shortDigest abbreviates an image digest to 12 hex characters.
+func shortDigest(digest string) string {
+	if digest == "" {
+		return "-"
+	}
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if !ok || len(hex) <= 12 {
+		return digest
+	}
+	return algorithm + ":" + hex[:12]
+}
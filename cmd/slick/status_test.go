@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statusServer serves the health endpoint of the app as well as the Caddy
+// admin API, which reports upstreams as its routes. It returns the URL and
+// the port of the server.
+func statusServer(t *testing.T, upstreams ...string) (string, int) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/health":
+			rw.WriteHeader(http.StatusOK)
+		case "/reverse_proxy/upstreams":
+			body := []map[string]any{}
+			for _, upstream := range upstreams {
+				body = append(body, map[string]any{"address": upstream, "num_requests": 0, "fails": 0})
+			}
+			_ = json.NewEncoder(rw).Encode(body)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	port, err := strconv.Atoi(server.URL[strings.LastIndex(server.URL, ":")+1:])
+	assert.NoError(t, err)
+	return server.URL, port
+}
+
+func statusConfigLoader(adminAPI string) ConfigLoader {
+	return func(*cobra.Command) (config.DeploymentConfig, error) {
+		return config.DeploymentConfig{
+			App: config.App{Name: "memos"},
+			Caddy: config.CaddyConfig{
+				AdminAPI: adminAPI,
+				Rules: []config.Rule{{
+					Match: "memos.example.com",
+					ReverseProxy: []config.ReverseProxy{
+						{To: "localhost:{port}"},
+						{Path: "/static", To: "localhost:3000"},
+					},
+				}},
+			},
+			HealthCheck: config.HealthCheck{Endpoint: "/health", TimeoutSeconds: 1},
+		}, nil
+	}
+}
+
+func captureStatus(t *testing.T, output string, configLoader ConfigLoader) (string, error) {
+	cmd := createTestCommand()
+	cmd.Flags().String("output", output, "")
+	var err error
+	stdout := captureStdout(t, func() {
+		err = runStatus(cmd, configLoader)
+	})
+	return stdout, err
+}
+
+func TestDockerServiceOn_PassesHost(t *testing.T) {
+	var got *remote.Host
+	original := dockerServiceCreator
+	dockerServiceCreator = func(host *remote.Host) (DockerService, error) {
+		got = host
+		return new(MockDockerService), nil
+	}
+	t.Cleanup(func() { dockerServiceCreator = original })
+
+	host := &remote.Host{Hostname: "web1.example.com"}
+	_, transport, err := dockerServiceOn(host)
+
+	require.NoError(t, err)
+	assert.Same(t, host, got)
+	assert.NotNil(t, transport)
+	assert.Nil(t, targetHost)
+}
+
+func TestRunStatus(t *testing.T) {
+	store := useTempStateStore(t)
+	_, port := statusServer(t)
+	adminAPI, _ := statusServer(t, fmt.Sprintf("localhost:%d", port), "localhost:3000")
+
+	started := time.Now().Add(-3*time.Hour - 12*time.Minute)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{{
+		Container: docker.Container{ID: "abc123", Port: port, IP: "127.0.0.1"},
+		Name:      "memos-second",
+		Image:     "example/image:v2",
+		Digest:    "sha256:0123456789abcdef0123",
+		State:     "running",
+		Health:    "healthy",
+		DeployID:  "second",
+		StartedAt: started,
+	}}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", ContainerID: "abc123", Status: state.StatusSucceeded, StartedAt: started, FinishedAt: started}))
+
+	output, err := captureStatus(t, "text", statusConfigLoader(adminAPI))
+	assert.NoError(t, err)
+	assert.Contains(t, output, fmt.Sprintf("CADDY UPSTREAM:   localhost:%d\n", port))
+	assert.Contains(t, output, "LAST DEPLOY:      second succeeded, 3h12m ago")
+	assert.Regexp(t, `memos-second\s+example/image:v2\s+sha256:0123456789ab\s+\d+\s+healthy\s+healthy\s+yes\s+3h12m\s+second`, output)
+
+	output, err = captureStatus(t, "json", statusConfigLoader(adminAPI))
+	assert.NoError(t, err)
+
+	var statuses []appStatus
+	assert.NoError(t, json.Unmarshal([]byte(output), &statuses))
+	if assert.Len(t, statuses, 1) {
+		assert.Empty(t, statuses[0].Warnings)
+		assert.Equal(t, "second", statuses[0].LastDeploy.ID)
+	}
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunStatus_Drift(t *testing.T) {
+	store := useTempStateStore(t)
+	_, port := statusServer(t)
+	adminAPI, _ := statusServer(t, "localhost:1", "localhost:3000")
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{{
+		Container: docker.Container{ID: "abc123", Port: port, IP: "127.0.0.1"},
+		Name:      "memos-second",
+		Health:    "none",
+	}}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	assert.NoError(t, store.Record(state.Deployment{ID: "first", App: "memos", ContainerID: "gone", Status: state.StatusSucceeded}))
+
+	output, err := captureStatus(t, "json", statusConfigLoader(adminAPI))
+	assert.NoError(t, err)
+
+	var statuses []appStatus
+	assert.NoError(t, json.Unmarshal([]byte(output), &statuses))
+	if assert.Len(t, statuses, 1) {
+		status := statuses[0]
+		assert.Equal(t, "local", status.Server)
+		assert.Equal(t, []string{"localhost:1"}, status.Upstreams)
+		if assert.Len(t, status.Containers, 1) {
+			assert.Equal(t, "healthy", status.Containers[0].Probe)
+			assert.False(t, status.Containers[0].Routed)
+		}
+		assert.Equal(t, []string{
+			"Container memos-second is running but Caddy does not send traffic to it",
+			"Caddy sends traffic to localhost:1 but no container of memos listens there",
+			"The container of the last deploy first is no longer running",
+		}, status.Warnings)
+	}
+}
+
+func TestRunStatus_Stopped(t *testing.T) {
+	store := useTempStateStore(t)
+	adminAPI, _ := statusServer(t, "localhost:3000")
+
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	assert.NoError(t, store.Record(state.Deployment{ID: "second", App: "memos", ContainerID: "abc123", Status: state.StatusSucceeded}))
+	assert.NoError(t, store.Record(state.Deployment{ID: "third", App: "memos", Status: state.StatusStopped}))
+
+	output, err := captureStatus(t, "json", statusConfigLoader(adminAPI))
+	assert.NoError(t, err)
+
+	var statuses []appStatus
+	assert.NoError(t, json.Unmarshal([]byte(output), &statuses))
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, state.StatusStopped, statuses[0].LastDeploy.Status)
+		assert.Empty(t, statuses[0].Warnings)
+	}
+}
+
+func TestRunStatus_CaddyUnreachable(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return([]docker.AppContainer{}, nil)
+	useMockDockerService(t, mockDockerService)
+
+	output, err := captureStatus(t, "json", statusConfigLoader("http://127.0.0.1:1"))
+	assert.NoError(t, err)
+
+	var statuses []appStatus
+	assert.NoError(t, json.Unmarshal([]byte(output), &statuses))
+	if assert.Len(t, statuses, 1) {
+		assert.Nil(t, statuses[0].Upstreams)
+		assert.Len(t, statuses[0].Warnings, 2)
+		assert.Contains(t, statuses[0].Warnings[0], "Unable to read the upstreams from Caddy")
+		assert.Equal(t, "No container of memos is running", statuses[0].Warnings[1])
+	}
+}
+
+func TestRunStatus_Error(t *testing.T) {
+	useTempStateStore(t)
+	mockDockerService := new(MockDockerService)
+	mockDockerService.On("AppContainers", "memos").Return(nil, errors.New("status error"))
+	useMockDockerService(t, mockDockerService)
+
+	_, err := captureStatus(t, "text", statusConfigLoader("http://127.0.0.1:1"))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "status error")
+	mockDockerService.AssertExpectations(t)
+}
+
+func TestRunStatus_DockerServiceCreatorFails(t *testing.T) {
+	useTempStateStore(t)
+	originalDockerServiceCreator := dockerServiceCreator
+	dockerServiceCreator = func(*remote.Host) (DockerService, error) {
+		return nil, errors.New("failed to create Docker service")
+	}
+	defer func() { dockerServiceCreator = originalDockerServiceCreator }()
+
+	_, err := captureStatus(t, "text", statusConfigLoader("http://127.0.0.1:1"))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create Docker service")
+}
+
+func TestFormatUptime(t *testing.T) {
+	tests := map[time.Duration]string{
+		-time.Second:                      "0s",
+		42*time.Second + time.Millisecond: "42s",
+		12*time.Minute + 59*time.Second:   "12m",
+		3*time.Hour + 12*time.Minute:      "3h12m",
+		50*time.Hour + 30*time.Minute:     "2d2h",
+	}
+	for d, want := range tests {
+		assert.Equal(t, want, formatUptime(d), d.String())
+	}
+}
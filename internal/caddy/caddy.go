@@ -1,14 +1,47 @@
 package caddy
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 
 	"github.com/scmmishra/slick-deploy/internal/config"
 )
 
+// Upstream is where Caddy sends the traffic of the app.
+type Upstream struct {
+	// Host is the network alias or the bind address of the container,
+	// localhost when empty.
+	Host string
+	Port int
+}
+
+// Address returns the upstream as host:port.
+func (u Upstream) Address() string {
+	host := u.Host
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(u.Port))
+}
+
+// Expand replaces the {port} and {upstream} placeholders in s.
+func (u Upstream) Expand(s string) string {
+	return u.replacer().Replace(s)
+}
+
+// replacer expands the {port} and {upstream} placeholders of the config.
+func (u Upstream) replacer() *strings.Replacer {
+	return strings.NewReplacer(
+		"{port}", fmt.Sprintf("%d", u.Port),
+		"{upstream}", u.Address(),
+	)
+}
+
 // buildGlobalOptions formats global options for the Caddyfile.
-func buildGlobalOptions(globalCfg config.GlobalOptions, port int) string {
+func buildGlobalOptions(globalCfg config.GlobalOptions, r *strings.Replacer) string {
 	var builder strings.Builder
 
 	hasEmail := globalCfg.Email != ""
@@ -20,7 +53,7 @@ func buildGlobalOptions(globalCfg config.GlobalOptions, port int) string {
 			builder.WriteString(fmt.Sprintf("  email %s\n", globalCfg.Email))
 		}
 		if hasOnDemandTls {
-			appendOnDemandTlsConfig(&builder, globalCfg.OnDemandTls, port)
+			appendOnDemandTlsConfig(&builder, globalCfg.OnDemandTls, r)
 		}
 		builder.WriteString("}\n\n")
 	}
@@ -29,9 +62,9 @@ func buildGlobalOptions(globalCfg config.GlobalOptions, port int) string {
 }
 
 // appendOnDemandTlsConfig adds the on_demand_tls configuration.
-func appendOnDemandTlsConfig(builder *strings.Builder, tlsConfig config.OnDemandTlsConfig, port int) {
+func appendOnDemandTlsConfig(builder *strings.Builder, tlsConfig config.OnDemandTlsConfig, r *strings.Replacer) {
 	builder.WriteString("  on_demand_tls {\n")
-	builder.WriteString(fmt.Sprintf("    ask %s\n", strings.ReplaceAll(tlsConfig.Ask, "{port}", fmt.Sprintf("%d", port))))
+	builder.WriteString(fmt.Sprintf("    ask %s\n", r.Replace(tlsConfig.Ask)))
 
 	if tlsConfig.Interval != "" {
 		builder.WriteString(fmt.Sprintf("    interval %s\n", tlsConfig.Interval))
@@ -42,23 +75,31 @@ func appendOnDemandTlsConfig(builder *strings.Builder, tlsConfig config.OnDemand
 	builder.WriteString("  }\n")
 }
 
-// ConvertToCaddyfile converts configuration into a Caddyfile representation.
+// ConvertToCaddyfile converts configuration into a Caddyfile representation
+// for an app listening on localhost:port.
 func ConvertToCaddyfile(caddyCfg config.CaddyConfig, port int) string {
+	return ConvertToCaddyfileForUpstream(caddyCfg, Upstream{Port: port})
+}
+
+// ConvertToCaddyfileForUpstream converts configuration into a Caddyfile
+// representation that sends traffic to upstream.
+func ConvertToCaddyfileForUpstream(caddyCfg config.CaddyConfig, upstream Upstream) string {
 	var builder strings.Builder
 
-	builder.WriteString(buildGlobalOptions(caddyCfg.Global, port))
+	r := upstream.replacer()
+	builder.WriteString(buildGlobalOptions(caddyCfg.Global, r))
 	for _, rule := range caddyCfg.Rules {
-		appendRule(&builder, rule, port)
+		appendRule(&builder, rule, r)
 	}
 
 	return builder.String()
 }
 
 // appendRule adds a server block with its configuration.
-func appendRule(builder *strings.Builder, rule config.Rule, port int) {
+func appendRule(builder *strings.Builder, rule config.Rule, r *strings.Replacer) {
 	builder.WriteString(rule.Match + " {\n")
 	if rule.Tls != "" {
-		newTls := strings.ReplaceAll(rule.Tls, "{port}", fmt.Sprintf("%d", port))
+		newTls := r.Replace(rule.Tls)
 		builder.WriteString(fmt.Sprintf("  tls {\n    %s\n  }\n", newTls))
 	}
 
@@ -71,7 +112,7 @@ func appendRule(builder *strings.Builder, rule config.Rule, port int) {
 	}
 
 	for _, proxy := range rule.ReverseProxy {
-		toPath := strings.ReplaceAll(proxy.To, "{port}", fmt.Sprintf("%d", port))
+		toPath := r.Replace(proxy.To)
 		builder.WriteString(fmt.Sprintf("  reverse_proxy %s %s {\n", proxy.Path, toPath))
 		for _, header := range proxy.HeaderUp {
 			builder.WriteString(fmt.Sprintf("    header_up %s %s\n", header.Name, header.Value))
@@ -81,9 +122,38 @@ func appendRule(builder *strings.Builder, rule config.Rule, port int) {
 	builder.WriteString("}\n\n")
 }
 
+// ConvertToMaintenanceCaddyfile converts configuration into a Caddyfile that
+// answers every request for the domains of the app with message and a 503,
+// for while the app is stopped.
+func ConvertToMaintenanceCaddyfile(caddyCfg config.CaddyConfig, message string) string {
+	var builder strings.Builder
+
+	r := Upstream{}.replacer()
+	builder.WriteString(buildGlobalOptions(caddyCfg.Global, r))
+	for _, rule := range caddyCfg.Rules {
+		builder.WriteString(rule.Match + " {\n")
+		if rule.Tls != "" {
+			builder.WriteString(fmt.Sprintf("  tls {\n    %s\n  }\n", r.Replace(rule.Tls)))
+		}
+		builder.WriteString(fmt.Sprintf("  respond %s 503\n", strconv.Quote(message)))
+		builder.WriteString("}\n\n")
+	}
+
+	return builder.String()
+}
+
+// SetupMaintenanceWithClient loads the maintenance Caddyfile through client.
+func SetupMaintenanceWithClient(ctx context.Context, client CaddyClientInterface, cfg config.DeploymentConfig, message string) error {
+	return client.Load(ctx, ConvertToMaintenanceCaddyfile(cfg.Caddy, message))
+}
+
 // SetupCaddy loads the Caddyfile configuration into Caddy.
-func SetupCaddy(port int, cfg config.DeploymentConfig) error {
-	caddyfile := ConvertToCaddyfile(cfg.Caddy, port)
-	client := NewCaddyClient(cfg.Caddy.AdminAPI)
-	return client.Load(caddyfile)
+func SetupCaddy(ctx context.Context, upstream Upstream, cfg config.DeploymentConfig) error {
+	return SetupCaddyWithClient(ctx, NewCaddyClient(cfg.Caddy.AdminAPI), upstream, cfg)
+}
+
+// SetupCaddyWithClient loads the Caddyfile configuration through client.
+func SetupCaddyWithClient(ctx context.Context, client CaddyClientInterface, upstream Upstream, cfg config.DeploymentConfig) error {
+	caddyfile := ConvertToCaddyfileForUpstream(cfg.Caddy, upstream)
+	return client.Load(ctx, caddyfile)
 }
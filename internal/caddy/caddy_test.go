@@ -1,6 +1,7 @@
 package caddy
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -91,11 +92,72 @@ func TestConvertToCaddyfile_EmptyRules(t *testing.T) {
 	assert.Equal(t, "", caddyfile)
 }
 
+func TestConvertToCaddyfileForUpstream(t *testing.T) {
+	caddyCfg := config.CaddyConfig{
+		Rules: []config.Rule{
+			{
+				Match: "example.com",
+				ReverseProxy: []config.ReverseProxy{
+					{Path: "/", To: "{upstream}"},
+					{Path: "/legacy", To: "http://localhost:{port}"},
+				},
+			},
+		},
+	}
+
+	caddyfile := ConvertToCaddyfileForUpstream(caddyCfg, Upstream{Host: "memos-1a2b3c", Port: 5230})
+
+	expectedCaddyfile := `example.com {
+  reverse_proxy / memos-1a2b3c:5230 {
+  }
+  reverse_proxy /legacy http://localhost:5230 {
+  }
+}
+
+`
+	assert.Equal(t, expectedCaddyfile, caddyfile)
+	assert.Contains(t, ConvertToCaddyfile(caddyCfg, 8001), "reverse_proxy / localhost:8001")
+}
+
+func TestConvertToMaintenanceCaddyfile(t *testing.T) {
+	caddyCfg := config.CaddyConfig{
+		Global: config.GlobalOptions{Email: "ops@example.com"},
+		Rules: []config.Rule{
+			{
+				Match: "example.com",
+				Tls:   "on_demand",
+				Handle: []config.Handle{
+					{Path: "/static/*", Directives: []string{"file_server"}},
+				},
+				ReverseProxy: []config.ReverseProxy{
+					{Path: "/", To: "{upstream}"},
+				},
+			},
+		},
+	}
+
+	caddyfile := ConvertToMaintenanceCaddyfile(caddyCfg, `Down for "maintenance"`)
+
+	expectedCaddyfile := `{
+  email ops@example.com
+}
+
+example.com {
+  tls {
+    on_demand
+  }
+  respond "Down for \"maintenance\"" 503
+}
+
+`
+	assert.Equal(t, expectedCaddyfile, caddyfile)
+}
+
 type MockCaddyClient struct {
 	mock.Mock
 }
 
-func (m *MockCaddyClient) Load(caddyfile string) error {
+func (m *MockCaddyClient) Load(ctx context.Context, caddyfile string) error {
 	args := m.Called(caddyfile)
 	return args.Error(0)
 }
@@ -115,7 +177,7 @@ func TestSetupCaddy(t *testing.T) {
 			Rules:    []config.Rule{},
 		},
 	}
-	err := SetupCaddy(8080, cfg)
+	err := SetupCaddy(context.Background(), Upstream{Port: 8080}, cfg)
 	assert.NoError(t, err)
 
 	mockClient.AssertExpectations(t)
@@ -136,7 +198,7 @@ func TestSetupCaddy_Error(t *testing.T) {
 			Rules:    []config.Rule{},
 		},
 	}
-	err := SetupCaddy(8080, cfg)
+	err := SetupCaddy(context.Background(), Upstream{Port: 8080}, cfg)
 	assert.Error(t, err)
 
 	mockClient.AssertExpectations(t)
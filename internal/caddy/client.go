@@ -2,23 +2,29 @@ package caddy
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"sort"
 )
 
 type CaddyClientInterface interface {
-	Load(caddyfile string) error
+	Load(ctx context.Context, caddyfile string) error
 }
 
 type CaddyClient struct {
 	BaseURL    string
 	HTTPClient *http.Client
+	Logger     *slog.Logger
 }
 
 var NewCaddyClient = func(baseURL string) CaddyClientInterface {
 	return &CaddyClient{
 		BaseURL:    baseURL,
 		HTTPClient: &http.Client{},
+		Logger:     slog.Default(),
 	}
 }
 
@@ -27,12 +33,97 @@ var NewCaddyClient = func(baseURL string) CaddyClientInterface {
 //	curl "http://localhost:2019/load" \
 //		-H "Content-Type: text/caddyfile" \
 //		--data-binary @Caddyfile
-func (cl *CaddyClient) Load(caddyfile string) error {
-	req, err := http.NewRequest("POST", cl.BaseURL+"/load", bytes.NewBuffer([]byte(caddyfile)))
+func (cl *CaddyClient) Load(ctx context.Context, caddyfile string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", cl.BaseURL+"/load", bytes.NewBuffer([]byte(caddyfile)))
 	if err != nil {
 		return fmt.Errorf("error creating request: %w", err)
 	}
 	req.Header.Set("Content-Type", "text/caddyfile")
+	if cl.Logger != nil {
+		cl.Logger.Debug("Loading Caddy config", "admin_api", cl.BaseURL, "bytes", len(caddyfile))
+	}
+	resp, err := cl.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request to Caddy: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received non-OK response from Caddy: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Upstreams returns the addresses of the reverse proxy upstreams Caddy
+// currently sends traffic to, sorted.
+//
+// https://caddyserver.com/docs/api#get-reverse_proxyupstreams
+func (cl *CaddyClient) Upstreams(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cl.BaseURL+"/reverse_proxy/upstreams", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	var upstreams []struct {
+		Address string `json:"address"`
+	}
+	if err := cl.do(req, &upstreams); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	addresses := []string{}
+	for _, upstream := range upstreams {
+		if !seen[upstream.Address] {
+			seen[upstream.Address] = true
+			addresses = append(addresses, upstream.Address)
+		}
+	}
+	sort.Strings(addresses)
+
+	return addresses, nil
+}
+
+// Config returns the configuration Caddy is running, as indented JSON.
+//
+// https://caddyserver.com/docs/api#get-configpath
+func (cl *CaddyClient) Config(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cl.BaseURL+"/config/", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	var config any
+	if err := cl.do(req, &config); err != nil {
+		return nil, err
+	}
+	return indentJSON(config)
+}
+
+// Adapt converts a Caddyfile into the JSON configuration Caddy would run,
+// without loading it.
+//
+// https://caddyserver.com/docs/api#post-adapt
+func (cl *CaddyClient) Adapt(ctx context.Context, caddyfile string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cl.BaseURL+"/adapt", bytes.NewBufferString(caddyfile))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/caddyfile")
+
+	var adapted struct {
+		Result any `json:"result"`
+	}
+	if err := cl.do(req, &adapted); err != nil {
+		return nil, err
+	}
+	return indentJSON(adapted.Result)
+}
+
+// do sends req and decodes the JSON response into v.
+func (cl *CaddyClient) do(req *http.Request, v any) error {
 	resp, err := cl.HTTPClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("error sending request to Caddy: %w", err)
@@ -44,5 +135,21 @@ func (cl *CaddyClient) Load(caddyfile string) error {
 		return fmt.Errorf("received non-OK response from Caddy: %s", resp.Status)
 	}
 
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding Caddy response: %w", err)
+	}
 	return nil
 }
+
+// indentJSON formats a decoded configuration with sorted keys so that two
+// configurations can be compared line by line.
+func indentJSON(v any) ([]byte, error) {
+	if v == nil {
+		return []byte("null\n"), nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding Caddy config: %w", err)
+	}
+	return append(data, '\n'), nil
+}
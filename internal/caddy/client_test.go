@@ -1,6 +1,7 @@
 package caddy
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -17,7 +18,7 @@ func TestLoad(t *testing.T) {
 	client := NewCaddyClient(server.URL)
 
 	// Test the Load function
-	err := client.Load("test caddyfile")
+	err := client.Load(context.Background(), "test caddyfile")
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
@@ -30,7 +31,7 @@ func TestLoad_ErrorConditions(t *testing.T) {
 			BaseURL:    ":", // invalid URL
 			HTTPClient: &http.Client{},
 		}
-		err := client.Load("test caddyfile")
+		err := client.Load(context.Background(), "test caddyfile")
 		if err == nil {
 			t.Errorf("Expected error, got nil")
 		}
@@ -43,7 +44,7 @@ func TestLoad_ErrorConditions(t *testing.T) {
 		}))
 		server.Close() // close the server to simulate network error
 		client := NewCaddyClient(server.URL)
-		err := client.Load("test caddyfile")
+		err := client.Load(context.Background(), "test caddyfile")
 		if err == nil {
 			t.Errorf("Expected error, got nil")
 		}
@@ -56,9 +57,71 @@ func TestLoad_ErrorConditions(t *testing.T) {
 		}))
 		defer server.Close()
 		client := NewCaddyClient(server.URL)
-		err := client.Load("test caddyfile")
+		err := client.Load(context.Background(), "test caddyfile")
 		if err == nil {
 			t.Errorf("Expected error, got nil")
 		}
 	}
 }
+
+func TestUpstreams(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || req.URL.Path != "/reverse_proxy/upstreams" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = rw.Write([]byte(`[{"address":"localhost:8002","num_requests":0,"fails":0},{"address":"localhost:8001","num_requests":3,"fails":0},{"address":"localhost:8002","num_requests":1,"fails":0}]`))
+	}))
+	defer server.Close()
+
+	client := &CaddyClient{BaseURL: server.URL, HTTPClient: &http.Client{}}
+	upstreams, err := client.Upstreams(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(upstreams) != 2 || upstreams[0] != "localhost:8001" || upstreams[1] != "localhost:8002" {
+		t.Errorf("Unexpected upstreams %v", upstreams)
+	}
+
+	server.Close()
+	if _, err := client.Upstreams(context.Background()); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+}
+
+func TestConfigAndAdapt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "/config/":
+			_, _ = rw.Write([]byte(`{"apps":{"http":{"servers":{}}},"admin":{"listen":"localhost:2019"}}`))
+		case req.Method == http.MethodPost && req.URL.Path == "/adapt":
+			if req.Header.Get("Content-Type") != "text/caddyfile" {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = rw.Write([]byte(`{"result":{"apps":{"http":{}}},"warnings":[]}`))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &CaddyClient{BaseURL: server.URL, HTTPClient: &http.Client{}}
+
+	current, err := client.Config(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := "{\n  \"admin\": {\n    \"listen\": \"localhost:2019\"\n  },\n  \"apps\": {\n    \"http\": {\n      \"servers\": {}\n    }\n  }\n}\n"
+	if string(current) != want {
+		t.Errorf("Unexpected config %q", current)
+	}
+
+	adapted, err := client.Adapt(context.Background(), "example.com {\n}\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(adapted) != "{\n  \"apps\": {\n    \"http\": {}\n  }\n}\n" {
+		t.Errorf("Unexpected adapted config %q", adapted)
+	}
+}
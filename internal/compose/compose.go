@@ -0,0 +1,424 @@
+// Package compose translates Docker Compose files into slick configs.
+package compose
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// File is the part of a compose file slick knows how to read.
+type File struct {
+	Services map[string]Service `yaml:"services"`
+
+	// dir is where relative paths such as env files are resolved.
+	dir string
+}
+
+// Service is a compose service. Fields that compose allows in more than one
+// form are normalized while decoding.
+type Service struct {
+	Image       string         `yaml:"image"`
+	Ports       []Port         `yaml:"ports"`
+	Environment mapping        `yaml:"environment"`
+	EnvFile     stringList     `yaml:"env_file"`
+	Volumes     []Volume       `yaml:"volumes"`
+	Networks    networks       `yaml:"networks"`
+	Healthcheck *Healthcheck   `yaml:"healthcheck"`
+	Command     command        `yaml:"command"`
+	Entrypoint  command        `yaml:"entrypoint"`
+	Restart     string         `yaml:"restart"`
+	User        string         `yaml:"user"`
+	WorkingDir  string         `yaml:"working_dir"`
+	Labels      mapping        `yaml:"labels"`
+	Other       map[string]any `yaml:",inline"`
+}
+
+// Port is a published port, from either the short or the long syntax.
+type Port struct {
+	HostIP    string
+	Published string
+	Target    int
+	Protocol  string
+}
+
+// Volume is a mount, from either the short or the long syntax.
+type Volume struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// Healthcheck is the healthcheck of a service.
+type Healthcheck struct {
+	Test     command `yaml:"test"`
+	Interval string  `yaml:"interval"`
+	Timeout  string  `yaml:"timeout"`
+	Retries  int     `yaml:"retries"`
+	Disable  bool    `yaml:"disable"`
+}
+
+// Load reads the compose file at path.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	f, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	f.dir = filepath.Dir(path)
+
+	return f, nil
+}
+
+// Parse decodes a compose file.
+func Parse(data []byte) (*File, error) {
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error parsing compose file: %w", err)
+	}
+	if len(f.Services) == 0 {
+		return nil, fmt.Errorf("compose file has no services")
+	}
+
+	return &f, nil
+}
+
+// ServiceNames returns the names of the services, sorted.
+func (f *File) ServiceNames() []string {
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PickService returns the service to deploy as the app. When name is empty
+// it is the only service, or the only one that publishes a port.
+func (f *File) PickService(name string) (string, error) {
+	if name != "" {
+		if _, ok := f.Services[name]; !ok {
+			return "", fmt.Errorf("compose file has no service %s, expected one of %s", name, strings.Join(f.ServiceNames(), ", "))
+		}
+		return name, nil
+	}
+
+	names := f.ServiceNames()
+	if len(names) == 1 {
+		return names[0], nil
+	}
+
+	var withPorts []string
+	for _, name := range names {
+		if len(f.Services[name].Ports) > 0 {
+			withPorts = append(withPorts, name)
+		}
+	}
+	if len(withPorts) == 1 {
+		return withPorts[0], nil
+	}
+
+	return "", fmt.Errorf("compose file has several services, pick one with --service: %s", strings.Join(names, ", "))
+}
+
+// Convert turns the named service into the app of a slick config, served by
+// Caddy on domain. The other services become accessories. It returns the
+// compose features that could not be mapped.
+func (f *File) Convert(name, domain string) (config.DeploymentConfig, []string, error) {
+	service, ok := f.Services[name]
+	if !ok {
+		return config.DeploymentConfig{}, nil, fmt.Errorf("compose file has no service %s", name)
+	}
+
+	r := &report{}
+	cfg := config.DeploymentConfig{}
+
+	app := config.App{
+		Name:       name,
+		ImageName:  service.Image,
+		Command:    service.Command,
+		Entrypoint: service.Entrypoint,
+		Restart:    service.Restart,
+		User:       service.User,
+		WorkingDir: service.WorkingDir,
+		Labels:     service.Labels.values(),
+		ENV:        f.envNames(name, service, r),
+		Volumes:    volumeSpecs(service.Volumes),
+	}
+	if app.ImageName == "" {
+		r.add(name, "build", "slick deploys prebuilt images, set app.image")
+	}
+
+	if len(service.Ports) > 0 {
+		app.ContainerPort = service.Ports[0].Target
+		if len(service.Ports) > 1 {
+			r.add(name, "ports", "only the first port is routed through Caddy")
+		}
+	}
+
+	if len(service.Networks) > 0 {
+		app.Network = service.Networks[0]
+		if len(service.Networks) > 1 {
+			r.add(name, "networks", "only the first network is joined")
+		}
+	}
+
+	if service.Healthcheck != nil && !service.Healthcheck.Disable {
+		health, port, err := convertHealthcheck(*service.Healthcheck)
+		if err != nil {
+			r.add(name, "healthcheck", err.Error())
+		} else {
+			cfg.HealthCheck = health
+			if app.ContainerPort == 0 {
+				app.ContainerPort = port
+			}
+		}
+	}
+
+	if app.ContainerPort == 0 {
+		r.add(name, "ports", "no container port found, set app.container_port")
+	}
+
+	r.unsupported(name, service.Other)
+	cfg.App = app
+
+	if domain == "" {
+		domain = sanitizeDomain(name) + ".localhost"
+	}
+	cfg.Caddy.Rules = []config.Rule{{
+		Match: domain,
+		ReverseProxy: []config.ReverseProxy{{
+			To: "localhost:{port}",
+		}},
+	}}
+
+	for _, other := range f.ServiceNames() {
+		if other == name {
+			continue
+		}
+		if accessory, ok := f.accessory(other, r); ok {
+			cfg.Accessories = append(cfg.Accessories, accessory)
+		}
+	}
+
+	return cfg, r.items, nil
+}
+
+// accessory converts a service that is not the app into an accessory.
+func (f *File) accessory(name string, r *report) (config.Accessory, bool) {
+	service := f.Services[name]
+	if service.Image == "" {
+		r.add(name, "build", "accessories need an image, the service was skipped")
+		return config.Accessory{}, false
+	}
+
+	accessory := config.Accessory{
+		Name:    name,
+		Image:   service.Image,
+		Command: service.Command,
+		ENV:     f.envNames(name, service, r),
+		Volumes: volumeSpecs(service.Volumes),
+		Restart: service.Restart,
+	}
+
+	for _, port := range service.Ports {
+		if port.Published == "" {
+			continue
+		}
+		spec := port.Published + ":" + strconv.Itoa(port.Target)
+		if port.HostIP != "" {
+			spec = port.HostIP + ":" + spec
+		}
+		if port.Protocol != "" && port.Protocol != "tcp" {
+			spec += "/" + port.Protocol
+		}
+		accessory.Ports = append(accessory.Ports, spec)
+	}
+
+	if len(service.Networks) > 0 {
+		accessory.Network = service.Networks[0]
+		if len(service.Networks) > 1 {
+			r.add(name, "networks", "only the first network is joined")
+		}
+	}
+
+	for _, key := range []string{"entrypoint", "user", "working_dir", "labels", "healthcheck"} {
+		if service.has(key) {
+			r.add(name, key, "not supported on accessories")
+		}
+	}
+	r.unsupported(name, service.Other)
+
+	return accessory, true
+}
+
+// has reports whether a field handled for the app was set on the service.
+func (s Service) has(key string) bool {
+	switch key {
+	case "entrypoint":
+		return len(s.Entrypoint) > 0
+	case "user":
+		return s.User != ""
+	case "working_dir":
+		return s.WorkingDir != ""
+	case "labels":
+		return len(s.Labels) > 0
+	case "healthcheck":
+		return s.Healthcheck != nil
+	}
+	return false
+}
+
+// envNames returns the names of the env variables of a service. Slick reads
+// their values from the environment or the env file at deploy time, so the
+// values set in the compose file are reported.
+func (f *File) envNames(name string, service Service, r *report) []string {
+	var names []string
+	seen := map[string]bool{}
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			names = append(names, key)
+		}
+	}
+
+	hasValues := false
+	for _, entry := range service.Environment {
+		add(entry.key)
+		if entry.value != nil {
+			hasValues = true
+		}
+	}
+	if hasValues {
+		r.add(name, "environment", "values are not copied, set them in the env file passed with --env")
+	}
+
+	for _, envFile := range service.EnvFile {
+		path := envFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(f.dir, path)
+		}
+		values, err := godotenv.Read(path)
+		if err != nil {
+			r.add(name, "env_file", fmt.Sprintf("unable to read %s: %v", envFile, err))
+			continue
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			add(key)
+		}
+	}
+
+	return names
+}
+
+// volumeSpecs formats mounts as host:container[:ro] binds.
+func volumeSpecs(volumes []Volume) []string {
+	specs := make([]string, 0, len(volumes))
+	for _, volume := range volumes {
+		spec := volume.Target
+		if volume.Source != "" {
+			spec = volume.Source + ":" + volume.Target
+		}
+		if volume.ReadOnly {
+			spec += ":ro"
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	return specs
+}
+
+// convertHealthcheck maps a healthcheck that requests an HTTP URL, such as
+// curl -f http://localhost:3000/health, to a slick health check. It also
+// returns the port of the URL.
+func convertHealthcheck(h Healthcheck) (config.HealthCheck, int, error) {
+	var target *url.URL
+	for _, arg := range h.Test {
+		if !strings.HasPrefix(arg, "http://") && !strings.HasPrefix(arg, "https://") {
+			continue
+		}
+		u, err := url.Parse(arg)
+		if err == nil {
+			target = u
+			break
+		}
+	}
+	if target == nil {
+		return config.HealthCheck{}, 0, fmt.Errorf("only checks that request an HTTP URL can be converted")
+	}
+
+	health := config.HealthCheck{
+		Endpoint:   target.Path,
+		MaxRetries: h.Retries,
+	}
+	if health.Endpoint == "" {
+		health.Endpoint = "/"
+	}
+	if d, err := time.ParseDuration(h.Interval); err == nil {
+		health.IntervalSeconds = int(d.Seconds())
+	}
+	if d, err := time.ParseDuration(h.Timeout); err == nil {
+		health.TimeoutSeconds = int(d.Seconds())
+	}
+
+	port, _ := strconv.Atoi(target.Port())
+	return health, port, nil
+}
+
+// sanitizeDomain turns a service name into a valid host name label.
+func sanitizeDomain(name string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, name), "-")
+}
+
+// report collects the compose features that could not be mapped.
+type report struct {
+	items []string
+}
+
+func (r *report) add(service, feature, reason string) {
+	r.items = append(r.items, fmt.Sprintf("%s: %s: %s", service, feature, reason))
+}
+
+// unsupported reports every compose key slick does not read.
+func (r *report) unsupported(service string, other map[string]any) {
+	keys := make([]string, 0, len(other))
+	for key := range other {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "build" {
+			continue
+		}
+		r.add(service, key, "not supported")
+	}
+}
@@ -0,0 +1,186 @@
+package compose
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const composeFile = `
+services:
+  web:
+    image: ghcr.io/usememos/memos:latest
+    ports:
+      - "127.0.0.1:5230:5230/tcp"
+      - "9090"
+    environment:
+      DATABASE_URL: postgres://db
+      SECRET_KEY:
+    env_file: .env.web
+    volumes:
+      - memos:/var/opt/memos
+      - ./config:/etc/memos:ro
+    networks:
+      backend:
+        aliases: [app]
+    depends_on: [db]
+    healthcheck:
+      test: ["CMD", "curl", "-f", "http://localhost:5230/healthz"]
+      interval: 10s
+      timeout: 3s
+      retries: 5
+    command: serve --port 5230
+    restart: unless-stopped
+  db:
+    image: postgres:16
+    environment:
+      - POSTGRES_PASSWORD
+    ports:
+      - target: 5432
+        published: "5432"
+        host_ip: 127.0.0.1
+    volumes:
+      - type: volume
+        source: pg
+        target: /var/lib/postgresql/data
+    networks: [backend]
+  builder:
+    build: .
+`
+
+func loadTestFile(t *testing.T) *File {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env.web"), []byte("S3_BUCKET=memos\nSECRET_KEY=x\n"), 0o644))
+	path := filepath.Join(dir, "docker-compose.yml")
+	require.NoError(t, os.WriteFile(path, []byte(composeFile), 0o644))
+
+	f, err := Load(path)
+	require.NoError(t, err)
+	return f
+}
+
+func TestConvert(t *testing.T) {
+	f := loadTestFile(t)
+
+	cfg, unmapped, err := f.Convert("web", "memos.example.com")
+	require.NoError(t, err)
+
+	app := cfg.App
+	assert.Equal(t, "web", app.Name)
+	assert.Equal(t, "ghcr.io/usememos/memos:latest", app.ImageName)
+	assert.Equal(t, 5230, app.ContainerPort)
+	assert.Equal(t, "backend", app.Network)
+	assert.Equal(t, []string{"DATABASE_URL", "SECRET_KEY", "S3_BUCKET"}, app.ENV)
+	assert.Equal(t, []string{"memos:/var/opt/memos", "./config:/etc/memos:ro"}, app.Volumes)
+	assert.Equal(t, []string{"serve", "--port", "5230"}, app.Command)
+	assert.Equal(t, "unless-stopped", app.Restart)
+
+	assert.Equal(t, config.HealthCheck{
+		Endpoint:        "/healthz",
+		TimeoutSeconds:  3,
+		IntervalSeconds: 10,
+		MaxRetries:      5,
+	}, cfg.HealthCheck)
+
+	require.Len(t, cfg.Caddy.Rules, 1)
+	assert.Equal(t, "memos.example.com", cfg.Caddy.Rules[0].Match)
+	assert.Equal(t, "localhost:{port}", cfg.Caddy.Rules[0].ReverseProxy[0].To)
+
+	require.Len(t, cfg.Accessories, 1)
+	assert.Equal(t, config.Accessory{
+		Name:    "db",
+		Image:   "postgres:16",
+		ENV:     []string{"POSTGRES_PASSWORD"},
+		Volumes: []string{"pg:/var/lib/postgresql/data"},
+		Network: "backend",
+		Ports:   []string{"127.0.0.1:5432:5432"},
+	}, cfg.Accessories[0])
+
+	assert.Equal(t, []string{
+		"web: environment: values are not copied, set them in the env file passed with --env",
+		"web: ports: only the first port is routed through Caddy",
+		"web: depends_on: not supported",
+		"builder: build: accessories need an image, the service was skipped",
+	}, unmapped)
+}
+
+func TestConvert_DefaultDomain(t *testing.T) {
+	f, err := Parse([]byte("services:\n  My_App:\n    image: app\n    ports: [\"3000\"]\n"))
+	require.NoError(t, err)
+
+	cfg, _, err := f.Convert("My_App", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, "my-app.localhost", cfg.Caddy.Rules[0].Match)
+	assert.Equal(t, 3000, cfg.App.ContainerPort)
+}
+
+func TestConvert_Healthcheck(t *testing.T) {
+	f, err := Parse([]byte(`
+services:
+  app:
+    image: app
+    healthcheck:
+      test: pg_isready
+`))
+	require.NoError(t, err)
+
+	cfg, unmapped, err := f.Convert("app", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, config.HealthCheck{}, cfg.HealthCheck)
+	assert.Contains(t, unmapped, "app: healthcheck: only checks that request an HTTP URL can be converted")
+	assert.Contains(t, unmapped, "app: ports: no container port found, set app.container_port")
+}
+
+func TestPickService(t *testing.T) {
+	f := loadTestFile(t)
+
+	name, err := f.PickService("")
+	assert.Error(t, err)
+	assert.Empty(t, name)
+
+	name, err = f.PickService("db")
+	assert.NoError(t, err)
+	assert.Equal(t, "db", name)
+
+	_, err = f.PickService("redis")
+	assert.EqualError(t, err, "compose file has no service redis, expected one of builder, db, web")
+
+	single, err := Parse([]byte("services:\n  web:\n    image: app\n  worker:\n    image: app\n    ports: [\"80\"]\n"))
+	require.NoError(t, err)
+	name, err = single.PickService("")
+	assert.NoError(t, err)
+	assert.Equal(t, "worker", name)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, err := Parse([]byte("version: '3'\n"))
+	assert.EqualError(t, err, "compose file has no services")
+
+	_, err = Parse([]byte("services:\n  web:\n    ports: [\"http\"]\n"))
+	assert.Error(t, err)
+}
+
+func TestPort_ShortSyntax(t *testing.T) {
+	tests := map[string]Port{
+		"80":                  {Target: 80},
+		"8080:80":             {Published: "8080", Target: 80},
+		"127.0.0.1:8080:80":   {HostIP: "127.0.0.1", Published: "8080", Target: 80},
+		"[::1]:8080:80/udp":   {HostIP: "::1", Published: "8080", Target: 80, Protocol: "udp"},
+		"3000-3005":           {Target: 3000},
+		"9000-9005:3000-3005": {Published: "9000-9005", Target: 3000},
+	}
+
+	for spec, want := range tests {
+		t.Run(spec, func(t *testing.T) {
+			f, err := Parse([]byte("services:\n  web:\n    ports: [\"" + spec + "\"]\n"))
+			require.NoError(t, err)
+			assert.Equal(t, want, f.Services["web"].Ports[0])
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package compose
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// stringList is a list that compose also accepts as a single string.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*l = values
+	return nil
+}
+
+// command is a command in exec form, or a string split on whitespace.
+type command []string
+
+func (c *command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = strings.Fields(node.Value)
+		return nil
+	}
+
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*c = values
+	return nil
+}
+
+type entry struct {
+	key   string
+	value *string
+}
+
+// mapping is a key value list such as environment or labels, written either
+// as a map or as a list of KEY=VALUE. A key without a value has a nil value.
+type mapping []entry
+
+func (m *mapping) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			e := entry{key: node.Content[i].Value}
+			if value := node.Content[i+1]; value.Tag != "!!null" {
+				v := value.Value
+				e.value = &v
+			}
+			*m = append(*m, e)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			key, value, hasValue := strings.Cut(item.Value, "=")
+			e := entry{key: key}
+			if hasValue {
+				e.value = &value
+			}
+			*m = append(*m, e)
+		}
+	default:
+		return fmt.Errorf("line %d: expected a map or a list", node.Line)
+	}
+
+	return nil
+}
+
+// values returns the entries as a map, leaving out keys without a value.
+func (m mapping) values() map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+
+	values := map[string]string{}
+	for _, e := range m {
+		if e.value != nil {
+			values[e.key] = *e.value
+		}
+	}
+	return values
+}
+
+// networks is the list of networks of a service, in the order they are
+// written, from either a list or a map.
+type networks []string
+
+func (n *networks) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			*n = append(*n, node.Content[i].Value)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			*n = append(*n, item.Value)
+		}
+	default:
+		return fmt.Errorf("line %d: expected a map or a list of networks", node.Line)
+	}
+
+	return nil
+}
+
+// UnmarshalYAML reads [host_ip:][published:]target[/protocol] or the long
+// syntax.
+func (p *Port) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var long struct {
+			Target    int    `yaml:"target"`
+			Published string `yaml:"published"`
+			HostIP    string `yaml:"host_ip"`
+			Protocol  string `yaml:"protocol"`
+		}
+		if err := node.Decode(&long); err != nil {
+			return err
+		}
+		*p = Port{HostIP: long.HostIP, Published: long.Published, Target: long.Target, Protocol: long.Protocol}
+		return nil
+	}
+
+	spec, protocol, _ := strings.Cut(node.Value, "/")
+	parts := strings.Split(spec, ":")
+	// The host IP may be an IPv6 address in brackets.
+	if strings.HasPrefix(spec, "[") {
+		if end := strings.Index(spec, "]:"); end >= 0 {
+			parts = append([]string{spec[1:end]}, strings.Split(spec[end+2:], ":")...)
+		}
+	}
+
+	target := parts[len(parts)-1]
+	// Ranges map to several ports, use the first one.
+	target, _, _ = strings.Cut(target, "-")
+	port, err := strconv.Atoi(target)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid port %q", node.Line, node.Value)
+	}
+
+	*p = Port{Target: port, Protocol: protocol}
+	switch len(parts) {
+	case 2:
+		p.Published = parts[0]
+	case 3:
+		p.HostIP = parts[0]
+		p.Published = parts[1]
+	}
+
+	return nil
+}
+
+// UnmarshalYAML reads [source:]target[:mode] or the long syntax.
+func (v *Volume) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var long struct {
+			Source   string `yaml:"source"`
+			Target   string `yaml:"target"`
+			ReadOnly bool   `yaml:"read_only"`
+		}
+		if err := node.Decode(&long); err != nil {
+			return err
+		}
+		*v = Volume{Source: long.Source, Target: long.Target, ReadOnly: long.ReadOnly}
+		return nil
+	}
+
+	parts := strings.Split(node.Value, ":")
+	switch len(parts) {
+	case 1:
+		*v = Volume{Target: parts[0]}
+	case 2:
+		*v = Volume{Source: parts[0], Target: parts[1]}
+	default:
+		*v = Volume{Source: parts[0], Target: parts[1], ReadOnly: strings.Contains(parts[2], "ro")}
+	}
+
+	return nil
+}
@@ -1,10 +1,15 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -20,21 +25,59 @@ type RegistryConfig struct {
 	Password string `yaml:"password"`
 }
 
+// Ways an app container is exposed to Caddy.
+const (
+	// ExposePort publishes the container port on a host port.
+	ExposePort = "port"
+	// ExposeNetwork attaches the container to the app network under an
+	// alias, for when Caddy runs in a container on the same network.
+	ExposeNetwork = "network"
+)
+
 type App struct {
 	Name          string         `yaml:"name"`
 	ImageName     string         `yaml:"image"`
-	Registry      RegistryConfig `yaml:"registry"`
+	Registry      RegistryConfig `yaml:"registry,omitempty"`
 	ContainerPort int            `yaml:"container_port"`
-	Network       string         `yaml:"network"`
-	ENV           []string       `yaml:"env"`
-	PortRange     PortRange      `yaml:"port_range"`
-	Volumes       []string       `yaml:"volumes"`
+	Network       string         `yaml:"network,omitempty"`
+	Expose        string         `yaml:"expose,omitempty"`
+	BindAddress   string         `yaml:"bind_address,omitempty"`
+	ENV           []string       `yaml:"env,omitempty"`
+	PortRange     PortRange      `yaml:"port_range,omitempty"`
+	Volumes       []string       `yaml:"volumes,omitempty"`
+
+	// Container runtime options, named after their docker compose
+	// counterparts.
+	Command     []string          `yaml:"command,omitempty"`
+	Entrypoint  []string          `yaml:"entrypoint,omitempty"`
+	WorkingDir  string            `yaml:"working_dir,omitempty"`
+	User        string            `yaml:"user,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Restart     string            `yaml:"restart,omitempty"`
+	Memory      string            `yaml:"memory,omitempty"`
+	CPUs        float64           `yaml:"cpus,omitempty"`
+	Ulimits     []string          `yaml:"ulimits,omitempty"`
+	ExtraHosts  []string          `yaml:"extra_hosts,omitempty"`
+	CapAdd      []string          `yaml:"cap_add,omitempty"`
+	CapDrop     []string          `yaml:"cap_drop,omitempty"`
+	ReadOnly    bool              `yaml:"read_only,omitempty"`
+	Tmpfs       []string          `yaml:"tmpfs,omitempty"`
+	Logging     LoggingConfig     `yaml:"logging,omitempty"`
+	StopSignal  string            `yaml:"stop_signal,omitempty"`
+	StopTimeout int               `yaml:"stop_timeout,omitempty"`
+	ShmSize     string            `yaml:"shm_size,omitempty"`
+	Devices     []string          `yaml:"devices,omitempty"`
+}
+
+type LoggingConfig struct {
+	Driver  string            `yaml:"driver"`
+	Options map[string]string `yaml:"options"`
 }
 
 type ReverseProxy struct {
-	Path     string     `yaml:"path"`
+	Path     string     `yaml:"path,omitempty"`
 	To       string     `yaml:"to"`
-	HeaderUp []HeaderUp `yaml:"header_up"`
+	HeaderUp []HeaderUp `yaml:"header_up,omitempty"`
 }
 
 type Handle struct {
@@ -49,9 +92,9 @@ type HeaderUp struct {
 
 type Rule struct {
 	Match        string         `yaml:"match"`
-	Tls          string         `yaml:"tls"`
+	Tls          string         `yaml:"tls,omitempty"`
 	ReverseProxy []ReverseProxy `yaml:"reverse_proxy"`
-	Handle       []Handle       `yaml:"handle"`
+	Handle       []Handle       `yaml:"handle,omitempty"`
 }
 
 type OnDemandTlsConfig struct {
@@ -66,22 +109,142 @@ type GlobalOptions struct {
 }
 
 type CaddyConfig struct {
-	AdminAPI string        `yaml:"admin_api"`
-	Global   GlobalOptions `yaml:"global"`
+	AdminAPI string        `yaml:"admin_api,omitempty"`
+	Global   GlobalOptions `yaml:"global,omitempty"`
 	Rules    []Rule        `yaml:"rules"`
 }
 
 type HealthCheck struct {
 	Endpoint        string `yaml:"endpoint"`
-	TimeoutSeconds  int    `yaml:"timeout_seconds"`
-	IntervalSeconds int    `yaml:"interval_seconds"`
-	MaxRetries      int    `yaml:"max_retries"`
+	TimeoutSeconds  int    `yaml:"timeout_seconds,omitempty"`
+	IntervalSeconds int    `yaml:"interval_seconds,omitempty"`
+	MaxRetries      int    `yaml:"max_retries,omitempty"`
+}
+
+type WatchConfig struct {
+	IntervalSeconds  int    `yaml:"interval_seconds"`
+	FailureThreshold int    `yaml:"failure_threshold"`
+	Action           string `yaml:"action"`
+}
+
+type WebhookConfig struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+// NotificationEvents are the deploy events notifications can be filtered
+// on, the names of the deploy.EventType values that are delivered.
+var NotificationEvents = []string{
+	"deploy_started",
+	"image_pulled",
+	"health_passed",
+	"health_failed",
+	"traffic_switched",
+	"rolled_back",
+	"hook_failed",
+	"deploy_finished",
+	"deploy_failed",
+}
+
+type NotificationsConfig struct {
+	Events   []string        `yaml:"events"`
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Slack    []SlackConfig   `yaml:"slack"`
+	Commands []string        `yaml:"commands"`
+}
+
+// Hook is a step run around a deploy, either a one-off container from the
+// new image (Run) or a shell command on the host (Command).
+type Hook struct {
+	Name           string   `yaml:"name"`
+	Run            []string `yaml:"run"`
+	Command        string   `yaml:"command"`
+	TimeoutSeconds int      `yaml:"timeout_seconds"`
+}
+
+type HooksConfig struct {
+	PreDeploy  []Hook `yaml:"pre_deploy"`
+	PostDeploy []Hook `yaml:"post_deploy"`
+	OnFailure  []Hook `yaml:"on_failure"`
+}
+
+// Accessory is a long-lived service, such as a database, that runs next to
+// the app. It is started once and kept running across deploys.
+type Accessory struct {
+	Name    string   `yaml:"name"`
+	Image   string   `yaml:"image"`
+	Command []string `yaml:"command,omitempty"`
+	ENV     []string `yaml:"env,omitempty"`
+	Volumes []string `yaml:"volumes,omitempty"`
+	Network string   `yaml:"network,omitempty"`
+	Ports   []string `yaml:"ports,omitempty"`
+	Restart string   `yaml:"restart,omitempty"`
+}
+
+// Worker is a process without HTTP traffic, such as a queue consumer, run
+// from the app image and replaced on every deploy.
+type Worker struct {
+	Name    string   `yaml:"name"`
+	Command []string `yaml:"command"`
+}
+
+// What a fleet deploy does when a server fails.
+const (
+	// FleetRollback stops the rollout and rolls the updated servers back.
+	FleetRollback = "rollback"
+	// FleetAbort stops the rollout and leaves the updated servers as they are.
+	FleetAbort = "abort"
+	// FleetContinue deploys to the remaining servers anyway.
+	FleetContinue = "continue"
+)
+
+type FleetConfig struct {
+	// Parallelism is how many servers are deployed to at once.
+	Parallelism int    `yaml:"parallelism"`
+	OnFailure   string `yaml:"on_failure"`
+}
+
+type PruneConfig struct {
+	// KeepImages is how many of the most recently deployed images of the
+	// app are kept around for rollbacks.
+	KeepImages int `yaml:"keep_images"`
+	// AfterDeploy prunes the server after every successful deploy.
+	AfterDeploy bool `yaml:"after_deploy"`
 }
 
 type DeploymentConfig struct {
-	App         App         `yaml:"app"`
-	Caddy       CaddyConfig `yaml:"caddy"`
-	HealthCheck HealthCheck `yaml:"health_check"`
+	App           App                 `yaml:"app"`
+	Caddy         CaddyConfig         `yaml:"caddy"`
+	HealthCheck   HealthCheck         `yaml:"health_check,omitempty"`
+	Watch         WatchConfig         `yaml:"watch,omitempty"`
+	Notifications NotificationsConfig `yaml:"notifications,omitempty"`
+	Hooks         HooksConfig         `yaml:"hooks,omitempty"`
+	Accessories   []Accessory         `yaml:"accessories,omitempty"`
+	Workers       []Worker            `yaml:"workers,omitempty"`
+	// Servers are ssh:// URLs of the hosts a deploy rolls out to.
+	Servers []string    `yaml:"servers,omitempty"`
+	Fleet   FleetConfig `yaml:"fleet,omitempty"`
+	Prune   PruneConfig `yaml:"prune,omitempty"`
+}
+
+// Hash returns a short fingerprint of the config, used to tell whether two
+// deploys ran with the same settings. It ends up in container labels, so
+// the registry credentials and the notification settings, which hold
+// secrets, are left out.
+func (c DeploymentConfig) Hash() string {
+	c.App.Registry = RegistryConfig{}
+	c.Notifications = NotificationsConfig{}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
 }
 
 func replaceEnvVariables(input string) string {
@@ -117,6 +280,8 @@ func LoadConfig(path string) (DeploymentConfig, error) {
 	// Create a default deployment config
 	c := DeploymentConfig{
 		App: App{
+			Expose:      ExposePort,
+			BindAddress: "127.0.0.1",
 			PortRange: PortRange{
 				Start: 8000,
 				End:   9000,
@@ -130,6 +295,18 @@ func LoadConfig(path string) (DeploymentConfig, error) {
 			IntervalSeconds: 5,
 			MaxRetries:      3,
 		},
+		Watch: WatchConfig{
+			IntervalSeconds:  30,
+			FailureThreshold: 3,
+			Action:           "restart",
+		},
+		Fleet: FleetConfig{
+			Parallelism: 1,
+			OnFailure:   FleetRollback,
+		},
+		Prune: PruneConfig{
+			KeepImages: 3,
+		},
 	}
 
 	// Override the default config with the config file
@@ -143,6 +320,88 @@ func LoadConfig(path string) (DeploymentConfig, error) {
 		c.Caddy.Rules[i].Tls = newTlsValue
 	}
 
+	for i, webhook := range c.Notifications.Webhooks {
+		c.Notifications.Webhooks[i].URL = replaceEnvVariables(webhook.URL)
+		if envValue, exists := os.LookupEnv(webhook.Secret); exists && webhook.Secret != "" {
+			c.Notifications.Webhooks[i].Secret = envValue
+		}
+	}
+
+	for i, slack := range c.Notifications.Slack {
+		c.Notifications.Slack[i].WebhookURL = replaceEnvVariables(slack.WebhookURL)
+	}
+
+	for _, event := range c.Notifications.Events {
+		if !slices.Contains(NotificationEvents, event) {
+			return c, fmt.Errorf("invalid notifications event %q, expected one of %s", event, strings.Join(NotificationEvents, ", "))
+		}
+	}
+
+	stages := []struct {
+		name  string
+		hooks []Hook
+	}{
+		{"pre_deploy", c.Hooks.PreDeploy},
+		{"post_deploy", c.Hooks.PostDeploy},
+		{"on_failure", c.Hooks.OnFailure},
+	}
+	for _, stage := range stages {
+		for i, hook := range stage.hooks {
+			if (len(hook.Run) == 0) == (hook.Command == "") {
+				return c, fmt.Errorf("%s hook %d must set exactly one of run or command", stage.name, i+1)
+			}
+		}
+	}
+
+	switch c.App.Expose {
+	case ExposePort:
+	case ExposeNetwork:
+		if c.App.Network == "" {
+			return c, fmt.Errorf("app.network must be set when app.expose is %q", ExposeNetwork)
+		}
+		// The container publishes no host port, Caddy can only reach it
+		// through its network alias.
+		for i, rule := range c.Caddy.Rules {
+			for _, proxy := range rule.ReverseProxy {
+				if !strings.Contains(proxy.To, "{upstream}") {
+					return c, fmt.Errorf("caddy rule %d proxies to %q, use {upstream} when app.expose is %q", i+1, proxy.To, ExposeNetwork)
+				}
+			}
+		}
+	default:
+		return c, fmt.Errorf("invalid app.expose %q, expected %s or %s", c.App.Expose, ExposePort, ExposeNetwork)
+	}
+
+	if err := validateRuntime(c.App); err != nil {
+		return c, err
+	}
+
+	if err := validateServices(&c); err != nil {
+		return c, err
+	}
+
+	if net.ParseIP(c.App.BindAddress) == nil {
+		return c, fmt.Errorf("invalid app.bind_address %q, expected an IPv4 or IPv6 address", c.App.BindAddress)
+	}
+
+	if err := validateFleet(c); err != nil {
+		return c, err
+	}
+
+	if c.Prune.KeepImages < 1 {
+		return c, fmt.Errorf("invalid prune.keep_images %d, expected at least 1", c.Prune.KeepImages)
+	}
+
+	if c.Watch.IntervalSeconds < 1 {
+		return c, fmt.Errorf("invalid watch.interval_seconds %d, expected at least 1", c.Watch.IntervalSeconds)
+	}
+	if c.Watch.FailureThreshold < 1 {
+		return c, fmt.Errorf("invalid watch.failure_threshold %d, expected at least 1", c.Watch.FailureThreshold)
+	}
+	if c.Watch.Action != "restart" && c.Watch.Action != "redeploy" {
+		return c, fmt.Errorf("invalid watch action %q, expected restart or redeploy", c.Watch.Action)
+	}
+
 	if c.App.Registry.Username != "" && c.App.Registry.Password != "" {
 		envValue, exists := os.LookupEnv(c.App.Registry.Password)
 		if exists {
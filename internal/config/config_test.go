@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -200,3 +201,299 @@ app:
 
 	assert.Equal(t, []string{"/data:/data"}, config.App.Volumes)
 }
+
+func TestLoadConfigWatch(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+app:
+  name: "Test App"
+watch:
+  interval_seconds: 10
+  action: "redeploy"
+`)
+	require.NoError(t, err)
+	err = tempFile.Close()
+	require.NoError(t, err)
+
+	config, err := LoadConfig(tempFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, 10, config.Watch.IntervalSeconds)
+	assert.Equal(t, 3, config.Watch.FailureThreshold)
+	assert.Equal(t, "redeploy", config.Watch.Action)
+}
+
+func TestLoadConfigWatchInvalidAction(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+watch:
+  action: "panic"
+`)
+	require.NoError(t, err)
+	err = tempFile.Close()
+	require.NoError(t, err)
+
+	_, err = LoadConfig(tempFile.Name())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid watch action")
+}
+
+func TestLoadConfigWatchInvalidNumbers(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"zero interval", "watch:\n  interval_seconds: 0\n", "invalid watch.interval_seconds 0"},
+		{"negative interval", "watch:\n  interval_seconds: -5\n", "invalid watch.interval_seconds -5"},
+		{"zero threshold", "watch:\n  failure_threshold: 0\n", "invalid watch.failure_threshold 0"},
+		{"negative threshold", "watch:\n  failure_threshold: -1\n", "invalid watch.failure_threshold -1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "slick.yml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.yaml), 0o644))
+
+			_, err := LoadConfig(path)
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestLoadConfigPrune(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+app:
+  name: "Test App"
+prune:
+  after_deploy: true
+`)
+	require.NoError(t, err)
+	err = tempFile.Close()
+	require.NoError(t, err)
+
+	config, err := LoadConfig(tempFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, config.Prune.KeepImages)
+	assert.True(t, config.Prune.AfterDeploy)
+}
+
+func TestLoadConfigPruneDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slick.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("app:\n  name: \"Test App\"\n"), 0644))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, config.Prune.KeepImages)
+	assert.False(t, config.Prune.AfterDeploy)
+}
+
+func TestLoadConfigPruneInvalidKeepImages(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+prune:
+  keep_images: 0
+`)
+	require.NoError(t, err)
+	err = tempFile.Close()
+	require.NoError(t, err)
+
+	_, err = LoadConfig(tempFile.Name())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid prune.keep_images")
+}
+
+func TestLoadConfigNotifications(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+notifications:
+  events: ["deploy_finished"]
+  webhooks:
+    - url: "https://hooks.example.com/{env.TEST_HOOK_PATH}"
+      secret: TEST_HOOK_SECRET
+  slack:
+    - webhook_url: "{env.TEST_SLACK_URL}"
+  commands:
+    - "echo deployed"
+`)
+	require.NoError(t, err)
+	err = tempFile.Close()
+	require.NoError(t, err)
+
+	t.Setenv("TEST_HOOK_PATH", "deploys")
+	t.Setenv("TEST_HOOK_SECRET", "s3cret")
+	t.Setenv("TEST_SLACK_URL", "https://hooks.slack.com/services/T000")
+
+	config, err := LoadConfig(tempFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"deploy_finished"}, config.Notifications.Events)
+	assert.Equal(t, "https://hooks.example.com/deploys", config.Notifications.Webhooks[0].URL)
+	assert.Equal(t, "s3cret", config.Notifications.Webhooks[0].Secret)
+	assert.Equal(t, "https://hooks.slack.com/services/T000", config.Notifications.Slack[0].WebhookURL)
+	assert.Equal(t, []string{"echo deployed"}, config.Notifications.Commands)
+}
+
+func TestLoadConfigNotificationsInvalidEvent(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+notifications:
+  events: ["deploy_finshed"]
+`)
+	require.NoError(t, err)
+	err = tempFile.Close()
+	require.NoError(t, err)
+
+	_, err = LoadConfig(tempFile.Name())
+	assert.ErrorContains(t, err, `invalid notifications event "deploy_finshed"`)
+}
+
+func TestLoadConfigHooks(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+hooks:
+  pre_deploy:
+    - name: "migrate"
+      run: ["bundle", "exec", "rails", "db:migrate"]
+      timeout_seconds: 300
+  post_deploy:
+    - command: "./scripts/warm-cache.sh"
+  on_failure:
+    - command: "echo failed"
+`)
+	require.NoError(t, err)
+	err = tempFile.Close()
+	require.NoError(t, err)
+
+	config, err := LoadConfig(tempFile.Name())
+	require.NoError(t, err)
+
+	require.Len(t, config.Hooks.PreDeploy, 1)
+	assert.Equal(t, "migrate", config.Hooks.PreDeploy[0].Name)
+	assert.Equal(t, []string{"bundle", "exec", "rails", "db:migrate"}, config.Hooks.PreDeploy[0].Run)
+	assert.Equal(t, 300, config.Hooks.PreDeploy[0].TimeoutSeconds)
+	assert.Equal(t, "./scripts/warm-cache.sh", config.Hooks.PostDeploy[0].Command)
+	assert.Equal(t, "echo failed", config.Hooks.OnFailure[0].Command)
+}
+
+func TestLoadConfigHooksInvalid(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+hooks:
+  pre_deploy:
+    - name: "both"
+      run: ["migrate"]
+      command: "migrate"
+`)
+	require.NoError(t, err)
+	err = tempFile.Close()
+	require.NoError(t, err)
+
+	_, err = LoadConfig(tempFile.Name())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "pre_deploy hook 1 must set exactly one of run or command")
+}
+
+func TestLoadConfigExpose(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		expose  string
+		wantErr string
+	}{
+		{"default", "app:\n  name: memos\n", ExposePort, ""},
+		{"network", "app:\n  network: web\n  expose: network\n", ExposeNetwork, ""},
+		{"network without name", "app:\n  expose: network\n", "", "app.network must be set"},
+		{"network with port upstream", "app:\n  network: web\n  expose: network\ncaddy:\n  rules:\n    - match: memos.example.com\n      reverse_proxy:\n        - to: localhost:{port}\n", "", "use {upstream}"},
+		{"network with upstream", "app:\n  network: web\n  expose: network\ncaddy:\n  rules:\n    - match: memos.example.com\n      reverse_proxy:\n        - to: \"{upstream}\"\n", ExposeNetwork, ""},
+		{"invalid", "app:\n  expose: magic\n", "", "invalid app.expose"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempFile, err := os.CreateTemp("", "*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tempFile.Name())
+			_, err = tempFile.WriteString(tt.yaml)
+			require.NoError(t, err)
+			require.NoError(t, tempFile.Close())
+
+			config, err := LoadConfig(tempFile.Name())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expose, config.App.Expose)
+		})
+	}
+}
+
+func TestLoadConfigBindAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		address string
+		wantErr bool
+	}{
+		{"default", "app:\n  name: memos\n", "127.0.0.1", false},
+		{"ipv6", "app:\n  bind_address: \"::1\"\n", "::1", false},
+		{"public", "app:\n  bind_address: 0.0.0.0\n", "0.0.0.0", false},
+		{"invalid", "app:\n  bind_address: localhost\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempFile, err := os.CreateTemp("", "*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tempFile.Name())
+			_, err = tempFile.WriteString(tt.yaml)
+			require.NoError(t, err)
+			require.NoError(t, tempFile.Close())
+
+			config, err := LoadConfig(tempFile.Name())
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "invalid app.bind_address")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.address, config.App.BindAddress)
+		})
+	}
+}
+
+func TestDeploymentConfigHash(t *testing.T) {
+	cfg := DeploymentConfig{App: App{Name: "memos", ImageName: "memos:1"}}
+	same := DeploymentConfig{App: App{Name: "memos", ImageName: "memos:1"}}
+	changed := DeploymentConfig{App: App{Name: "memos", ImageName: "memos:2"}}
+
+	assert.Len(t, cfg.Hash(), 12)
+	assert.Equal(t, cfg.Hash(), same.Hash())
+	assert.NotEqual(t, cfg.Hash(), changed.Hash())
+
+	// Secrets do not change the fingerprint, so it cannot confirm them.
+	secret := cfg
+	secret.App.Registry = RegistryConfig{Username: "deploy", Password: "hunter2"}
+	secret.Notifications.Webhooks = []WebhookConfig{{URL: "https://hooks.example.com/abc", Secret: "s3cr3t"}}
+	secret.Notifications.Slack = []SlackConfig{{WebhookURL: "https://hooks.slack.com/services/T0/B0/xyz"}}
+	assert.Equal(t, cfg.Hash(), secret.Hash())
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+)
+
+// ReservedLabelPrefix starts the labels slick finds its containers by.
+const ReservedLabelPrefix = "slick."
+
+var restartPolicies = map[string]bool{
+	"no":             true,
+	"always":         true,
+	"unless-stopped": true,
+	"on-failure":     true,
+}
+
+// ParseRestartPolicy splits a restart policy such as "on-failure:5" into its
+// name and maximum retry count.
+func ParseRestartPolicy(policy string) (string, int, error) {
+	name, retries, hasRetries := strings.Cut(policy, ":")
+	if !restartPolicies[name] {
+		return "", 0, fmt.Errorf("invalid restart policy %q, expected no, always, unless-stopped or on-failure[:max-retries]", policy)
+	}
+
+	if !hasRetries {
+		return name, 0, nil
+	}
+
+	if name != "on-failure" {
+		return "", 0, fmt.Errorf("invalid restart policy %q, only on-failure takes a retry count", policy)
+	}
+
+	count, err := strconv.Atoi(retries)
+	if err != nil || count < 0 {
+		return "", 0, fmt.Errorf("invalid restart policy %q, retry count must be a positive number", policy)
+	}
+
+	return name, count, nil
+}
+
+// Device is a host device mapped into the container.
+type Device struct {
+	PathOnHost        string
+	PathInContainer   string
+	CgroupPermissions string
+}
+
+// ParseDevice parses a device mapping in the docker run format,
+// host-path[:container-path[:permissions]].
+func ParseDevice(device string) (Device, error) {
+	parts := strings.Split(device, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return Device{}, fmt.Errorf("invalid device %q, expected host-path[:container-path[:permissions]]", device)
+	}
+
+	d := Device{
+		PathOnHost:        parts[0],
+		PathInContainer:   parts[0],
+		CgroupPermissions: "rwm",
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		d.PathInContainer = parts[1]
+	}
+	if len(parts) > 2 {
+		d.CgroupPermissions = parts[2]
+		for _, perm := range d.CgroupPermissions {
+			if !strings.ContainsRune("rwm", perm) {
+				return Device{}, fmt.Errorf("invalid device %q, permissions must be a combination of r, w and m", device)
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// ParseTmpfs splits a tmpfs mount such as "/tmp:size=64m" into its path and
+// mount options.
+func ParseTmpfs(tmpfs string) (string, string) {
+	path, options, _ := strings.Cut(tmpfs, ":")
+	return path, options
+}
+
+// validateRuntime checks the container runtime options of the app.
+func validateRuntime(app App) error {
+	if app.Restart != "" {
+		if _, _, err := ParseRestartPolicy(app.Restart); err != nil {
+			return err
+		}
+	}
+
+	if app.Memory != "" {
+		if _, err := units.RAMInBytes(app.Memory); err != nil {
+			return fmt.Errorf("invalid memory %q: %w", app.Memory, err)
+		}
+	}
+
+	if app.ShmSize != "" {
+		if _, err := units.RAMInBytes(app.ShmSize); err != nil {
+			return fmt.Errorf("invalid shm_size %q: %w", app.ShmSize, err)
+		}
+	}
+
+	if app.CPUs < 0 {
+		return fmt.Errorf("invalid cpus %v, must not be negative", app.CPUs)
+	}
+
+	if app.StopTimeout < 0 {
+		return fmt.Errorf("invalid stop_timeout %d, must not be negative", app.StopTimeout)
+	}
+
+	for key := range app.Labels {
+		if strings.HasPrefix(key, ReservedLabelPrefix) {
+			return fmt.Errorf("invalid label %q, the %s prefix is reserved for slick", key, ReservedLabelPrefix)
+		}
+	}
+
+	for _, ulimit := range app.Ulimits {
+		if _, err := units.ParseUlimit(ulimit); err != nil {
+			return fmt.Errorf("invalid ulimit %q: %w", ulimit, err)
+		}
+	}
+
+	for _, host := range app.ExtraHosts {
+		name, ip, ok := strings.Cut(host, ":")
+		if !ok || name == "" || (ip != "host-gateway" && net.ParseIP(ip) == nil) {
+			return fmt.Errorf("invalid extra host %q, expected hostname:ip", host)
+		}
+	}
+
+	for _, tmpfs := range app.Tmpfs {
+		if path, _ := ParseTmpfs(tmpfs); !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid tmpfs %q, the path must be absolute", tmpfs)
+		}
+	}
+
+	for _, device := range app.Devices {
+		if _, err := ParseDevice(device); err != nil {
+			return err
+		}
+	}
+
+	if app.Logging.Driver == "" && len(app.Logging.Options) > 0 {
+		return fmt.Errorf("logging options require a logging driver")
+	}
+
+	return nil
+}
+
+var serviceName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// validateServices checks the accessories and workers and fills in their
+// defaults.
+func validateServices(c *DeploymentConfig) error {
+	seen := map[string]bool{}
+	checkName := func(kind, name string) error {
+		if !serviceName.MatchString(name) {
+			return fmt.Errorf("invalid %s name %q", kind, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate accessory or worker name %q", name)
+		}
+		seen[name] = true
+		return nil
+	}
+
+	for i, accessory := range c.Accessories {
+		if err := checkName("accessory", accessory.Name); err != nil {
+			return err
+		}
+		if accessory.Image == "" {
+			return fmt.Errorf("accessory %s must set an image", accessory.Name)
+		}
+		if accessory.Network == "" {
+			c.Accessories[i].Network = c.App.Network
+		}
+		if accessory.Restart == "" {
+			c.Accessories[i].Restart = "unless-stopped"
+		}
+		if _, _, err := ParseRestartPolicy(c.Accessories[i].Restart); err != nil {
+			return fmt.Errorf("accessory %s: %w", accessory.Name, err)
+		}
+	}
+
+	for _, worker := range c.Workers {
+		if err := checkName("worker", worker.Name); err != nil {
+			return err
+		}
+		if len(worker.Command) == 0 {
+			return fmt.Errorf("worker %s must set a command", worker.Name)
+		}
+	}
+
+	return nil
+}
+
+// validateFleet checks the servers and how they are rolled out to.
+func validateFleet(c DeploymentConfig) error {
+	seen := map[string]bool{}
+	for _, server := range c.Servers {
+		u, err := url.Parse(server)
+		if err != nil || u.Scheme != "ssh" || u.Hostname() == "" {
+			return fmt.Errorf("invalid server %q, expected ssh://[user@]host[:port]", server)
+		}
+		if seen[server] {
+			return fmt.Errorf("duplicate server %q", server)
+		}
+		seen[server] = true
+	}
+
+	if c.Fleet.Parallelism < 1 {
+		return fmt.Errorf("invalid fleet.parallelism %d, expected at least 1", c.Fleet.Parallelism)
+	}
+
+	switch c.Fleet.OnFailure {
+	case FleetRollback, FleetAbort, FleetContinue:
+	default:
+		return fmt.Errorf("invalid fleet.on_failure %q, expected %s, %s or %s", c.Fleet.OnFailure, FleetRollback, FleetAbort, FleetContinue)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	name, retries, err := ParseRestartPolicy("on-failure:5")
+	require.NoError(t, err)
+	assert.Equal(t, "on-failure", name)
+	assert.Equal(t, 5, retries)
+
+	name, retries, err = ParseRestartPolicy("unless-stopped")
+	require.NoError(t, err)
+	assert.Equal(t, "unless-stopped", name)
+	assert.Equal(t, 0, retries)
+
+	for _, invalid := range []string{"sometimes", "always:3", "on-failure:x", "on-failure:-1"} {
+		_, _, err := ParseRestartPolicy(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseDevice(t *testing.T) {
+	device, err := ParseDevice("/dev/ttyUSB0")
+	require.NoError(t, err)
+	assert.Equal(t, Device{PathOnHost: "/dev/ttyUSB0", PathInContainer: "/dev/ttyUSB0", CgroupPermissions: "rwm"}, device)
+
+	device, err = ParseDevice("/dev/sda:/dev/xvda:r")
+	require.NoError(t, err)
+	assert.Equal(t, Device{PathOnHost: "/dev/sda", PathInContainer: "/dev/xvda", CgroupPermissions: "r"}, device)
+
+	_, err = ParseDevice("/dev/sda:/dev/xvda:rx")
+	assert.Error(t, err)
+	_, err = ParseDevice("")
+	assert.Error(t, err)
+}
+
+func TestLoadConfigRuntimeOptions(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+app:
+  name: memos
+  command: ["serve", "--port", "5230"]
+  user: "1000"
+  restart: unless-stopped
+  memory: 512m
+  cpus: 0.5
+  ulimits: ["nofile=1024:2048"]
+  extra_hosts: ["db:10.0.0.2", "host.docker.internal:host-gateway"]
+  cap_drop: ["ALL"]
+  read_only: true
+  tmpfs: ["/tmp"]
+  logging:
+    driver: json-file
+    options:
+      max-size: 10m
+  stop_signal: SIGQUIT
+  stop_timeout: 30
+  shm_size: 64m
+`)
+	require.NoError(t, err)
+	require.NoError(t, tempFile.Close())
+
+	config, err := LoadConfig(tempFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"serve", "--port", "5230"}, config.App.Command)
+	assert.Equal(t, "unless-stopped", config.App.Restart)
+	assert.Equal(t, 0.5, config.App.CPUs)
+	assert.Equal(t, "10m", config.App.Logging.Options["max-size"])
+	assert.Equal(t, 30, config.App.StopTimeout)
+}
+
+func TestLoadConfigInvalidRuntimeOptions(t *testing.T) {
+	tests := map[string]string{
+		"restart":     "app:\n  restart: sometimes\n",
+		"memory":      "app:\n  memory: lots\n",
+		"cpus":        "app:\n  cpus: -1\n",
+		"ulimit":      "app:\n  ulimits: [\"nofile\"]\n",
+		"extra host":  "app:\n  extra_hosts: [\"db\"]\n",
+		"tmpfs":       "app:\n  tmpfs: [\"tmp\"]\n",
+		"device":      "app:\n  devices: [\"/dev/a:/dev/b:x\"]\n",
+		"log options": "app:\n  logging:\n    options:\n      max-size: 10m\n",
+		"shm size":    "app:\n  shm_size: big\n",
+		"slick label": "app:\n  labels:\n    slick.app: other\n",
+	}
+
+	for name, yaml := range tests {
+		t.Run(name, func(t *testing.T) {
+			tempFile, err := os.CreateTemp("", "*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tempFile.Name())
+			_, err = tempFile.WriteString(yaml)
+			require.NoError(t, err)
+			require.NoError(t, tempFile.Close())
+
+			_, err = LoadConfig(tempFile.Name())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadConfigAccessoriesAndWorkers(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+app:
+  name: memos
+  network: web
+accessories:
+  - name: redis
+    image: redis:7
+    volumes: ["redis_data:/data"]
+workers:
+  - name: jobs
+    command: ["bundle", "exec", "sidekiq"]
+`)
+	require.NoError(t, err)
+	require.NoError(t, tempFile.Close())
+
+	config, err := LoadConfig(tempFile.Name())
+	require.NoError(t, err)
+
+	require.Len(t, config.Accessories, 1)
+	assert.Equal(t, "web", config.Accessories[0].Network)
+	assert.Equal(t, "unless-stopped", config.Accessories[0].Restart)
+	require.Len(t, config.Workers, 1)
+	assert.Equal(t, []string{"bundle", "exec", "sidekiq"}, config.Workers[0].Command)
+}
+
+func TestLoadConfigInvalidServices(t *testing.T) {
+	tests := map[string]string{
+		"accessory without image": "accessories:\n  - name: redis\n",
+		"accessory without name":  "accessories:\n  - image: redis\n",
+		"worker without command":  "workers:\n  - name: jobs\n",
+		"duplicate name":          "accessories:\n  - name: jobs\n    image: redis\nworkers:\n  - name: jobs\n    command: [run]\n",
+		"bad restart":             "accessories:\n  - name: redis\n    image: redis\n    restart: sometimes\n",
+	}
+
+	for name, yaml := range tests {
+		t.Run(name, func(t *testing.T) {
+			tempFile, err := os.CreateTemp("", "*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tempFile.Name())
+			_, err = tempFile.WriteString(yaml)
+			require.NoError(t, err)
+			require.NoError(t, tempFile.Close())
+
+			_, err = LoadConfig(tempFile.Name())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadConfigServers(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+servers:
+  - ssh://deploy@web1.example.com
+  - ssh://deploy@web2.example.com:2222
+fleet:
+  parallelism: 2
+`)
+	require.NoError(t, err)
+	require.NoError(t, tempFile.Close())
+
+	config, err := LoadConfig(tempFile.Name())
+	require.NoError(t, err)
+
+	assert.Len(t, config.Servers, 2)
+	assert.Equal(t, 2, config.Fleet.Parallelism)
+	assert.Equal(t, FleetRollback, config.Fleet.OnFailure)
+}
+
+func TestLoadConfigInvalidFleet(t *testing.T) {
+	tests := map[string]string{
+		"not ssh":            "servers: [\"web1.example.com\"]\n",
+		"duplicate server":   "servers: [\"ssh://web1\", \"ssh://web1\"]\n",
+		"zero parallelism":   "fleet:\n  parallelism: 0\n",
+		"unknown on_failure": "fleet:\n  on_failure: retry\n",
+	}
+
+	for name, yaml := range tests {
+		t.Run(name, func(t *testing.T) {
+			tempFile, err := os.CreateTemp("", "*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tempFile.Name())
+			_, err = tempFile.WriteString(yaml)
+			require.NoError(t, err)
+			require.NoError(t, tempFile.Close())
+
+			_, err = LoadConfig(tempFile.Name())
+			assert.Error(t, err)
+		})
+	}
+}
@@ -3,86 +3,324 @@ package deploy
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/signal"
-	"syscall"
+	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/scmmishra/slick-deploy/internal/caddy"
 	"github.com/scmmishra/slick-deploy/internal/config"
 	"github.com/scmmishra/slick-deploy/internal/docker"
 	"github.com/scmmishra/slick-deploy/internal/health"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/scmmishra/slick-deploy/internal/state"
 )
 
-func Deploy(cfg config.DeploymentConfig) error {
-	fmt.Println("Deploying...")
+// rollbackTimeout bounds the cleanup of a failed or cancelled deploy.
+const rollbackTimeout = 30 * time.Second
+
+// Options describes who or what triggered a deploy. The values end up in
+// the deploy history and the labels of the new container.
+type Options struct {
+	GitSHA   string
+	Deployer string
+	// Host is the server to deploy to over SSH, the local Docker daemon
+	// and Caddy when nil.
+	Host *remote.Host
+	// Restart rolls out an image that was deployed before: it is only
+	// pulled when missing from the server and the pre_deploy and
+	// post_deploy hooks are not run again.
+	Restart bool
+}
+
+// deployment carries what every step of a single deploy needs to report
+// its progress.
+type deployment struct {
+	cfg    config.DeploymentConfig
+	id     string
+	meta   docker.Metadata
+	bus    *EventBus
+	store  *state.Store
+	docker *docker.DockerService
+	host   *remote.Host
+	// restart is Options.Restart.
+	restart bool
+}
+
+func (d *deployment) publish(eventType EventType, message string, err error) {
+	e := Event{
+		Type:     eventType,
+		App:      d.cfg.App.Name,
+		Host:     d.host.Name(),
+		DeployID: d.id,
+		Image:    d.cfg.App.ImageName,
+		Message:  message,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	d.bus.Publish(e)
+}
+
+// Deploy rolls out cfg.App, reporting progress on bus, and records the
+// outcome in the deploy history. Cancelling ctx aborts the deploy and rolls
+// back the new container, leaving the old one serving traffic.
+func Deploy(ctx context.Context, cfg config.DeploymentConfig, bus *EventBus, opts Options) error {
+	store := state.NewStore(state.DefaultDir())
+	record := state.Deployment{
+		ID:         state.NewDeploymentID(time.Now()),
+		App:        cfg.App.Name,
+		Image:      cfg.App.ImageName,
+		GitSHA:     opts.GitSHA,
+		Deployer:   opts.Deployer,
+		ConfigHash: cfg.Hash(),
+		Host:       opts.Host.Name(),
+		StartedAt:  time.Now(),
+	}
+
+	meta := docker.Metadata{
+		DeployID:   record.ID,
+		GitSHA:     record.GitSHA,
+		Deployer:   record.Deployer,
+		ConfigHash: record.ConfigHash,
+		DeployedAt: record.StartedAt,
+	}
+
+	d := &deployment{cfg: cfg, id: record.ID, meta: meta, bus: bus, store: store, host: opts.Host, restart: opts.Restart}
+	d.publish(EventDeployStarted, "", nil)
+
+	newContainer, err := d.run(ctx)
+	if newContainer != nil {
+		record.ContainerID = newContainer.ID
+		record.Port = newContainer.Port
+	}
+
+	record.FinishedAt = time.Now()
+	record.Status = state.StatusSucceeded
+	if err != nil {
+		record.Status = state.StatusFailed
+		record.Error = err.Error()
+		// on_failure hooks are best effort, the deploy already failed
+		_ = d.runHooks(context.WithoutCancel(ctx), StageOnFailure, cfg.Hooks.OnFailure, d.docker)
+		d.publish(EventDeployFailed, "", err)
+	} else {
+		d.publish(EventDeployFinished, "", nil)
+	}
+
+	if recordErr := store.Record(record); recordErr != nil {
+		slog.Warn("Unable to record deployment", "error", recordErr)
+	}
+
+	if err == nil && cfg.Prune.AfterDeploy {
+		d.prune(ctx)
+	}
+
+	return err
+}
+
+func (d *deployment) run(ctx context.Context) (*docker.Container, error) {
+	cfg := d.cfg
 
 	// Initialize Docker client
-	cli, err := docker.NewDockerClient()
+	cli, err := d.dockerClient()
 	if err != nil {
-		return fmt.Errorf("failed to create Docker client: %w", err)
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
 	}
 
 	// Create DockerService instance
 	dockerService := docker.NewDockerService(cli)
+	dockerService.Store = d.store
+	dockerService.Remote = d.host != nil
+	dockerService.Server = d.host.Name()
+	d.docker = dockerService
 
-	err = dockerService.PullImage(cfg.App.ImageName, cfg.App.Registry)
-	if err != nil {
-		return err
+	if !d.restart || !dockerService.HasImage(ctx, cfg.App.ImageName) {
+		err = dockerService.PullImage(ctx, cfg.App.ImageName, cfg.App.Registry)
+		if err != nil {
+			return nil, err
+		}
+		d.publish(EventImagePulled, "", nil)
 	}
 
-	fmt.Println("- Looking for existing container")
-	oldContainer := dockerService.FindContainer(cfg.App.ImageName)
+	// pre_deploy hooks run with the new image before it takes any traffic,
+	// a failure aborts the deploy with the old container still serving.
+	// A restart already ran them when the image was first deployed.
+	if !d.restart {
+		if err := d.runHooks(ctx, StagePreDeploy, cfg.Hooks.PreDeploy, dockerService); err != nil {
+			return nil, err
+		}
+	}
 
-	fmt.Println("- Spinning up new container")
-	newContainer, err := dockerService.RunContainer(cfg.App.ImageName, cfg.App)
-	if err != nil {
-		return err
+	for _, accessory := range cfg.Accessories {
+		d.publish(EventStep, "Starting accessory "+accessory.Name, nil)
+		if _, err := dockerService.StartAccessory(ctx, cfg.App.Name, accessory); err != nil {
+			return nil, err
+		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // Ensure resources are freed on exit
+	d.publish(EventStep, "Looking for existing container", nil)
+	oldContainer := dockerService.FindContainer(ctx, cfg.App.Name)
+	oldWorkers, err := dockerService.FindWorkers(ctx, cfg.App.Name)
+	if err != nil {
+		return nil, err
+	}
 
-	go handleSignals(ctx, cancel, dockerService, newContainer.ID)
+	d.publish(EventStep, "Spinning up new container", nil)
+	newContainer, err := dockerService.RunContainer(ctx, cfg.App.ImageName, cfg.App, d.meta)
+	if err != nil {
+		return nil, err
+	}
 
-	fmt.Println("- Waiting for container to be healthy")
-	host := fmt.Sprintf("http://localhost:%d", newContainer.Port)
-	err = health.CheckHealth(host, &cfg.HealthCheck)
+	d.publish(EventStep, "Waiting for container to be healthy", nil)
+	host := "http://" + newContainer.Address()
+	err = health.CheckHealthWithOptions(ctx, host, &cfg.HealthCheck, health.Options{Transport: d.transport()})
 	if err != nil {
-		fmt.Println("Container is unhealthy, rolling back")
-		dockerService.StopContainer(newContainer.ID)
-		return err
+		if ctx.Err() == nil {
+			d.publish(EventHealthFailed, "Container is unhealthy", err)
+		}
+		d.rollback(ctx, dockerService, newContainer, "Rolling back", err)
+		return newContainer, err
+	}
+	d.publish(EventHealthPassed, "", nil)
+
+	var newWorkers []string
+	for _, worker := range cfg.Workers {
+		d.publish(EventStep, "Starting worker "+worker.Name, nil)
+		id, err := dockerService.RunWorker(ctx, cfg.App.ImageName, cfg.App, worker, d.meta)
+		if err != nil {
+			d.rollback(ctx, dockerService, newContainer, "Unable to start worker, rolling back", err, newWorkers...)
+			return newContainer, err
+		}
+		newWorkers = append(newWorkers, id)
 	}
 
-	fmt.Println("- Setting up caddy")
-	err = caddy.SetupCaddy(newContainer.Port, cfg)
+	d.publish(EventStep, "Setting up caddy", nil)
+	upstream := caddy.Upstream{Host: newContainer.Alias, Port: newContainer.Port}
+	if upstream.Host == "" {
+		upstream.Host = newContainer.IP
+	}
+	err = caddy.SetupCaddyWithClient(ctx, d.caddyClient(), upstream, cfg)
 	if err != nil {
-		fmt.Println("Unable to setup caddy, rolling back")
-		dockerService.StopContainer(newContainer.ID)
-		return err
+		d.rollback(ctx, dockerService, newContainer, "Unable to setup caddy, rolling back", err, newWorkers...)
+		return newContainer, err
 	}
+	d.publish(EventTrafficSwitched, "Traffic switched to "+upstream.Address(), nil)
+
+	// Traffic already moved to the new container, from here on a cancelled
+	// ctx must not leave the old container running next to it.
+	finishCtx := context.WithoutCancel(ctx)
 
+	// Old containers are stopped but kept for slick logs --deployment until
+	// they are pruned.
 	if oldContainer != nil {
-		fmt.Println("- Killing old container")
-		dockerService.StopContainer(oldContainer.ID)
+		d.publish(EventStep, "Stopping old container", nil)
+		if err := dockerService.RetireContainer(finishCtx, oldContainer.ID); err != nil {
+			slog.Warn("Unable to stop old container", "container_id", oldContainer.ID, "error", err)
+		}
+	}
+
+	if len(oldWorkers) > 0 {
+		d.publish(EventStep, "Stopping old workers", nil)
+		for _, id := range oldWorkers {
+			if err := dockerService.RetireContainer(finishCtx, id); err != nil {
+				slog.Warn("Unable to stop old worker", "container_id", id, "error", err)
+			}
+		}
+	}
+
+	// A failing post_deploy hook is reported but does not undo the deploy.
+	if !d.restart {
+		_ = d.runHooks(ctx, StagePostDeploy, cfg.Hooks.PostDeploy, dockerService)
+	}
+
+	return newContainer, nil
+}
+
+// dockerClient connects to the Docker daemon of the target host.
+func (d *deployment) dockerClient() (docker.DockerClient, error) {
+	if d.host == nil {
+		return docker.NewDockerClient()
 	}
+	return d.host.DockerClient()
+}
 
-	fmt.Println("Deployed successfully")
-	return nil
+// transport reaches the target host for health checks and the Caddy admin
+// API. Nil means the default transport.
+func (d *deployment) transport() http.RoundTripper {
+	if d.host == nil {
+		return nil
+	}
+	return d.host.Transport()
 }
 
-func handleSignals(ctx context.Context, cancelFunc context.CancelFunc, dockerService *docker.DockerService, newContainerID string) {
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+func (d *deployment) caddyClient() caddy.CaddyClientInterface {
+	if d.host == nil {
+		return caddy.NewCaddyClient(d.cfg.Caddy.AdminAPI)
+	}
+	return &caddy.CaddyClient{
+		BaseURL:    d.cfg.Caddy.AdminAPI,
+		HTTPClient: &http.Client{Transport: d.transport()},
+		Logger:     slog.Default(),
+	}
+}
+
+// rollback stops the new container and workers. It runs detached from ctx
+// so that an interrupted or timed out deploy still cleans up after itself.
+func (d *deployment) rollback(ctx context.Context, dockerService *docker.DockerService, newContainer *docker.Container, message string, cause error, workers ...string) {
+	if ctx.Err() != nil {
+		message = "Deploy cancelled, rolling back"
+	}
+	d.publish(EventRolledBack, message, cause)
+
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
 
-	select {
-	case <-sigs:
-		fmt.Println("Received interrupt signal, rolling back")
-		dockerService.StopContainer(newContainerID)
-	case <-ctx.Done():
-		// Context cancelled, stop listening for signals
+	// The failed containers are kept, their logs tell why the deploy failed.
+	if err := dockerService.RetireContainer(cleanupCtx, newContainer.ID); err != nil {
+		slog.Warn("Unable to stop new container", "container_id", newContainer.ID, "error", err)
 	}
 
-	// Clean up
-	signal.Stop(sigs)
-	close(sigs)
+	for _, id := range workers {
+		if err := dockerService.RetireContainer(cleanupCtx, id); err != nil {
+			slog.Warn("Unable to stop new worker", "container_id", id, "error", err)
+		}
+	}
+}
+
+// prune removes the exited containers and images older than the last
+// prune.keep_images deploys. It is best effort, a deploy that got this far
+// succeeded.
+func (d *deployment) prune(ctx context.Context) {
+	opts, err := PruneOptions(d.store, d.cfg, d.host.Name(), d.cfg.Prune.KeepImages)
+	if err != nil {
+		slog.Warn("Unable to prune old images", "error", err)
+		return
+	}
+
+	report, err := d.docker.Prune(ctx, d.cfg.App.Name, opts)
+	if err != nil {
+		slog.Warn("Unable to prune old images", "error", err)
+		return
+	}
+	if len(report.Containers)+len(report.Images) > 0 {
+		slog.Info("Pruned old containers and images", "containers", len(report.Containers), "images", len(report.Images))
+	}
+}
+
+// PruneOptions keeps the images and the stopped containers of the last keep
+// deploys of cfg on host, and the image of cfg itself.
+func PruneOptions(store *state.Store, cfg config.DeploymentConfig, host string, keep int) (docker.PruneOptions, error) {
+	images, err := store.RecentImages(cfg.App.Name, host, keep)
+	if err != nil {
+		return docker.PruneOptions{}, err
+	}
+	recent, err := store.RecentOn(cfg.App.Name, host, keep)
+	if err != nil {
+		return docker.PruneOptions{}, err
+	}
+
+	opts := docker.PruneOptions{Keep: append(images, cfg.App.ImageName)}
+	for _, d := range recent {
+		opts.KeepDeploys = append(opts.KeepDeploys, d.ID)
+	}
+	return opts, nil
 }
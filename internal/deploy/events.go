@@ -0,0 +1,125 @@
+package deploy
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventDeployStarted   EventType = "deploy_started"
+	EventStep            EventType = "step"
+	EventImagePulled     EventType = "image_pulled"
+	EventHealthPassed    EventType = "health_passed"
+	EventHealthFailed    EventType = "health_failed"
+	EventTrafficSwitched EventType = "traffic_switched"
+	EventRolledBack      EventType = "rolled_back"
+	EventHookFailed      EventType = "hook_failed"
+	EventDeployFinished  EventType = "deploy_finished"
+	EventDeployFailed    EventType = "deploy_failed"
+)
+
+// Event is a single step in the lifecycle of a deployment.
+type Event struct {
+	Type     EventType `json:"type"`
+	App      string    `json:"app"`
+	Host     string    `json:"host,omitempty"`
+	DeployID string    `json:"deploy_id"`
+	Image    string    `json:"image"`
+	Message  string    `json:"message,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+type EventHandler func(Event)
+
+// EventBus delivers deployment events to every subscribed handler, in the
+// order they were published. Handlers run on the deploy path, slow ones
+// like notifications must hand the event off and return.
+type EventBus struct {
+	mu       sync.Mutex
+	handlers []EventHandler
+	// deliver keeps handlers from running concurrently, without holding mu
+	// so that a handler may subscribe others.
+	deliver sync.Mutex
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers a handler that is called for every published event.
+func (b *EventBus) Subscribe(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish delivers the event to all handlers. It is safe to call from
+// multiple goroutines, handlers never run concurrently.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	handlers := append([]EventHandler(nil), b.handlers...)
+	b.mu.Unlock()
+
+	b.deliver.Lock()
+	defer b.deliver.Unlock()
+	for _, handler := range handlers {
+		handler(e)
+	}
+}
+
+// LogHandler returns a handler that writes every event to logger. Failures
+// are logged as errors, everything else as info.
+func LogHandler(logger *slog.Logger) EventHandler {
+	return func(e Event) {
+		level := slog.LevelInfo
+		if e.Type == EventDeployFailed || e.Type == EventHealthFailed || e.Type == EventHookFailed {
+			level = slog.LevelError
+		}
+
+		attrs := []any{"event", string(e.Type), "app", e.App, "deploy_id", e.DeployID, "image", e.Image}
+		if e.Host != "" {
+			attrs = append(attrs, "host", e.Host)
+		}
+		if e.Error != "" {
+			attrs = append(attrs, "error", e.Error)
+		}
+
+		logger.Log(context.Background(), level, eventMessage(e), attrs...)
+	}
+}
+
+func eventMessage(e Event) string {
+	if e.Message != "" {
+		return e.Message
+	}
+
+	switch e.Type {
+	case EventDeployStarted:
+		return "Deploying..."
+	case EventImagePulled:
+		return "Image pulled"
+	case EventHealthPassed:
+		return "Container is healthy"
+	case EventRolledBack:
+		return "Rolled back"
+	case EventDeployFinished:
+		return "Deployed successfully"
+	case EventDeployFailed:
+		return "Deploy failed"
+	}
+
+	return string(e.Type)
+}
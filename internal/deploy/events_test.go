@@ -0,0 +1,91 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus_PublishInOrder(t *testing.T) {
+	bus := NewEventBus()
+
+	var first, second []EventType
+	bus.Subscribe(func(e Event) { first = append(first, e.Type) })
+	bus.Subscribe(func(e Event) { second = append(second, e.Type) })
+
+	bus.Publish(Event{Type: EventDeployStarted})
+	bus.Publish(Event{Type: EventDeployFinished})
+
+	expected := []EventType{EventDeployStarted, EventDeployFinished}
+	assert.Equal(t, expected, first)
+	assert.Equal(t, expected, second)
+}
+
+func TestEventBus_SetsTime(t *testing.T) {
+	bus := NewEventBus()
+
+	var received Event
+	bus.Subscribe(func(e Event) { received = e })
+	bus.Publish(Event{Type: EventStep})
+
+	assert.False(t, received.Time.IsZero())
+}
+
+func TestEventBus_Concurrent(t *testing.T) {
+	bus := NewEventBus()
+
+	count := 0
+	bus.Subscribe(func(Event) { count++ })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bus.Publish(Event{Type: EventStep})
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 50, count)
+}
+
+func TestEventBus_HandlerMaySubscribe(t *testing.T) {
+	bus := NewEventBus()
+
+	var late []EventType
+	bus.Subscribe(func(e Event) {
+		if e.Type == EventDeployStarted {
+			bus.Subscribe(func(e Event) { late = append(late, e.Type) })
+		}
+	})
+
+	bus.Publish(Event{Type: EventDeployStarted})
+	bus.Publish(Event{Type: EventDeployFinished})
+
+	assert.Equal(t, []EventType{EventDeployFinished}, late)
+}
+
+func TestEventBus_NilIsNoop(t *testing.T) {
+	var bus *EventBus
+	assert.NotPanics(t, func() { bus.Publish(Event{Type: EventStep}) })
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler := LogHandler(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	handler(Event{Type: EventDeployFailed, App: "memos", DeployID: "abc", Error: "unhealthy"})
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "ERROR", line["level"])
+	assert.Equal(t, "Deploy failed", line["msg"])
+	assert.Equal(t, "deploy_failed", line["event"])
+	assert.Equal(t, "unhealthy", line["error"])
+}
@@ -0,0 +1,162 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+)
+
+// Outcomes of a fleet deploy on a single server.
+const (
+	HostSucceeded      = "succeeded"
+	HostFailed         = "failed"
+	HostSkipped        = "skipped"
+	HostRolledBack     = "rolled_back"
+	HostRollbackFailed = "rollback_failed"
+)
+
+// HostResult is the outcome of a fleet deploy on one server.
+type HostResult struct {
+	Host     string        `json:"host"`
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Fleet rolls a deploy out across several servers, each going through the
+// regular single host deploy.
+type Fleet struct {
+	Hosts []*remote.Host
+	// Deploy deploys cfg to the host of opts.
+	Deploy func(ctx context.Context, cfg config.DeploymentConfig, opts Options) error
+	// PreviousImage returns the image a host is rolled back to, "" when it
+	// has never been deployed to.
+	PreviousImage func(host *remote.Host) string
+}
+
+// Run deploys cfg to every host, at most cfg.Fleet.Parallelism at a time,
+// and handles failures as set by cfg.Fleet.OnFailure. The results are in
+// the order of the hosts.
+func (f *Fleet) Run(ctx context.Context, cfg config.DeploymentConfig, opts Options) ([]HostResult, error) {
+	parallelism := cfg.Fleet.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	onFailure := cfg.Fleet.OnFailure
+	if onFailure == "" {
+		onFailure = config.FleetRollback
+	}
+
+	// Remember what each host runs now, before it is replaced.
+	previous := make([]string, len(f.Hosts))
+	if onFailure == config.FleetRollback && f.PreviousImage != nil {
+		for i, host := range f.Hosts {
+			previous[i] = f.PreviousImage(host)
+		}
+	}
+
+	results := make([]HostResult, len(f.Hosts))
+	for i, host := range f.Hosts {
+		results[i] = HostResult{Host: host.String(), Status: HostSkipped}
+	}
+
+	var (
+		mu      sync.Mutex
+		failed  bool
+		wg      sync.WaitGroup
+		workers = make(chan struct{}, parallelism)
+	)
+
+	for i, host := range f.Hosts {
+		workers <- struct{}{}
+
+		mu.Lock()
+		stop := failed && onFailure != config.FleetContinue
+		mu.Unlock()
+		if stop || ctx.Err() != nil {
+			<-workers
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, host *remote.Host) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			hostOpts := opts
+			hostOpts.Host = host
+
+			started := time.Now()
+			err := f.Deploy(ctx, cfg, hostOpts)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[i].Duration = time.Since(started)
+			results[i].Status = HostSucceeded
+			if err != nil {
+				results[i].Status = HostFailed
+				results[i].Error = err.Error()
+				failed = true
+			}
+		}(i, host)
+	}
+	wg.Wait()
+
+	if !failed && ctx.Err() == nil {
+		return results, nil
+	}
+
+	if onFailure == config.FleetRollback {
+		f.rollback(ctx, cfg, opts, results, previous)
+	}
+
+	failures := 0
+	for _, result := range results {
+		if result.Status != HostSucceeded {
+			failures++
+		}
+	}
+	if ctx.Err() != nil {
+		return results, fmt.Errorf("fleet deploy interrupted: %w", ctx.Err())
+	}
+	return results, fmt.Errorf("deploy failed on %d of %d servers", failures, len(f.Hosts))
+}
+
+// rollback deploys the previous image again on the hosts that were updated,
+// one at a time.
+func (f *Fleet) rollback(ctx context.Context, cfg config.DeploymentConfig, opts Options, results []HostResult, previous []string) {
+	rollbackCtx := context.WithoutCancel(ctx)
+
+	for i, host := range f.Hosts {
+		if results[i].Status != HostSucceeded {
+			continue
+		}
+
+		if previous[i] == "" {
+			slog.Warn("No previous deploy to roll back to", "host", host.String())
+			results[i].Status = HostRollbackFailed
+			results[i].Error = "no previous deploy to roll back to"
+			continue
+		}
+
+		slog.Info("Rolling back", "host", host.String(), "image", previous[i])
+		rollbackCfg := cfg
+		rollbackCfg.App.ImageName = previous[i]
+
+		rollbackOpts := opts
+		rollbackOpts.Host = host
+		rollbackOpts.Deployer = "slick rollback"
+
+		if err := f.Deploy(rollbackCtx, rollbackCfg, rollbackOpts); err != nil {
+			results[i].Status = HostRollbackFailed
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Status = HostRolledBack
+	}
+}
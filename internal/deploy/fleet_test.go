@@ -0,0 +1,167 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fleetCall struct {
+	Host     string
+	Image    string
+	Deployer string
+}
+
+// fakeFleet records the deploys it is asked to make and fails the hosts in
+// failing.
+type fakeFleet struct {
+	mu      sync.Mutex
+	calls   []fleetCall
+	failing map[string]bool
+}
+
+func (f *fakeFleet) deploy(_ context.Context, cfg config.DeploymentConfig, opts Options) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, fleetCall{Host: opts.Host.Hostname, Image: cfg.App.ImageName, Deployer: opts.Deployer})
+	if f.failing[opts.Host.Hostname] && cfg.App.ImageName == "app:v2" {
+		return errors.New("unhealthy")
+	}
+	return nil
+}
+
+func fleetHosts(names ...string) []*remote.Host {
+	hosts := make([]*remote.Host, 0, len(names))
+	for _, name := range names {
+		hosts = append(hosts, &remote.Host{Hostname: name})
+	}
+	return hosts
+}
+
+func fleetConfig(parallelism int, onFailure string) config.DeploymentConfig {
+	return config.DeploymentConfig{
+		App:   config.App{Name: "app", ImageName: "app:v2"},
+		Fleet: config.FleetConfig{Parallelism: parallelism, OnFailure: onFailure},
+	}
+}
+
+func statuses(results []HostResult) []string {
+	var out []string
+	for _, result := range results {
+		out = append(out, result.Status)
+	}
+	return out
+}
+
+func TestFleet_Run(t *testing.T) {
+	fake := &fakeFleet{}
+	fleet := &Fleet{Hosts: fleetHosts("web1", "web2", "web3"), Deploy: fake.deploy}
+
+	results, err := fleet.Run(context.Background(), fleetConfig(1, config.FleetRollback), Options{Deployer: "ci"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{HostSucceeded, HostSucceeded, HostSucceeded}, statuses(results))
+	assert.Equal(t, "ssh://web2", results[1].Host)
+	assert.Equal(t, []fleetCall{
+		{Host: "web1", Image: "app:v2", Deployer: "ci"},
+		{Host: "web2", Image: "app:v2", Deployer: "ci"},
+		{Host: "web3", Image: "app:v2", Deployer: "ci"},
+	}, fake.calls)
+}
+
+func TestFleet_Abort(t *testing.T) {
+	fake := &fakeFleet{failing: map[string]bool{"web2": true}}
+	fleet := &Fleet{Hosts: fleetHosts("web1", "web2", "web3"), Deploy: fake.deploy}
+
+	results, err := fleet.Run(context.Background(), fleetConfig(1, config.FleetAbort), Options{})
+
+	assert.EqualError(t, err, "deploy failed on 2 of 3 servers")
+	assert.Equal(t, []string{HostSucceeded, HostFailed, HostSkipped}, statuses(results))
+	assert.Equal(t, "unhealthy", results[1].Error)
+	assert.Len(t, fake.calls, 2)
+}
+
+func TestFleet_Continue(t *testing.T) {
+	fake := &fakeFleet{failing: map[string]bool{"web1": true}}
+	fleet := &Fleet{Hosts: fleetHosts("web1", "web2", "web3"), Deploy: fake.deploy}
+
+	results, err := fleet.Run(context.Background(), fleetConfig(1, config.FleetContinue), Options{})
+
+	assert.EqualError(t, err, "deploy failed on 1 of 3 servers")
+	assert.Equal(t, []string{HostFailed, HostSucceeded, HostSucceeded}, statuses(results))
+}
+
+func TestFleet_Rollback(t *testing.T) {
+	fake := &fakeFleet{failing: map[string]bool{"web3": true}}
+	fleet := &Fleet{
+		Hosts:  fleetHosts("web1", "web2", "web3", "web4"),
+		Deploy: fake.deploy,
+		PreviousImage: func(host *remote.Host) string {
+			if host.Hostname == "web2" {
+				return ""
+			}
+			return "app:v1"
+		},
+	}
+
+	results, err := fleet.Run(context.Background(), fleetConfig(1, ""), Options{Deployer: "ci"})
+
+	assert.EqualError(t, err, "deploy failed on 4 of 4 servers")
+	assert.Equal(t, []string{HostRolledBack, HostRollbackFailed, HostFailed, HostSkipped}, statuses(results))
+	assert.Equal(t, "no previous deploy to roll back to", results[1].Error)
+	assert.Equal(t, []fleetCall{
+		{Host: "web1", Image: "app:v2", Deployer: "ci"},
+		{Host: "web2", Image: "app:v2", Deployer: "ci"},
+		{Host: "web3", Image: "app:v2", Deployer: "ci"},
+		{Host: "web1", Image: "app:v1", Deployer: "slick rollback"},
+	}, fake.calls)
+}
+
+func TestFleet_Parallelism(t *testing.T) {
+	var running, peak int32
+	deploy := func(context.Context, config.DeploymentConfig, Options) error {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+	fleet := &Fleet{Hosts: fleetHosts("web1", "web2", "web3", "web4", "web5"), Deploy: deploy}
+
+	results, err := fleet.Run(context.Background(), fleetConfig(2, config.FleetRollback), Options{})
+
+	require.NoError(t, err)
+	assert.Len(t, results, 5)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
+
+func TestFleet_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	fake := &fakeFleet{}
+	fleet := &Fleet{
+		Hosts: fleetHosts("web1", "web2"),
+		Deploy: func(ctx context.Context, cfg config.DeploymentConfig, opts Options) error {
+			cancel()
+			return fake.deploy(ctx, cfg, opts)
+		},
+	}
+
+	results, err := fleet.Run(ctx, fleetConfig(1, config.FleetAbort), Options{})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{HostSucceeded, HostSkipped}, statuses(results))
+}
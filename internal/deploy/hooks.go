@@ -0,0 +1,95 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/logging"
+)
+
+const (
+	StagePreDeploy  = "pre_deploy"
+	StagePostDeploy = "post_deploy"
+	StageOnFailure  = "on_failure"
+)
+
+// hookOutput is where hooks stream their output. When nil, every line is
+// passed through the default logger.
+var hookOutput io.Writer
+
+// runHooks runs the hooks of a stage in order and stops at the first one
+// that fails.
+func (d *deployment) runHooks(ctx context.Context, stage string, hooks []config.Hook, dockerService *docker.DockerService) error {
+	for i, hook := range hooks {
+		name := hook.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		d.publish(EventStep, fmt.Sprintf("Running %s hook %s", stage, name), nil)
+		if err := d.runHook(ctx, hook, dockerService); err != nil {
+			err = fmt.Errorf("%s hook %s failed: %w", stage, name, err)
+			d.publish(EventHookFailed, err.Error(), err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *deployment) runHook(ctx context.Context, hook config.Hook, dockerService *docker.DockerService) error {
+	if hook.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(hook.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	out := hookOutput
+	if out == nil {
+		lines := logging.NewLineWriter(slog.Default().With("hook", hook.Name), slog.LevelInfo)
+		defer lines.Flush()
+		out = lines
+	}
+
+	if len(hook.Run) > 0 {
+		if dockerService == nil {
+			return fmt.Errorf("docker is not available")
+		}
+
+		code, err := dockerService.RunOneOff(ctx, d.cfg.App.ImageName, d.cfg.App, hook.Run, out, out)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("%s exited with code %d", strings.Join(hook.Run, " "), code)
+		}
+		return nil
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	}
+	// Don't wait forever on children that keep the output open after a kill.
+	cmd.WaitDelay = time.Second
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = append(os.Environ(),
+		"SLICK_APP="+d.cfg.App.Name,
+		"SLICK_IMAGE="+d.cfg.App.ImageName,
+		"SLICK_DEPLOY_ID="+d.id,
+	)
+
+	return cmd.Run()
+}
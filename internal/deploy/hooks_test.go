@@ -0,0 +1,155 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDeployment() (*deployment, *[]Event) {
+	events := &[]Event{}
+	bus := NewEventBus()
+	bus.Subscribe(func(e Event) { *events = append(*events, e) })
+
+	return &deployment{
+		cfg: config.DeploymentConfig{
+			App: config.App{Name: "test-app", ImageName: "example/image:v2"},
+		},
+		id:  "20240102030405-abcdef",
+		bus: bus,
+	}, events
+}
+
+func captureHookOutput(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	original := hookOutput
+	hookOutput = &buf
+	t.Cleanup(func() { hookOutput = original })
+
+	return &buf
+}
+
+func TestRunHooks_HostCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("host hooks are exercised with sh")
+	}
+
+	out := captureHookOutput(t)
+	d, events := newTestDeployment()
+
+	err := d.runHooks(context.Background(), StagePreDeploy, []config.Hook{
+		{Name: "announce", Command: `echo "$SLICK_APP $SLICK_IMAGE $SLICK_DEPLOY_ID"`},
+	}, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "test-app example/image:v2 20240102030405-abcdef\n", out.String())
+	require.Len(t, *events, 1)
+	assert.Equal(t, "Running pre_deploy hook announce", (*events)[0].Message)
+}
+
+func TestRunHooks_StopsAtFirstFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("host hooks are exercised with sh")
+	}
+
+	out := captureHookOutput(t)
+	d, events := newTestDeployment()
+
+	err := d.runHooks(context.Background(), StagePreDeploy, []config.Hook{
+		{Command: "exit 1"},
+		{Command: "echo unreachable"},
+	}, nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre_deploy hook #1 failed")
+	assert.NotContains(t, out.String(), "unreachable")
+	assert.Equal(t, EventHookFailed, (*events)[len(*events)-1].Type)
+}
+
+func TestRunHooks_CommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("host hooks are exercised with sh")
+	}
+
+	captureHookOutput(t)
+	d, _ := newTestDeployment()
+
+	err := d.runHooks(context.Background(), StagePostDeploy, []config.Hook{
+		{Command: "sleep 5", TimeoutSeconds: 1},
+	}, nil)
+
+	assert.Error(t, err)
+}
+
+func TestRunHooks_Container(t *testing.T) {
+	out := captureHookOutput(t)
+	d, _ := newTestDeployment()
+
+	mockClient := new(docker.MockDockerClient)
+	waitCh := make(chan container.WaitResponse, 1)
+	waitCh <- container.WaitResponse{StatusCode: 0}
+	var errCh <-chan error = make(chan error)
+
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return c.Image == "example/image:v2" && strings.Join(c.Cmd, " ") == "rails db:migrate"
+	}), mock.Anything, mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: "migrate"}, nil)
+	mockClient.On("ContainerWait", mock.Anything, "migrate", container.WaitConditionNextExit).Return((<-chan container.WaitResponse)(waitCh), errCh)
+	mockClient.On("ContainerStart", mock.Anything, "migrate", types.ContainerStartOptions{}).Return(nil)
+	mockClient.On("ContainerLogs", mock.Anything, "migrate", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil)
+	mockClient.On("ContainerRemove", mock.Anything, "migrate", mock.Anything).Return(nil)
+
+	err := d.runHooks(context.Background(), StagePreDeploy, []config.Hook{
+		{Name: "migrate", Run: []string{"rails", "db:migrate"}},
+	}, docker.NewDockerService(mockClient))
+
+	assert.NoError(t, err)
+	assert.Empty(t, out.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestRunHooks_ContainerNonZeroExit(t *testing.T) {
+	captureHookOutput(t)
+	d, _ := newTestDeployment()
+
+	mockClient := new(docker.MockDockerClient)
+	waitCh := make(chan container.WaitResponse, 1)
+	waitCh <- container.WaitResponse{StatusCode: 2}
+	var errCh <-chan error = make(chan error)
+
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: "migrate"}, nil)
+	mockClient.On("ContainerWait", mock.Anything, "migrate", container.WaitConditionNextExit).Return((<-chan container.WaitResponse)(waitCh), errCh)
+	mockClient.On("ContainerStart", mock.Anything, "migrate", types.ContainerStartOptions{}).Return(nil)
+	mockClient.On("ContainerLogs", mock.Anything, "migrate", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil)
+	mockClient.On("ContainerRemove", mock.Anything, "migrate", mock.Anything).Return(nil)
+
+	err := d.runHooks(context.Background(), StagePreDeploy, []config.Hook{
+		{Name: "migrate", Run: []string{"rails", "db:migrate"}},
+	}, docker.NewDockerService(mockClient))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rails db:migrate exited with code 2")
+}
+
+func TestRunHooks_ContainerWithoutDocker(t *testing.T) {
+	d, _ := newTestDeployment()
+
+	err := d.runHooks(context.Background(), StageOnFailure, []config.Hook{
+		{Run: []string{"notify"}},
+	}, nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "docker is not available")
+}
@@ -0,0 +1,208 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/scmmishra/slick-deploy/internal/config"
+)
+
+// Labels that tell accessory, worker and one-off containers apart from the
+// web containers of an app. Web containers carry no role label.
+const (
+	LabelRole    = "slick.role"
+	LabelService = "slick.service"
+
+	RoleAccessory = "accessory"
+	RoleWorker    = "worker"
+	// RoleOneOff marks the short-lived containers of hooks and slick run.
+	RoleOneOff = "oneoff"
+)
+
+// AccessoryName returns the container name of an accessory of app. It does
+// not change between deploys, there is only ever one container per
+// accessory.
+func AccessoryName(app, accessory string) string {
+	return sanitizeName(app) + "-" + sanitizeName(accessory)
+}
+
+// WorkerName returns the name of the container of a worker of app created by
+// the given deploy.
+func WorkerName(app, worker, deployID string) string {
+	return ContainerName(AccessoryName(app, worker), deployID)
+}
+
+// listServices returns the containers of app with the given role, limited
+// to the named service unless name is empty. Stopped containers are only
+// included when all is set.
+func (ds *DockerService) listServices(ctx context.Context, app, role, name string, all bool) ([]types.Container, error) {
+	args := filters.NewArgs(
+		filters.Arg("label", LabelApp+"="+app),
+		filters.Arg("label", LabelRole+"="+role),
+	)
+	if name != "" {
+		args.Add("label", LabelService+"="+name)
+	}
+
+	return ds.Client.ContainerList(ctx, types.ContainerListOptions{All: all, Filters: args})
+}
+
+// FindAccessory returns the ID of the container of an accessory, running or
+// not.
+func (ds *DockerService) FindAccessory(ctx context.Context, app, name string) (string, error) {
+	containers, err := ds.listServices(ctx, app, RoleAccessory, name, true)
+	if err != nil {
+		return "", err
+	}
+	if len(containers) == 0 {
+		return "", fmt.Errorf("accessory %s is not running", name)
+	}
+
+	return containers[0].ID, nil
+}
+
+// StartAccessory makes sure the accessory of app is running. An existing
+// container is started again so its state is kept, otherwise the image is
+// pulled and a new container is created.
+func (ds *DockerService) StartAccessory(ctx context.Context, app string, accessory config.Accessory) (string, error) {
+	existing, err := ds.listServices(ctx, app, RoleAccessory, accessory.Name, true)
+	if err != nil {
+		return "", err
+	}
+
+	if len(existing) > 0 {
+		found := existing[0]
+		if found.State == "running" {
+			return found.ID, nil
+		}
+
+		ds.Logger.Info("Starting accessory", "accessory", accessory.Name)
+		if err := ds.Client.ContainerStart(ctx, found.ID, types.ContainerStartOptions{}); err != nil {
+			return "", fmt.Errorf("error starting accessory %s: %w", accessory.Name, err)
+		}
+		return found.ID, nil
+	}
+
+	if err := ds.PullImage(ctx, accessory.Image, config.RegistryConfig{}); err != nil {
+		return "", err
+	}
+
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(accessory.Ports)
+	if err != nil {
+		return "", fmt.Errorf("invalid ports of accessory %s: %w", accessory.Name, err)
+	}
+
+	containerConfig := &container.Config{
+		Image:        accessory.Image,
+		Cmd:          accessory.Command,
+		Env:          buildEnv(config.App{ENV: accessory.ENV}),
+		ExposedPorts: exposedPorts,
+		Labels: map[string]string{
+			LabelApp:     app,
+			LabelRole:    RoleAccessory,
+			LabelService: accessory.Name,
+		},
+	}
+
+	hostConfig := &container.HostConfig{
+		PortBindings: portBindings,
+		Binds:        accessory.Volumes,
+	}
+
+	if accessory.Restart != "" {
+		name, retries, err := config.ParseRestartPolicy(accessory.Restart)
+		if err != nil {
+			return "", err
+		}
+		hostConfig.RestartPolicy = container.RestartPolicy{Name: name, MaximumRetryCount: retries}
+	}
+
+	// The app reaches the accessory by its name on the shared network.
+	var networkingConfig *network.NetworkingConfig
+	if accessory.Network != "" {
+		if err := ds.EnsureNetwork(ctx, accessory.Network); err != nil {
+			return "", err
+		}
+		hostConfig.NetworkMode = container.NetworkMode(accessory.Network)
+		networkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				accessory.Network: {Aliases: []string{accessory.Name}},
+			},
+		}
+	}
+
+	ds.Logger.Info("Creating accessory", "accessory", accessory.Name, "image", accessory.Image)
+	return ds.createAndStartWith(ctx, AccessoryName(app, accessory.Name), containerConfig, hostConfig, networkingConfig)
+}
+
+// StopAccessory stops the accessory of app. The container is kept so that a
+// later start picks up where it left off.
+func (ds *DockerService) StopAccessory(ctx context.Context, app, name string) error {
+	containers, err := ds.listServices(ctx, app, RoleAccessory, name, false)
+	if err != nil {
+		return err
+	}
+
+	timeout := 15
+	for _, found := range containers {
+		ds.Logger.Info("Stopping accessory", "accessory", found.Labels[LabelService])
+		if err := ds.Client.ContainerStop(ctx, found.ID, container.StopOptions{Timeout: &timeout}); err != nil {
+			return fmt.Errorf("error stopping accessory %s: %w", found.Labels[LabelService], err)
+		}
+	}
+
+	return nil
+}
+
+// RunWorker starts a worker from imageName with the env, volumes, network
+// and runtime options of the app. Workers publish no ports.
+func (ds *DockerService) RunWorker(ctx context.Context, imageName string, appCfg config.App, worker config.Worker, meta Metadata) (string, error) {
+	labels := meta.Labels(appCfg.Name)
+	labels[LabelApp] = appCfg.Name
+	labels[LabelRole] = RoleWorker
+	labels[LabelService] = worker.Name
+
+	containerConfig := &container.Config{
+		Image:  imageName,
+		Env:    buildEnv(appCfg),
+		Labels: labels,
+	}
+
+	hostConfig := &container.HostConfig{}
+	if len(appCfg.Volumes) > 0 {
+		hostConfig.Binds = appCfg.Volumes
+	}
+	if appCfg.Network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(appCfg.Network)
+	}
+
+	if err := applyRuntimeOptions(appCfg, containerConfig, hostConfig); err != nil {
+		return "", err
+	}
+	containerConfig.Cmd = worker.Command
+	for key, value := range labels {
+		containerConfig.Labels[key] = value
+	}
+
+	return ds.createAndStartWith(ctx, WorkerName(appCfg.Name, worker.Name, meta.DeployID), containerConfig, hostConfig, nil)
+}
+
+// FindWorkers returns the IDs of the running workers of app.
+func (ds *DockerService) FindWorkers(ctx context.Context, app string) ([]string, error) {
+	containers, err := ds.listServices(ctx, app, RoleWorker, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(containers))
+	for _, found := range containers {
+		ids = append(ids, found.ID)
+	}
+
+	return ids, nil
+}
@@ -1,25 +1,32 @@
 package docker
 
 import (
-	"bufio"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
-	"text/tabwriter"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/logging"
+	"github.com/scmmishra/slick-deploy/internal/state"
 	"github.com/scmmishra/slick-deploy/pkg/utils"
 )
 
@@ -36,11 +43,20 @@ type ImagePullResponse struct {
 // DockerService holds the client used to interact with Docker.
 type DockerService struct {
 	Client DockerClient
+	Logger *slog.Logger
+	// Store, when set, persists port reservations across processes.
+	Store *state.Store
+	// Remote is set when the daemon runs on another machine, free ports are
+	// then left to Docker to check instead of being probed locally.
+	Remote bool
+	// Server is the name of the server the daemon runs on, empty for the
+	// local one. Port reservations are kept per server.
+	Server string
 }
 
 // NewDockerService creates a new instance of DockerService with the given DockerClient.
 func NewDockerService(cli DockerClient) *DockerService {
-	return &DockerService{Client: cli}
+	return &DockerService{Client: cli, Logger: slog.Default()}
 }
 
 type DockerClient interface {
@@ -50,8 +66,21 @@ type DockerClient interface {
 	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
 	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
 	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
+	ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) error
+	ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.ContainerUpdateOKBody, error)
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
 	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
 	ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error)
+	ContainerExecResize(ctx context.Context, execID string, options types.ResizeOptions) error
+	NetworkInspect(ctx context.Context, networkID string, options types.NetworkInspectOptions) (types.NetworkResource, error)
+	NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error)
+	ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+	DistributionInspect(ctx context.Context, image, encodedRegistryAuth string) (registry.DistributionInspect, error)
+	ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error)
+	ImageRemove(ctx context.Context, imageID string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error)
 	Close() error
 }
 
@@ -59,25 +88,26 @@ func NewDockerClient() (DockerClient, error) {
 	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 }
 
+// NewDockerClientWithDialer creates a client that reaches the daemon through
+// dial, such as a connection tunnelled over SSH.
+func NewDockerClientWithDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) (DockerClient, error) {
+	return client.NewClientWithOpts(
+		// The host only fills in the request URLs, dial makes the connection.
+		client.WithHost("http://docker.example.com"),
+		client.WithDialContext(dial),
+		client.WithAPIVersionNegotiation(),
+	)
+}
+
 // PullImage is a function that pulls a Docker image from a Docker registry.
 // This is similar to running `docker pull <image>` from the command line.
-func (ds *DockerService) PullImage(imageName string, registryConfig config.RegistryConfig) error {
-	// A context in Go is used to define a deadline or a cancellation signal
-	// for requests made to external resources, like a Docker Daemon in this case.
-	ctx := context.Background()
-
-	authConfig := registry.AuthConfig{
-		Username: registryConfig.Username,
-		Password: registryConfig.Password,
-	}
-	encodedJSON, err := json.Marshal(authConfig)
-
+// The context can be used to cancel an in-progress pull.
+func (ds *DockerService) PullImage(ctx context.Context, imageName string, registryConfig config.RegistryConfig) error {
+	authStr, err := encodeAuth(registryConfig)
 	if err != nil {
 		return err
 	}
 
-	authStr := base64.URLEncoding.EncodeToString(encodedJSON)
-
 	options := types.ImagePullOptions{
 		RegistryAuth: authStr,
 	}
@@ -92,7 +122,9 @@ func (ds *DockerService) PullImage(imageName string, registryConfig config.Regis
 	// skipcq: GO-S2307
 	defer out.Close()
 
-	// Process the output from ImagePull to show progress.
+	// Process the output from ImagePull to show progress. Progress bars are
+	// only drawn on a terminal, otherwise each status is logged at debug level.
+	progress := logging.Progress()
 	dec := json.NewDecoder(out)
 	var response ImagePullResponse
 	for {
@@ -103,57 +135,177 @@ func (ds *DockerService) PullImage(imageName string, registryConfig config.Regis
 			return err
 		}
 
+		if progress == nil {
+			if response.Progress == "" {
+				ds.Logger.Debug(response.Status, "image", imageName, "layer", response.ID)
+			}
+			continue
+		}
+
 		if response.Progress != "" {
-			fmt.Printf("\r%-70s", "Progress: "+response.Progress)
+			fmt.Fprintf(progress, "\r%-70s", "Progress: "+response.Progress)
 		} else {
-			fmt.Printf("\r%-70s", response.Status)
+			fmt.Fprintf(progress, "\r%-70s", response.Status)
 		}
-		os.Stdout.Sync()
 	}
 
-	fmt.Println() // Print a new line at the end
+	if progress != nil {
+		fmt.Fprintln(progress) // Print a new line at the end
+	}
+	ds.Logger.Info("Pulled image", "image", imageName)
+
 	// If everything goes well, return nil indicating the pull was successful.
 	return nil
 }
 
+// encodeAuth encodes the registry credentials the way the Docker API
+// expects them.
+func encodeAuth(registryConfig config.RegistryConfig) (string, error) {
+	authConfig := registry.AuthConfig{
+		Username: registryConfig.Username,
+		Password: registryConfig.Password,
+	}
+	encodedJSON, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.URLEncoding.EncodeToString(encodedJSON), nil
+}
+
+// HasImage reports whether imageName is already on the Docker host.
+func (ds *DockerService) HasImage(ctx context.Context, imageName string) bool {
+	_, _, err := ds.Client.ImageInspectWithRaw(ctx, imageName)
+	return err == nil
+}
+
+// ImagePorts pulls imageName and returns the TCP ports it exposes, sorted.
+func (ds *DockerService) ImagePorts(ctx context.Context, imageName string) ([]int, error) {
+	if err := ds.PullImage(ctx, imageName, config.RegistryConfig{}); err != nil {
+		return nil, err
+	}
+
+	inspected, _, err := ds.Client.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return nil, fmt.Errorf("error inspecting image %s: %w", imageName, err)
+	}
+	if inspected.Config == nil {
+		return nil, nil
+	}
+
+	var ports []int
+	for port := range inspected.Config.ExposedPorts {
+		if port.Proto() == "tcp" {
+			ports = append(ports, port.Int())
+		}
+	}
+	sort.Ints(ports)
+
+	return ports, nil
+}
+
 type Container struct {
 	ID   string
 	Port int
+	// Alias and IP are set for containers reached over the app network
+	// instead of a published host port, Port is then the container port.
+	Alias string
+	IP    string
 }
 
-func (ds *DockerService) RunContainer(imageName string, appCfg config.App) (*Container, error) {
-	ctx := context.Background()
+// Address returns the host:port at which slick itself reaches the container.
+func (c *Container) Address() string {
+	host := "localhost"
+	if c.IP != "" {
+		host = c.IP
+	}
+	return net.JoinHostPort(host, strconv.Itoa(c.Port))
+}
+
+// reachableIP returns the address a port published on ip is reached at,
+// empty for the unspecified addresses that mean every interface.
+func reachableIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsUnspecified() {
+		return ""
+	}
+	return parsed.String()
+}
+
+// maxStartAttempts is how many ports RunContainer tries when Docker reports
+// the chosen one as already allocated.
+const maxStartAttempts = 5
+
+// RunContainer starts a container of the app from imageName, named and
+// labelled after the deploy described by meta.
+func (ds *DockerService) RunContainer(ctx context.Context, imageName string, appCfg config.App, meta Metadata) (*Container, error) {
+	if appCfg.Expose == config.ExposeNetwork {
+		return ds.runOnNetwork(ctx, imageName, appCfg, meta)
+	}
+
+	bindAddress := appCfg.BindAddress
+	if bindAddress == "" {
+		bindAddress = "127.0.0.1"
+	}
+	if ip := net.ParseIP(bindAddress); ip != nil && !ip.IsLoopback() {
+		ds.Logger.Warn("Publishing the app port on a public address, it is reachable without going through Caddy", "bind_address", bindAddress)
+	}
 
 	portManager := utils.NewPortManager(appCfg.PortRange.Start, appCfg.PortRange.End, 1)
-	port, err := portManager.AllocatePort()
+	portManager.Host = bindAddress
+	portManager.SkipProbe = ds.Remote
 
+	// Docker may publish ports without binding them on the host, so the bind
+	// test alone does not see them.
+	published, err := ds.publishedPorts(ctx)
 	if err != nil {
 		return nil, err
 	}
+	portManager.Reserve(published...)
 
-	// skipcq: GO-W1027
-	envs := []string{}
+	var lastErr error
+	for attempt := 0; attempt < maxStartAttempts; attempt++ {
+		port, err := ds.allocatePort(appCfg.Name, portManager)
+		if err != nil {
+			return nil, err
+		}
 
-	for _, env := range appCfg.ENV {
-		envValue, exists := os.LookupEnv(env)
-		if exists {
-			envs = append(envs, env+"="+envValue)
+		id, err := ds.createAndStart(ctx, imageName, appCfg, meta, bindAddress, port)
+		if err == nil {
+			return &Container{
+				ID:   id,
+				Port: port,
+				IP:   reachableIP(bindAddress),
+			}, nil
 		}
+
+		ds.releasePort(port)
+		if !isPortAllocatedError(err) {
+			return nil, err
+		}
+
+		ds.Logger.Warn("Port is already allocated, trying another one", "port", port)
+		lastErr = err
 	}
 
+	return nil, lastErr
+}
+
+func (ds *DockerService) createAndStart(ctx context.Context, imageName string, appCfg config.App, meta Metadata, bindAddress string, port int) (string, error) {
 	containerConfig := &container.Config{
 		Image: imageName,
 		ExposedPorts: nat.PortSet{
 			nat.Port(fmt.Sprintf("%d/tcp", appCfg.ContainerPort)): struct{}{},
 		},
-		Env: envs,
+		Env:    buildEnv(appCfg),
+		Labels: meta.Labels(appCfg.Name),
 	}
 
 	hostConfig := &container.HostConfig{
 		PortBindings: nat.PortMap{
 			nat.Port(fmt.Sprintf("%d/tcp", appCfg.ContainerPort)): []nat.PortBinding{
 				{
-					HostIP:   "0.0.0.0",
+					HostIP:   bindAddress,
 					HostPort: fmt.Sprintf("%d", port),
 				},
 			},
@@ -168,62 +320,320 @@ func (ds *DockerService) RunContainer(imageName string, appCfg config.App) (*Con
 		hostConfig.NetworkMode = container.NetworkMode(appCfg.Network)
 	}
 
-	resp, err := ds.Client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+	if err := applyRuntimeOptions(appCfg, containerConfig, hostConfig); err != nil {
+		return "", err
+	}
+
+	name := ContainerName(appCfg.Name, meta.DeployID)
+	return ds.createAndStartWith(ctx, name, containerConfig, hostConfig, nil)
+}
+
+func (ds *DockerService) createAndStartWith(ctx context.Context, name string, containerConfig *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig) (string, error) {
+	resp, err := ds.Client.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, name)
+	if err != nil && name != "" && errdefs.IsConflict(err) {
+		name, err = ds.resolveNameConflict(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		resp, err = ds.Client.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, name)
+	}
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	err = ds.Client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("error allocating port: %w", err)
+		// Don't leave a created but never started container behind.
+		_ = ds.Client.ContainerRemove(context.WithoutCancel(ctx), resp.ID, types.ContainerRemoveOptions{Force: true})
+		return "", fmt.Errorf("error starting container: %w", err)
 	}
 
-	return &Container{
-		ID:   resp.ID,
-		Port: port,
-	}, nil
+	return resp.ID, nil
 }
 
-func (ds *DockerService) FindContainer(imageName string) *Container {
-	ctx := context.Background()
+// runOnNetwork starts the app container on the app network under a unique
+// alias without publishing any host port.
+func (ds *DockerService) runOnNetwork(ctx context.Context, imageName string, appCfg config.App, meta Metadata) (*Container, error) {
+	if err := ds.EnsureNetwork(ctx, appCfg.Network); err != nil {
+		return nil, err
+	}
 
-	containers, err := ds.Client.ContainerList(ctx, types.ContainerListOptions{})
+	name := ContainerName(appCfg.Name, meta.DeployID)
+	alias := name
+	if alias == "" {
+		alias = newAlias(appCfg.Name)
+	}
+
+	containerConfig := &container.Config{
+		Image:  imageName,
+		Env:    buildEnv(appCfg),
+		Labels: meta.Labels(appCfg.Name),
+	}
+
+	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode(appCfg.Network),
+	}
+	if len(appCfg.Volumes) > 0 {
+		hostConfig.Binds = appCfg.Volumes
+	}
+
+	if err := applyRuntimeOptions(appCfg, containerConfig, hostConfig); err != nil {
+		return nil, err
+	}
+
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			appCfg.Network: {Aliases: []string{alias}},
+		},
+	}
+
+	id, err := ds.createAndStartWith(ctx, name, containerConfig, hostConfig, networkingConfig)
 	if err != nil {
+		return nil, err
+	}
+
+	newContainer := &Container{
+		ID:    id,
+		Port:  appCfg.ContainerPort,
+		Alias: alias,
+	}
+
+	inspected, err := ds.Client.ContainerInspect(ctx, id)
+	if err == nil && inspected.NetworkSettings != nil {
+		if endpoint, ok := inspected.NetworkSettings.Networks[appCfg.Network]; ok && endpoint != nil {
+			newContainer.IP = endpoint.IPAddress
+		}
+	}
+
+	return newContainer, nil
+}
+
+// EnsureNetwork creates the named network unless it already exists.
+func (ds *DockerService) EnsureNetwork(ctx context.Context, name string) error {
+	_, err := ds.Client.NetworkInspect(ctx, name, types.NetworkInspectOptions{})
+	if err == nil {
 		return nil
 	}
+	if !errdefs.IsNotFound(err) {
+		return fmt.Errorf("error inspecting network %s: %w", name, err)
+	}
 
-	baseImageName := strings.Split(imageName, ":")[0]
+	ds.Logger.Info("Creating network", "network", name)
+	_, err = ds.Client.NetworkCreate(ctx, name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+	})
+	if err != nil {
+		return fmt.Errorf("error creating network %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// allocatePort picks a free port, reserving it in the state store when one
+// is set so concurrent deploys never pick the same port.
+func (ds *DockerService) allocatePort(app string, portManager *utils.PortManager) (int, error) {
+	if ds.Store == nil {
+		return portManager.AllocatePort()
+	}
+
+	return ds.Store.ReservePort(app, ds.Server, func(reserved []int) (int, error) {
+		portManager.Reserve(reserved...)
+		return portManager.AllocatePort()
+	})
+}
+
+func (ds *DockerService) releasePort(port int) {
+	if ds.Store == nil {
+		return
+	}
+	if err := ds.Store.ReleasePort(ds.Server, port); err != nil {
+		ds.Logger.Warn("Unable to release port reservation", "port", port, "error", err)
+	}
+}
+
+// publishedPorts returns the host ports published by running containers.
+func (ds *DockerService) publishedPorts(ctx context.Context) ([]int, error) {
+	containers, err := ds.Client.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %w", err)
+	}
+
+	var ports []int
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				ports = append(ports, int(p.PublicPort))
+			}
+		}
+	}
+
+	return ports, nil
+}
+
+func isPortAllocatedError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "port is already allocated") ||
+		strings.Contains(msg, "address already in use")
+}
+
+// buildEnv resolves the env variables listed in the app config from the
+// current environment, skipping the ones that are not set.
+func buildEnv(appCfg config.App) []string {
+	// skipcq: GO-W1027
+	envs := []string{}
+
+	for _, env := range appCfg.ENV {
+		envValue, exists := os.LookupEnv(env)
+		if exists {
+			envs = append(envs, env+"="+envValue)
+		}
+	}
+
+	return envs
+}
+
+// RunOneOff runs cmd in a short-lived container from imageName with the
+// env, volumes and network of the app, streams its output to stdout and
+// stderr and removes it once it exits. It returns the exit code of the
+// command. The container gets no host port and the one-off role label, so
+// it never takes traffic or passes for a web container of the app.
+func (ds *DockerService) RunOneOff(ctx context.Context, imageName string, appCfg config.App, cmd []string, stdout, stderr io.Writer) (int, error) {
+	containerConfig := &container.Config{
+		Image:  imageName,
+		Cmd:    cmd,
+		Env:    buildEnv(appCfg),
+		Labels: map[string]string{LabelApp: appCfg.Name, LabelRole: RoleOneOff},
+	}
+
+	hostConfig := &container.HostConfig{}
+	if len(appCfg.Volumes) > 0 {
+		hostConfig.Binds = appCfg.Volumes
+	}
+	if appCfg.Network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(appCfg.Network)
+	}
+
+	if err := applyRuntimeOptions(appCfg, containerConfig, hostConfig); err != nil {
+		return -1, err
+	}
+	// The command replaces the app command and the container must not be
+	// restarted once it exits.
+	containerConfig.Cmd = cmd
+	hostConfig.RestartPolicy = container.RestartPolicy{}
+
+	resp, err := ds.Client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+	if err != nil {
+		return -1, err
+	}
+
+	// Remove the container even when ctx was cancelled while it was running.
+	defer ds.Client.ContainerRemove(context.WithoutCancel(ctx), resp.ID, types.ContainerRemoveOptions{Force: true})
+
+	// Start waiting before the container starts so a fast exit is not missed.
+	waitCh, errCh := ds.Client.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+
+	if err := ds.Client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return -1, err
+	}
+
+	logs, err := ds.Client.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	// skipcq: GO-S2307
+	defer logs.Close()
+
+	if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil {
+		return -1, fmt.Errorf("error reading container output: %w", err)
+	}
+
+	select {
+	case result := <-waitCh:
+		if result.Error != nil {
+			return -1, fmt.Errorf("error waiting for container: %s", result.Error.Message)
+		}
+		return int(result.StatusCode), nil
+	case err := <-errCh:
+		return -1, err
+	}
+}
+
+// FindContainer returns the running container of app that takes its
+// traffic, found by its slick.app label, or nil when there is none.
+func (ds *DockerService) FindContainer(ctx context.Context, app string) *Container {
+	containers, err := ds.Client.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelApp+"="+app)),
+	})
+	if err != nil {
+		return nil
+	}
 
 	for _, container := range containers {
+		// Workers and one-off containers run from the app image too, but
+		// never take traffic.
+		if container.Labels[LabelRole] != "" {
+			continue
+		}
+
 		// Inspect each container to get detailed information
 		cont, err := ds.Client.ContainerInspect(ctx, container.ID)
 		if err != nil {
 			continue // Skip to next container on error
 		}
 
-		containerBaseImageName := strings.Split(cont.Config.Image, ":")[0]
-		// Check if the container's image matches the specified image name
-		if containerBaseImageName == baseImageName {
-			return &Container{
-				ID: container.ID,
-			}
-		}
+		return containerEndpoint(container, cont)
 	}
 
 	return nil
 }
 
-func (ds *DockerService) StopContainer(containerID string) error {
-	ctx := context.Background()
-
-	defer ds.Client.Close()
+// containerEndpoint returns where a listed container is reached: its
+// published port, or its network address when it publishes none.
+func containerEndpoint(summary types.Container, inspected types.ContainerJSON) *Container {
+	found := &Container{
+		ID: summary.ID,
+	}
+	for _, port := range summary.Ports {
+		if port.PublicPort != 0 {
+			found.Port = int(port.PublicPort)
+			found.IP = reachableIP(port.IP)
+			return found
+		}
+	}
 
-	timeout := 15
-	stopOptions := container.StopOptions{
-		Timeout: &timeout,
+	// Containers without a published port are reached on their network,
+	// under the alias they were started with, which is their name.
+	if len(summary.Names) > 0 {
+		found.Alias = strings.TrimPrefix(summary.Names[0], "/")
+	}
+	if inspected.NetworkSettings != nil {
+		for _, endpoint := range inspected.NetworkSettings.Networks {
+			if endpoint != nil && endpoint.IPAddress != "" {
+				found.IP = endpoint.IPAddress
+				break
+			}
+		}
+	}
+	for _, port := range summary.Ports {
+		if port.PrivatePort != 0 {
+			found.Port = int(port.PrivatePort)
+			break
+		}
 	}
 
-	err := ds.Client.ContainerStop(ctx, containerID, stopOptions)
+	return found
+}
+
+func (ds *DockerService) StopContainer(ctx context.Context, containerID string) error {
+	defer ds.Client.Close()
+
+	err := ds.stop(ctx, containerID)
 	if err != nil {
 		return err
 	}
@@ -236,78 +646,185 @@ func (ds *DockerService) StopContainer(containerID string) error {
 	return nil
 }
 
-func (ds *DockerService) StreamLogs(container, tail string) error {
-	ctx := context.Background()
-	defer ds.Client.Close()
+// RetireContainer stops a container replaced by a deploy but keeps it, so
+// its logs can still be read. slick prune removes it later. Its restart
+// policy is cleared first so a reboot does not bring it back.
+func (ds *DockerService) RetireContainer(ctx context.Context, containerID string) error {
+	_, err := ds.Client.ContainerUpdate(ctx, containerID, container.UpdateConfig{
+		RestartPolicy: container.RestartPolicy{Name: "no"},
+	})
+	if err != nil {
+		return fmt.Errorf("error clearing the restart policy: %w", err)
+	}
 
-	options := types.ContainerLogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Follow:     true,
-		Tail:       tail,
-		Details:    true,
+	return ds.stop(ctx, containerID)
+}
+
+func (ds *DockerService) stop(ctx context.Context, containerID string) error {
+	timeout := 15
+	stopOptions := container.StopOptions{
+		Timeout: &timeout,
 	}
 
-	out, err := ds.Client.ContainerLogs(ctx, container, options)
-	if err != nil {
-		return err
+	// Let Docker use the stop timeout configured on the container, if any.
+	inspected, err := ds.Client.ContainerInspect(ctx, containerID)
+	if err == nil && inspected.Config != nil && inspected.Config.StopTimeout != nil {
+		stopOptions.Timeout = nil
 	}
 
-	// skipcq: GO-S2307
-	defer out.Close()
+	return ds.Client.ContainerStop(ctx, containerID, stopOptions)
+}
 
-	reader := bufio.NewReader(out)
+// RestartContainer restarts a running container in place.
+func (ds *DockerService) RestartContainer(ctx context.Context, containerID string) error {
+	timeout := 15
+	return ds.Client.ContainerRestart(ctx, containerID, container.StopOptions{
+		Timeout: &timeout,
+	})
+}
 
-	for {
-		// Docker log lines have a 8 byte header, 4 byte big endian timestamp, and then the log message
-		header := make([]byte, 8)
-		_, err := reader.Read(header)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
+// ContainerStatus is a summary of a running container.
+type ContainerStatus struct {
+	ID      string            `json:"id"`
+	Image   string            `json:"image"`
+	Created time.Time         `json:"created"`
+	State   string            `json:"state"`
+	Ports   []string          `json:"ports"`
+	Names   []string          `json:"names"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// Name returns the container name without Docker's leading slash.
+func (c ContainerStatus) Name() string {
+	names := make([]string, 0, len(c.Names))
+	for _, name := range c.Names {
+		names = append(names, strings.TrimPrefix(name, "/"))
+	}
+	return strings.Join(names, ", ")
+}
+
+// ListContainers returns the status of all running containers.
+func (ds *DockerService) ListContainers(ctx context.Context) ([]ContainerStatus, error) {
+	containers, err := ds.Client.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]ContainerStatus, 0, len(containers))
+	for _, container := range containers {
+		status := ContainerStatus{
+			ID:      container.ID,
+			Image:   container.Image,
+			Created: time.Unix(container.Created, 0),
+			State:   container.State,
+			Ports:   []string{},
+			Names:   container.Names,
+			Labels:  container.Labels,
 		}
 
-		// Read the rest of the line as the log message
-		message, err := reader.ReadString('\n')
-		if err != nil {
-			return err
+		for _, port := range container.Ports {
+			status.Ports = append(status.Ports, fmt.Sprintf("%s:%d->%d/%s", port.IP, port.PublicPort, port.PrivatePort, port.Type))
 		}
 
-		// Print the log message
-		fmt.Print(message)
+		statuses = append(statuses, status)
 	}
 
-	return nil
+	return statuses, nil
 }
 
-func (ds *DockerService) GetStatus() error {
-	containers, err := ds.Client.ContainerList(context.Background(), types.ContainerListOptions{})
+// AppContainer describes a running web container of an app.
+type AppContainer struct {
+	Container
+	Name   string
+	Image  string
+	Digest string
+	State  string
+	// Health is the status of the Docker healthcheck, "none" when the
+	// image defines none.
+	Health    string
+	DeployID  string
+	StartedAt time.Time
+}
+
+// AppContainers returns the running web containers of app, newest first.
+// Accessories and workers are left out.
+func (ds *DockerService) AppContainers(ctx context.Context, app string) ([]AppContainer, error) {
+	containers, err := ds.Client.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelApp+"="+app)),
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	fmt.Fprintln(w, "CONTAINER ID\tIMAGE\tCREATED\tSTATUS\tPORTS\tNAMES")
+	found := make([]AppContainer, 0, len(containers))
+	for _, summary := range containers {
+		if summary.Labels[LabelRole] != "" {
+			continue
+		}
 
-	for _, container := range containers {
-		ports := ""
+		inspected, err := ds.Client.ContainerInspect(ctx, summary.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error inspecting container %s: %w", summary.ID, err)
+		}
 
-		for _, port := range container.Ports {
-			ports += fmt.Sprintf("%s:%d->%d/%s ", port.IP, port.PublicPort, port.PrivatePort, port.Type)
+		c := AppContainer{
+			Container: *containerEndpoint(summary, inspected),
+			Name:      strings.TrimPrefix(inspected.Name, "/"),
+			Image:     summary.Image,
+			State:     summary.State,
+			Health:    "none",
+			DeployID:  summary.Labels[LabelDeployID],
+		}
+		if inspected.Config != nil {
+			c.Image = inspected.Config.Image
+		}
+		if inspected.ContainerJSONBase != nil && inspected.State != nil {
+			if inspected.State.Health != nil {
+				c.Health = inspected.State.Health.Status
+			}
+			c.StartedAt, _ = time.Parse(time.RFC3339Nano, inspected.State.StartedAt)
+		}
+		if inspected.ContainerJSONBase != nil && inspected.Image != "" {
+			c.Digest = ds.imageDigest(ctx, inspected.Image, c.Image)
 		}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
-			container.ID[:10],
-			container.Image,
-			time.Since(time.Unix(container.Created, 0)),
-			container.State,
-			ports,
-			container.Names)
+		found = append(found, c)
 	}
 
-	w.Flush()
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].StartedAt.After(found[j].StartedAt)
+	})
 
-	return nil
+	return found, nil
+}
+
+// imageDigest returns the registry digest of the image with the given ID,
+// preferring the one of the repository the container was started from. It
+// is empty for images that were never pushed or pulled.
+func (ds *DockerService) imageDigest(ctx context.Context, imageID, reference string) string {
+	image, _, err := ds.Client.ImageInspectWithRaw(ctx, imageID)
+	if err != nil {
+		return ""
+	}
+	return repoDigest(image, reference)
+}
+
+// repoDigest picks the digest of image in the repository of reference, or
+// its first one.
+func repoDigest(image types.ImageInspect, reference string) string {
+	if len(image.RepoDigests) == 0 {
+		return ""
+	}
+
+	repository := strings.Split(reference, ":")[0]
+	digest := image.RepoDigests[0]
+	for _, repoDigest := range image.RepoDigests {
+		if strings.HasPrefix(repoDigest, repository+"@") {
+			digest = repoDigest
+			break
+		}
+	}
+
+	_, digest, _ = strings.Cut(digest, "@")
+	return digest
 }
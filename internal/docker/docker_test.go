@@ -1,14 +1,27 @@
 package docker
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"io"
+	"net"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/state"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -25,7 +38,7 @@ func TestDockerService_PullImage(t *testing.T) {
 
 	mockClient.On("ImagePull", mock.Anything, imageName, mock.AnythingOfType("types.ImagePullOptions")).Return(io.NopCloser(strings.NewReader("")), nil)
 
-	err := dockerService.PullImage(imageName, registryConfig)
+	err := dockerService.PullImage(context.Background(), imageName, registryConfig)
 	assert.NoError(t, err)
 
 	mockClient.AssertCalled(t, "ImagePull", mock.Anything, imageName, mock.AnythingOfType("types.ImagePullOptions"))
@@ -55,10 +68,11 @@ func TestDockerService_RunContainer(t *testing.T) {
 	t.Setenv("__SLICK_TEST_ENV", "test_value")
 
 	containerID := "container123"
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{}, nil)
 	mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: containerID}, nil)
 	mockClient.On("ContainerStart", mock.Anything, containerID, types.ContainerStartOptions{}).Return(nil)
 
-	newContainer, err := dockerService.RunContainer(imageName, cfg)
+	newContainer, err := dockerService.RunContainer(context.Background(), imageName, cfg, Metadata{})
 	assert.NoError(t, err)
 	assert.Equal(t, containerID, newContainer.ID)
 
@@ -70,13 +84,14 @@ func TestDockerService_StopContainer(t *testing.T) {
 	dockerService := NewDockerService(mockClient)
 
 	containerID := "container123"
+	mockClient.On("ContainerInspect", mock.Anything, containerID).Return(types.ContainerJSON{}, nil)
 	timeout := 15
 	mockClient.On("ContainerStop", mock.Anything, containerID, container.StopOptions{
 		Timeout: &timeout,
 	}).Return(nil)
 	mockClient.On("ContainerRemove", mock.Anything, containerID, types.ContainerRemoveOptions{}).Return(nil)
 
-	err := dockerService.StopContainer(containerID)
+	err := dockerService.StopContainer(context.Background(), containerID)
 	assert.NoError(t, err)
 
 	mockClient.AssertCalled(t, "ContainerStop", mock.Anything, containerID, container.StopOptions{
@@ -91,13 +106,14 @@ func TestDockerService_StopContainer_StopError(t *testing.T) {
 	dockerService := NewDockerService(mockClient)
 
 	containerID := "container123"
+	mockClient.On("ContainerInspect", mock.Anything, containerID).Return(types.ContainerJSON{}, nil)
 	timeout := 15
 
 	mockClient.On("ContainerStop", mock.Anything, containerID, container.StopOptions{
 		Timeout: &timeout,
 	}).Return(errors.New("stop error"))
 
-	err := dockerService.StopContainer(containerID)
+	err := dockerService.StopContainer(context.Background(), containerID)
 	assert.Error(t, err)
 
 	mockClient.AssertCalled(t, "ContainerStop", mock.Anything, containerID, container.StopOptions{
@@ -111,6 +127,7 @@ func TestDockerService_StopContainer_RemoveError(t *testing.T) {
 	dockerService := NewDockerService(mockClient)
 
 	containerID := "container123"
+	mockClient.On("ContainerInspect", mock.Anything, containerID).Return(types.ContainerJSON{}, nil)
 	timeout := 15
 
 	mockClient.On("ContainerStop", mock.Anything, containerID, container.StopOptions{
@@ -118,7 +135,7 @@ func TestDockerService_StopContainer_RemoveError(t *testing.T) {
 	}).Return(nil)
 	mockClient.On("ContainerRemove", mock.Anything, containerID, types.ContainerRemoveOptions{}).Return(errors.New("remove error"))
 
-	err := dockerService.StopContainer(containerID)
+	err := dockerService.StopContainer(context.Background(), containerID)
 	assert.Error(t, err)
 
 	mockClient.AssertCalled(t, "ContainerStop", mock.Anything, containerID, container.StopOptions{
@@ -132,29 +149,56 @@ func TestDockerService_StreamLogs(t *testing.T) {
 	mockClient := new(MockDockerClient)
 	dockerService := NewDockerService(mockClient)
 
-	containerID := "container123"
-	logStream := "test log stream\nmore logs\n"
-	mockClient.On("ContainerLogs", mock.Anything, containerID, mock.AnythingOfType("types.ContainerLogsOptions")).Return(io.NopCloser(strings.NewReader(logStream)), nil)
+	var stream bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&stream, stdcopy.Stdout).Write([]byte("listening on :8080\nno trailing newline"))
+	_, _ = stdcopy.NewStdWriter(&stream, stdcopy.Stderr).Write([]byte("warning: " + strings.Repeat("x", 70000) + "\n"))
 
-	err := dockerService.StreamLogs(containerID, "all")
+	containerID := "container123"
+	mockClient.On("ContainerInspect", mock.Anything, containerID).Return(types.ContainerJSON{Config: &container.Config{}}, nil)
+	mockClient.On("ContainerLogs", mock.Anything, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Tail:       "10",
+		Since:      "5m",
+		Timestamps: true,
+	}).Return(io.NopCloser(&stream), nil)
+
+	var stdout, stderr bytes.Buffer
+	err := dockerService.StreamLogs(context.Background(), containerID, LogOptions{Tail: "10", Since: "5m", Timestamps: true, Follow: true}, &stdout, &stderr)
 	assert.NoError(t, err)
-
-	mockClient.AssertCalled(t, "ContainerLogs", mock.Anything, containerID, mock.AnythingOfType("types.ContainerLogsOptions"))
+	assert.Equal(t, "listening on :8080\nno trailing newline", stdout.String())
+	assert.Equal(t, 70010, stderr.Len())
 	mockClient.AssertExpectations(t)
 }
 
+func TestDockerService_StreamLogs_TTY(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	containerID := "container123"
+	mockClient.On("ContainerInspect", mock.Anything, containerID).Return(types.ContainerJSON{Config: &container.Config{Tty: true}}, nil)
+	mockClient.On("ContainerLogs", mock.Anything, containerID, mock.AnythingOfType("types.ContainerLogsOptions")).Return(io.NopCloser(strings.NewReader("raw\r\noutput")), nil)
+
+	var stdout, stderr bytes.Buffer
+	err := dockerService.StreamLogs(context.Background(), containerID, LogOptions{Tail: "all"}, &stdout, &stderr)
+	assert.NoError(t, err)
+	assert.Equal(t, "raw\r\noutput", stdout.String())
+	assert.Empty(t, stderr.String())
+}
+
 func TestDockerService_StreamLogs_Error(t *testing.T) {
 	mockClient := new(MockDockerClient)
 	dockerService := NewDockerService(mockClient)
 
 	containerID := "container123"
+	mockClient.On("ContainerInspect", mock.Anything, containerID).Return(types.ContainerJSON{Config: &container.Config{}}, nil)
 	mockClient.On("ContainerLogs", mock.Anything, containerID, mock.AnythingOfType("types.ContainerLogsOptions")).Return(nil, errors.New("mock error"))
 
-	err := dockerService.StreamLogs(containerID, "all")
+	err := dockerService.StreamLogs(context.Background(), containerID, LogOptions{Tail: "all"}, io.Discard, io.Discard)
 	assert.Error(t, err)
 	assert.Equal(t, "mock error", err.Error())
 
-	mockClient.AssertCalled(t, "ContainerLogs", mock.Anything, containerID, mock.AnythingOfType("types.ContainerLogsOptions"))
 	mockClient.AssertExpectations(t)
 }
 
@@ -162,9 +206,6 @@ func TestDockerService_FindContainer(t *testing.T) {
 	mockClient := new(MockDockerClient)
 	dockerService := NewDockerService(mockClient)
 
-	imageName := "example/image:latest"
-	// baseImageName := strings.Split(imageName, ":")[0]
-
 	containerID := "container123"
 	containerList := []types.Container{
 		{
@@ -172,25 +213,24 @@ func TestDockerService_FindContainer(t *testing.T) {
 			Names: []string{
 				"test-container",
 			},
+			Labels: map[string]string{LabelApp: "memos"},
 		},
 	}
 
 	containerJSON := types.ContainerJSON{
 		Config: &container.Config{
-			Image: imageName,
+			Image: "example/image:latest",
 		},
 	}
 
-	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return(containerList, nil)
+	appFilter := types.ContainerListOptions{Filters: filters.NewArgs(filters.Arg("label", LabelApp+"=memos"))}
+	mockClient.On("ContainerList", mock.Anything, appFilter).Return(containerList, nil)
 	mockClient.On("ContainerInspect", mock.Anything, containerID).Return(containerJSON, nil)
 
-	container := dockerService.FindContainer(imageName)
+	container := dockerService.FindContainer(context.Background(), "memos")
 
 	assert.NotNil(t, container)
 	assert.Equal(t, containerID, container.ID)
-
-	mockClient.AssertCalled(t, "ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions"))
-	mockClient.AssertCalled(t, "ContainerInspect", mock.Anything, containerID)
 	mockClient.AssertExpectations(t)
 }
 
@@ -198,100 +238,1112 @@ func TestDockerService_FindContainer_NoMatch(t *testing.T) {
 	mockClient := new(MockDockerClient)
 	dockerService := NewDockerService(mockClient)
 
-	imageName := "example/image:latest"
-	// baseImageName := strings.Split(imageName, ":")[0]
+	// Another app built from the same image carries its own slick.app label.
+	appFilter := types.ContainerListOptions{Filters: filters.NewArgs(filters.Arg("label", LabelApp+"=memos"))}
+	mockClient.On("ContainerList", mock.Anything, appFilter).Return([]types.Container{}, nil)
 
-	containerID := "container123"
-	containerList := []types.Container{
+	container := dockerService.FindContainer(context.Background(), "memos")
+
+	assert.Nil(t, container)
+	mockClient.AssertNotCalled(t, "ContainerInspect", mock.Anything, mock.Anything)
+}
+
+func TestDockerService_AppContainers(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, mock.MatchedBy(func(options types.ContainerListOptions) bool {
+		return options.Filters.ExactMatch("label", LabelApp+"=memos")
+	})).Return([]types.Container{
 		{
-			ID: containerID,
-			Names: []string{
-				"test-container",
-			},
+			ID:     "old",
+			Image:  "example/image:v1",
+			State:  "running",
+			Names:  []string{"/memos-old"},
+			Ports:  []types.Port{{IP: "127.0.0.1", PrivatePort: 8080, PublicPort: 8001, Type: "tcp"}},
+			Labels: map[string]string{LabelApp: "memos", LabelDeployID: "first"},
 		},
-	}
+		{
+			ID:     "worker",
+			Labels: map[string]string{LabelApp: "memos", LabelRole: RoleWorker},
+		},
+		{
+			ID:     "migrate",
+			State:  "running",
+			Labels: map[string]string{LabelApp: "memos", LabelRole: RoleOneOff},
+		},
+		{
+			ID:     "new",
+			Image:  "sha256:0123",
+			State:  "running",
+			Names:  []string{"/memos-new"},
+			Ports:  []types.Port{{PrivatePort: 8080, Type: "tcp"}},
+			Labels: map[string]string{LabelApp: "memos", LabelDeployID: "second"},
+		},
+	}, nil)
 
-	containerJSON := types.ContainerJSON{
-		Config: &container.Config{
-			Image: "different/image:latest",
+	mockClient.On("ContainerInspect", mock.Anything, "old").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Name:  "/memos-old",
+			Image: "sha256:old",
+			State: &types.ContainerState{StartedAt: "2024-01-01T10:00:00Z"},
 		},
+		Config: &container.Config{Image: "example/image:v1"},
+	}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "new").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Name:  "/memos-new",
+			Image: "sha256:new",
+			State: &types.ContainerState{
+				StartedAt: "2024-01-02T10:00:00Z",
+				Health:    &types.Health{Status: "healthy"},
+			},
+		},
+		Config: &container.Config{Image: "example/image:v2"},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"web": {IPAddress: "172.18.0.5"}},
+		},
+	}, nil)
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "sha256:old").Return(types.ImageInspect{}, nil, errors.New("no such image"))
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "sha256:new").Return(types.ImageInspect{
+		RepoDigests: []string{"mirror/image@sha256:aaa", "example/image@sha256:bbb"},
+	}, nil, nil)
+
+	containers, err := dockerService.AppContainers(context.Background(), "memos")
+	assert.NoError(t, err)
+	if assert.Len(t, containers, 2) {
+		newest := containers[0]
+		assert.Equal(t, "new", newest.ID)
+		assert.Equal(t, "memos-new", newest.Name)
+		assert.Equal(t, "example/image:v2", newest.Image)
+		assert.Equal(t, "sha256:bbb", newest.Digest)
+		assert.Equal(t, "healthy", newest.Health)
+		assert.Equal(t, "second", newest.DeployID)
+		assert.Equal(t, Container{ID: "new", Port: 8080, Alias: "memos-new", IP: "172.18.0.5"}, newest.Container)
+
+		oldest := containers[1]
+		assert.Equal(t, "old", oldest.ID)
+		assert.Equal(t, "none", oldest.Health)
+		assert.Empty(t, oldest.Digest)
+		assert.Equal(t, Container{ID: "old", Port: 8001, IP: "127.0.0.1"}, oldest.Container)
+		assert.Equal(t, time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), oldest.StartedAt)
 	}
+}
 
-	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return(containerList, nil)
-	mockClient.On("ContainerInspect", mock.Anything, containerID).Return(containerJSON, nil)
+func TestDockerService_AppContainers_Error(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
 
-	container := dockerService.FindContainer(imageName)
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return(nil, errors.New("mock error"))
 
-	assert.Nil(t, container)
+	_, err := dockerService.AppContainers(context.Background(), "memos")
+	assert.EqualError(t, err, "mock error")
+}
 
-	mockClient.AssertCalled(t, "ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions"))
-	mockClient.AssertCalled(t, "ContainerInspect", mock.Anything, containerID)
+func TestDockerService_RunContainerWithVolumes(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	cfg := config.App{
+		Name:      "test-app",
+		ImageName: "example/image:latest",
+		Volumes:   []string{"/data:/data"},
+	}
+
+	containerID := "container123"
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: containerID}, nil)
+	mockClient.On("ContainerStart", mock.Anything, containerID, types.ContainerStartOptions{}).Return(nil)
+
+	newContainer, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, Metadata{})
+	assert.NoError(t, err)
+	assert.Equal(t, containerID, newContainer.ID)
+
+	mockClient.AssertCalled(t, "ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "")
+	mockClient.AssertCalled(t, "ContainerStart", mock.Anything, containerID, types.ContainerStartOptions{})
 	mockClient.AssertExpectations(t)
 }
 
-func TestDockerService_GetStatus(t *testing.T) {
+func TestDockerService_FindContainer_Port(t *testing.T) {
 	mockClient := new(MockDockerClient)
 	dockerService := NewDockerService(mockClient)
 
-	containerID := "container123"
+	imageName := "example/image:latest"
 	containerList := []types.Container{
 		{
-			ID: containerID,
-			Names: []string{
-				"test-container",
-			},
+			ID: "container123",
 			Ports: []types.Port{
-				{
-					IP:          "127.0.0.1",
-					PrivatePort: 8080,
-					PublicPort:  5000,
-					Type:        "tcp",
-				},
+				{PrivatePort: 8080, Type: "tcp"},
+				{IP: "0.0.0.0", PrivatePort: 8080, PublicPort: 8001, Type: "tcp"},
 			},
 		},
 	}
 
 	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return(containerList, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container123").Return(types.ContainerJSON{
+		Config: &container.Config{Image: imageName},
+	}, nil)
 
-	dockerService.GetStatus()
+	found := dockerService.FindContainer(context.Background(), "memos")
+
+	assert.NotNil(t, found)
+	assert.Equal(t, 8001, found.Port)
+}
+
+func TestDockerService_RestartContainer(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	timeout := 15
+	mockClient.On("ContainerRestart", mock.Anything, "container123", container.StopOptions{
+		Timeout: &timeout,
+	}).Return(nil)
+
+	err := dockerService.RestartContainer(context.Background(), "container123")
+	assert.NoError(t, err)
 
-	mockClient.AssertCalled(t, "ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions"))
 	mockClient.AssertExpectations(t)
 }
 
-func TestDockerService_GetStatus_Error(t *testing.T) {
+// multiplexed encodes lines the way the Docker daemon frames non-TTY logs.
+func multiplexed(stdout, stderr string) io.ReadCloser {
+	var buf bytes.Buffer
+	if stdout != "" {
+		_, _ = stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(stdout))
+	}
+	if stderr != "" {
+		_, _ = stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte(stderr))
+	}
+	return io.NopCloser(&buf)
+}
+
+func waitResult(code int64) (<-chan container.WaitResponse, <-chan error) {
+	waitCh := make(chan container.WaitResponse, 1)
+	waitCh <- container.WaitResponse{StatusCode: code}
+	return waitCh, make(chan error)
+}
+
+func TestDockerService_RunOneOff(t *testing.T) {
 	mockClient := new(MockDockerClient)
 	dockerService := NewDockerService(mockClient)
 
-	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return(nil, errors.New("mock error"))
+	cfg := config.App{
+		Name:    "memos",
+		ENV:     []string{"__SLICK_TEST_ENV"},
+		Volumes: []string{"/data:/data"},
+		Network: "slick-test",
+	}
+	t.Setenv("__SLICK_TEST_ENV", "test_value")
+
+	waitCh, errCh := waitResult(0)
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return c.Image == "example/image:v2" && c.Cmd[0] == "migrate" && c.Env[0] == "__SLICK_TEST_ENV=test_value" &&
+			c.Labels[LabelApp] == "memos" && c.Labels[LabelRole] == RoleOneOff
+	}), mock.MatchedBy(func(h *container.HostConfig) bool {
+		return len(h.PortBindings) == 0 && h.Binds[0] == "/data:/data" && string(h.NetworkMode) == "slick-test"
+	}), mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: "oneoff"}, nil)
+	mockClient.On("ContainerWait", mock.Anything, "oneoff", container.WaitConditionNextExit).Return(waitCh, errCh)
+	mockClient.On("ContainerStart", mock.Anything, "oneoff", types.ContainerStartOptions{}).Return(nil)
+	mockClient.On("ContainerLogs", mock.Anything, "oneoff", mock.Anything).Return(multiplexed("migrated\n", "warning\n"), nil)
+	mockClient.On("ContainerRemove", mock.Anything, "oneoff", types.ContainerRemoveOptions{Force: true}).Return(nil)
+
+	var out bytes.Buffer
+	code, err := dockerService.RunOneOff(context.Background(), "example/image:v2", cfg, []string{"migrate"}, &out, &out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "migrated\nwarning\n", out.String())
+	mockClient.AssertExpectations(t)
+}
+
+func TestDockerService_RunOneOff_ExitCode(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	waitCh, errCh := waitResult(3)
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: "oneoff"}, nil)
+	mockClient.On("ContainerWait", mock.Anything, "oneoff", container.WaitConditionNextExit).Return(waitCh, errCh)
+	mockClient.On("ContainerStart", mock.Anything, "oneoff", types.ContainerStartOptions{}).Return(nil)
+	mockClient.On("ContainerLogs", mock.Anything, "oneoff", mock.Anything).Return(multiplexed("", "boom\n"), nil)
+	mockClient.On("ContainerRemove", mock.Anything, "oneoff", types.ContainerRemoveOptions{Force: true}).Return(nil)
+
+	var out bytes.Buffer
+	code, err := dockerService.RunOneOff(context.Background(), "example/image:v2", config.App{}, []string{"false"}, &out, &out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, code)
+}
+
+func TestDockerService_RunOneOff_CreateError(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "").Return(container.CreateResponse{}, errors.New("no such image"))
 
-	err := dockerService.GetStatus()
+	_, err := dockerService.RunOneOff(context.Background(), "example/image:v2", config.App{}, []string{"true"}, io.Discard, io.Discard)
 	assert.Error(t, err)
-	assert.Equal(t, "mock error", err.Error())
+	mockClient.AssertNotCalled(t, "ContainerStart", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDockerService_ListContainers(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{
+		{
+			ID:      "container123",
+			Image:   "example/image:latest",
+			Created: 1700000000,
+			State:   "running",
+			Names:   []string{"/memos"},
+			Ports: []types.Port{
+				{IP: "127.0.0.1", PrivatePort: 8080, PublicPort: 5000, Type: "tcp"},
+			},
+		},
+	}, nil)
+
+	statuses, err := dockerService.ListContainers(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "container123", statuses[0].ID)
+	assert.Equal(t, []string{"127.0.0.1:5000->8080/tcp"}, statuses[0].Ports)
+	assert.Equal(t, int64(1700000000), statuses[0].Created.Unix())
+}
 
-	mockClient.AssertCalled(t, "ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions"))
+func TestDockerService_RunContainer_SkipsPublishedPorts(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+	dockerService.Store = state.NewStore(t.TempDir())
+
+	cfg := config.App{
+		Name:          "test-app",
+		ImageName:     "example/image:latest",
+		ContainerPort: 8080,
+		PortRange:     config.PortRange{Start: 45100, End: 45110},
+	}
+
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{
+		{ID: "other", Ports: []types.Port{{PrivatePort: 80, PublicPort: 45100, Type: "tcp"}}},
+	}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: "container123"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container123", types.ContainerStartOptions{}).Return(nil)
+
+	first, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, Metadata{})
+	assert.NoError(t, err)
+	assert.Equal(t, 45101, first.Port)
+
+	// The port of the first container is reserved even though nothing listens on it yet
+	second, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, Metadata{})
+	assert.NoError(t, err)
+	assert.Equal(t, 45102, second.Port)
+}
+
+func TestDockerService_RunContainer_RetriesAllocatedPort(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+	dockerService.Store = state.NewStore(t.TempDir())
+
+	cfg := config.App{
+		Name:          "test-app",
+		ImageName:     "example/image:latest",
+		ContainerPort: 8080,
+		PortRange:     config.PortRange{Start: 45200, End: 45210},
+	}
+
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: "taken"}, nil).Once()
+	mockClient.On("ContainerStart", mock.Anything, "taken", types.ContainerStartOptions{}).Return(errors.New("Bind for 0.0.0.0:45200 failed: port is already allocated"))
+	mockClient.On("ContainerRemove", mock.Anything, "taken", types.ContainerRemoveOptions{Force: true}).Return(nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: "container123"}, nil).Once()
+	mockClient.On("ContainerStart", mock.Anything, "container123", types.ContainerStartOptions{}).Return(nil)
+
+	newContainer, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, Metadata{})
+	assert.NoError(t, err)
+	assert.Equal(t, "container123", newContainer.ID)
+	assert.Equal(t, 45201, newContainer.Port)
 	mockClient.AssertExpectations(t)
 }
 
-func TestDockerService_RunContainerWithVolumes(t *testing.T) {
+func TestDockerService_RunContainer_StartError(t *testing.T) {
 	mockClient := new(MockDockerClient)
 	dockerService := NewDockerService(mockClient)
 
 	cfg := config.App{
-		Name:      "test-app",
-		ImageName: "example/image:latest",
-		Volumes:   []string{"/data:/data"},
+		Name:          "test-app",
+		ImageName:     "example/image:latest",
+		ContainerPort: 8080,
+		PortRange:     config.PortRange{Start: 45300, End: 45310},
+	}
+
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: "container123"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container123", types.ContainerStartOptions{}).Return(errors.New("no such image"))
+	mockClient.On("ContainerRemove", mock.Anything, "container123", types.ContainerRemoveOptions{Force: true}).Return(nil)
+
+	_, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, Metadata{})
+	assert.Error(t, err)
+	mockClient.AssertNumberOfCalls(t, "ContainerCreate", 1)
+}
+
+func TestDockerService_RunContainer_Network(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	cfg := config.App{
+		Name:          "memos",
+		ImageName:     "example/image:latest",
+		ContainerPort: 5230,
+		Network:       "web",
+		Expose:        config.ExposeNetwork,
+	}
+
+	mockClient.On("NetworkInspect", mock.Anything, "web", types.NetworkInspectOptions{}).Return(types.NetworkResource{}, errdefs.NotFound(errors.New("network web not found")))
+	mockClient.On("NetworkCreate", mock.Anything, "web", mock.AnythingOfType("types.NetworkCreate")).Return(types.NetworkCreateResponse{ID: "net123"}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.MatchedBy(func(hostConfig *container.HostConfig) bool {
+		return len(hostConfig.PortBindings) == 0 && hostConfig.NetworkMode == "web"
+	}), mock.MatchedBy(func(networkingConfig *network.NetworkingConfig) bool {
+		endpoint := networkingConfig.EndpointsConfig["web"]
+		return endpoint != nil && len(endpoint.Aliases) == 1 && strings.HasPrefix(endpoint.Aliases[0], "memos-")
+	}), mock.Anything, "").Return(container.CreateResponse{ID: "container123"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container123", types.ContainerStartOptions{}).Return(nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container123").Return(types.ContainerJSON{
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"web": {IPAddress: "172.18.0.5"}},
+		},
+	}, nil)
+
+	newContainer, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, Metadata{})
+	assert.NoError(t, err)
+	assert.Equal(t, 5230, newContainer.Port)
+	assert.True(t, strings.HasPrefix(newContainer.Alias, "memos-"))
+	assert.Equal(t, "172.18.0.5:5230", newContainer.Address())
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "ContainerList", mock.Anything, mock.Anything)
+}
+
+func TestDockerService_EnsureNetwork_Exists(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("NetworkInspect", mock.Anything, "web", types.NetworkInspectOptions{}).Return(types.NetworkResource{ID: "net123"}, nil)
+
+	assert.NoError(t, dockerService.EnsureNetwork(context.Background(), "web"))
+	mockClient.AssertNotCalled(t, "NetworkCreate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDockerService_EnsureNetwork_InspectError(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("NetworkInspect", mock.Anything, "web", types.NetworkInspectOptions{}).Return(types.NetworkResource{}, errors.New("daemon unavailable"))
+
+	assert.Error(t, dockerService.EnsureNetwork(context.Background(), "web"))
+	mockClient.AssertNotCalled(t, "NetworkCreate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDockerService_FindContainer_Network(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	imageName := "example/image:latest"
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{
+		{ID: "container123", Ports: []types.Port{{PrivatePort: 5230, Type: "tcp"}}},
+	}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container123").Return(types.ContainerJSON{
+		Config: &container.Config{Image: imageName},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"web": {IPAddress: "172.18.0.5"}},
+		},
+	}, nil)
+
+	found := dockerService.FindContainer(context.Background(), "memos")
+	assert.NotNil(t, found)
+	assert.Equal(t, "172.18.0.5:5230", found.Address())
+}
+
+func TestDockerService_RunContainer_BindAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		bindAddress string
+		hostIP      string
+		address     string
+	}{
+		{"default loopback", "", "127.0.0.1", "127.0.0.1:45400"},
+		{"ipv6 loopback", "::1", "::1", "[::1]:45400"},
+		{"public", "0.0.0.0", "0.0.0.0", "localhost:45400"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.bindAddress == "::1" {
+				ln, err := net.Listen("tcp", "[::1]:0")
+				if err != nil {
+					t.Skipf("IPv6 loopback is not available: %v", err)
+				}
+				ln.Close()
+			}
+
+			mockClient := new(MockDockerClient)
+			dockerService := NewDockerService(mockClient)
+
+			cfg := config.App{
+				Name:          "test-app",
+				ImageName:     "example/image:latest",
+				ContainerPort: 8080,
+				BindAddress:   tt.bindAddress,
+				PortRange:     config.PortRange{Start: 45400, End: 45410},
+			}
+
+			mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{}, nil)
+			mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.MatchedBy(func(hostConfig *container.HostConfig) bool {
+				bindings := hostConfig.PortBindings["8080/tcp"]
+				return len(bindings) == 1 && bindings[0].HostIP == tt.hostIP
+			}), mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: "container123"}, nil)
+			mockClient.On("ContainerStart", mock.Anything, "container123", types.ContainerStartOptions{}).Return(nil)
+
+			newContainer, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, Metadata{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.address, newContainer.Address())
+			mockClient.AssertExpectations(t)
+		})
 	}
+}
+
+func TestDockerService_StopContainer_ConfiguredTimeout(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
 
 	containerID := "container123"
-	mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "").Return(container.CreateResponse{ID: containerID}, nil)
-	mockClient.On("ContainerStart", mock.Anything, containerID, types.ContainerStartOptions{}).Return(nil)
+	stopTimeout := 60
+	mockClient.On("ContainerInspect", mock.Anything, containerID).Return(types.ContainerJSON{
+		Config: &container.Config{StopTimeout: &stopTimeout},
+	}, nil)
+	mockClient.On("ContainerStop", mock.Anything, containerID, container.StopOptions{}).Return(nil)
+	mockClient.On("ContainerRemove", mock.Anything, containerID, types.ContainerRemoveOptions{}).Return(nil)
 
-	newContainer, err := dockerService.RunContainer(cfg.ImageName, cfg)
+	err := dockerService.StopContainer(context.Background(), containerID)
 	assert.NoError(t, err)
-	assert.Equal(t, containerID, newContainer.ID)
+	mockClient.AssertExpectations(t)
+}
 
-	mockClient.AssertCalled(t, "ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "")
-	mockClient.AssertCalled(t, "ContainerStart", mock.Anything, containerID, types.ContainerStartOptions{})
+func TestDockerService_RunContainer_RuntimeOptions(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	cfg := config.App{
+		Name:          "test-app",
+		ImageName:     "example/image:latest",
+		ContainerPort: 8080,
+		PortRange:     config.PortRange{Start: 45500, End: 45510},
+		Command:       []string{"serve", "--port", "8080"},
+		User:          "1000:1000",
+		Restart:       "on-failure:3",
+		Memory:        "512m",
+		CPUs:          1.5,
+		Ulimits:       []string{"nofile=1024:2048"},
+		ReadOnly:      true,
+		Tmpfs:         []string{"/tmp:size=64m"},
+		Logging:       config.LoggingConfig{Driver: "json-file", Options: map[string]string{"max-size": "10m"}},
+		StopTimeout:   30,
+		Devices:       []string{"/dev/fuse"},
+	}
+
+	var created *container.Config
+	var hostConfig *container.HostConfig
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.AnythingOfType("*container.Config"), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "").Run(func(args mock.Arguments) {
+		created = args.Get(1).(*container.Config)
+		hostConfig = args.Get(2).(*container.HostConfig)
+	}).Return(container.CreateResponse{ID: "container123"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container123", types.ContainerStartOptions{}).Return(nil)
+
+	_, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, Metadata{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"serve", "--port", "8080"}, []string(created.Cmd))
+	assert.Equal(t, "1000:1000", created.User)
+	assert.Equal(t, 30, *created.StopTimeout)
+	assert.Equal(t, container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}, hostConfig.RestartPolicy)
+	assert.Equal(t, int64(512*1024*1024), hostConfig.Memory)
+	assert.Equal(t, int64(1500000000), hostConfig.NanoCPUs)
+	assert.Equal(t, "nofile", hostConfig.Ulimits[0].Name)
+	assert.Equal(t, int64(2048), hostConfig.Ulimits[0].Hard)
+	assert.True(t, hostConfig.ReadonlyRootfs)
+	assert.Equal(t, map[string]string{"/tmp": "size=64m"}, hostConfig.Tmpfs)
+	assert.Equal(t, "json-file", hostConfig.LogConfig.Type)
+	assert.Equal(t, []container.DeviceMapping{{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rwm"}}, hostConfig.Devices)
+}
+
+func TestContainerName(t *testing.T) {
+	assert.Equal(t, "memos-1a2b3c", ContainerName("memos", "20240101120000-1a2b3c"))
+	assert.Equal(t, "my-app-1a2b3c", ContainerName("My App!", "20240101120000-1a2b3c"))
+	assert.Equal(t, "app-1a2b3c", ContainerName("", "20240101120000-1a2b3c"))
+	assert.Equal(t, "", ContainerName("memos", ""))
+}
+
+func TestMetadata_Labels(t *testing.T) {
+	meta := Metadata{
+		DeployID:   "20240101120000-1a2b3c",
+		GitSHA:     "abc123",
+		DeployedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	assert.Equal(t, map[string]string{
+		LabelApp:        "memos",
+		LabelDeployID:   "20240101120000-1a2b3c",
+		LabelGitSHA:     "abc123",
+		LabelDeployedAt: "2024-01-01T12:00:00Z",
+	}, meta.Labels("memos"))
+}
+
+func TestDockerService_RunContainer_NameAndLabels(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	cfg := config.App{
+		Name:          "memos",
+		ImageName:     "example/image:latest",
+		ContainerPort: 8080,
+		PortRange:     config.PortRange{Start: 45600, End: 45610},
+		Labels:        map[string]string{"team": "platform", LabelApp: "other"},
+	}
+	meta := Metadata{DeployID: "20240101120000-1a2b3c", Deployer: "ci", ConfigHash: "f00"}
+
+	mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return c.Labels[LabelDeployID] == meta.DeployID &&
+			c.Labels[LabelDeployer] == "ci" &&
+			c.Labels[LabelConfigHash] == "f00" &&
+			c.Labels["team"] == "platform" &&
+			c.Labels[LabelApp] == "memos"
+	}), mock.AnythingOfType("*container.HostConfig"), mock.Anything, mock.Anything, "memos-1a2b3c").Return(container.CreateResponse{ID: "container123"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container123", types.ContainerStartOptions{}).Return(nil)
+
+	_, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, meta)
+	assert.NoError(t, err)
 	mockClient.AssertExpectations(t)
 }
+
+func TestDockerService_RunContainer_NameConflict(t *testing.T) {
+	cfg := config.App{
+		Name:          "memos",
+		ImageName:     "example/image:latest",
+		ContainerPort: 8080,
+		PortRange:     config.PortRange{Start: 45700, End: 45710},
+	}
+	meta := Metadata{DeployID: "20240101120000-1a2b3c"}
+	conflict := errdefs.Conflict(errors.New(`Conflict. The container name "/memos-1a2b3c" is already in use`))
+
+	t.Run("stopped container is removed", func(t *testing.T) {
+		mockClient := new(MockDockerClient)
+		dockerService := NewDockerService(mockClient)
+
+		mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{}, nil)
+		mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "memos-1a2b3c").Return(container.CreateResponse{}, conflict).Once()
+		mockClient.On("ContainerInspect", mock.Anything, "memos-1a2b3c").Return(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "stale", State: &types.ContainerState{Running: false}},
+		}, nil)
+		mockClient.On("ContainerRemove", mock.Anything, "stale", types.ContainerRemoveOptions{Force: true}).Return(nil)
+		mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "memos-1a2b3c").Return(container.CreateResponse{ID: "container123"}, nil).Once()
+		mockClient.On("ContainerStart", mock.Anything, "container123", types.ContainerStartOptions{}).Return(nil)
+
+		newContainer, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, meta)
+		assert.NoError(t, err)
+		assert.Equal(t, "container123", newContainer.ID)
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("running container keeps its name", func(t *testing.T) {
+		mockClient := new(MockDockerClient)
+		dockerService := NewDockerService(mockClient)
+
+		mockClient.On("ContainerList", mock.Anything, mock.AnythingOfType("types.ContainerListOptions")).Return([]types.Container{}, nil)
+		mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "memos-1a2b3c").Return(container.CreateResponse{}, conflict).Once()
+		mockClient.On("ContainerInspect", mock.Anything, "memos-1a2b3c").Return(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "live", State: &types.ContainerState{Running: true}},
+		}, nil)
+		mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.MatchedBy(func(name string) bool {
+			return strings.HasPrefix(name, "memos-1a2b3c-")
+		})).Return(container.CreateResponse{ID: "container123"}, nil).Once()
+		mockClient.On("ContainerStart", mock.Anything, "container123", types.ContainerStartOptions{}).Return(nil)
+
+		_, err := dockerService.RunContainer(context.Background(), cfg.ImageName, cfg, meta)
+		assert.NoError(t, err)
+		mockClient.AssertNotCalled(t, "ContainerRemove", mock.Anything, "live", mock.Anything)
+	})
+}
+
+func TestDockerService_StartAccessory_Create(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	accessory := config.Accessory{
+		Name:    "redis",
+		Image:   "redis:7",
+		Volumes: []string{"redis_data:/data"},
+		Network: "web",
+		Ports:   []string{"127.0.0.1:6379:6379"},
+		Restart: "unless-stopped",
+	}
+
+	mockClient.On("ContainerList", mock.Anything, mock.MatchedBy(func(o types.ContainerListOptions) bool {
+		return o.All && o.Filters.ExactMatch("label", LabelService+"=redis")
+	})).Return([]types.Container{}, nil)
+	mockClient.On("ImagePull", mock.Anything, "redis:7", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil)
+	mockClient.On("NetworkInspect", mock.Anything, "web", types.NetworkInspectOptions{}).Return(types.NetworkResource{ID: "net123"}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return c.Image == "redis:7" &&
+			c.Labels[LabelApp] == "memos" &&
+			c.Labels[LabelRole] == RoleAccessory &&
+			c.Labels[LabelService] == "redis"
+	}), mock.MatchedBy(func(h *container.HostConfig) bool {
+		bindings := h.PortBindings["6379/tcp"]
+		return h.RestartPolicy.Name == "unless-stopped" &&
+			h.NetworkMode == "web" &&
+			len(h.Binds) == 1 &&
+			len(bindings) == 1 && bindings[0].HostIP == "127.0.0.1"
+	}), mock.MatchedBy(func(n *network.NetworkingConfig) bool {
+		return n.EndpointsConfig["web"].Aliases[0] == "redis"
+	}), mock.Anything, "memos-redis").Return(container.CreateResponse{ID: "acc123"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "acc123", types.ContainerStartOptions{}).Return(nil)
+
+	id, err := dockerService.StartAccessory(context.Background(), "memos", accessory)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "acc123", id)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDockerService_StartAccessory_Existing(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+		{ID: "acc123", State: "exited"},
+	}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "acc123", types.ContainerStartOptions{}).Return(nil)
+
+	id, err := dockerService.StartAccessory(context.Background(), "memos", config.Accessory{Name: "redis", Image: "redis:7"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "acc123", id)
+	mockClient.AssertNotCalled(t, "ImagePull", mock.Anything, mock.Anything, mock.Anything)
+	mockClient.AssertNotCalled(t, "ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDockerService_StartAccessory_Running(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+		{ID: "acc123", State: "running"},
+	}, nil)
+
+	id, err := dockerService.StartAccessory(context.Background(), "memos", config.Accessory{Name: "redis", Image: "redis:7"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "acc123", id)
+	mockClient.AssertNotCalled(t, "ContainerStart", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDockerService_StopAccessory(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, mock.MatchedBy(func(o types.ContainerListOptions) bool {
+		return !o.All && o.Filters.ExactMatch("label", LabelRole+"="+RoleAccessory)
+	})).Return([]types.Container{
+		{ID: "acc123", Labels: map[string]string{LabelService: "redis"}},
+	}, nil)
+	mockClient.On("ContainerStop", mock.Anything, "acc123", mock.Anything).Return(nil)
+
+	err := dockerService.StopAccessory(context.Background(), "memos", "redis")
+
+	assert.NoError(t, err)
+	mockClient.AssertNotCalled(t, "ContainerRemove", mock.Anything, mock.Anything, mock.Anything)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDockerService_FindAccessory_Missing(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+
+	_, err := dockerService.FindAccessory(context.Background(), "memos", "redis")
+
+	assert.EqualError(t, err, "accessory redis is not running")
+}
+
+func TestDockerService_RunWorker(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	appCfg := config.App{
+		Name:          "memos",
+		ContainerPort: 5230,
+		Network:       "web",
+		Command:       []string{"serve"},
+		Restart:       "always",
+	}
+	worker := config.Worker{Name: "jobs", Command: []string{"bundle", "exec", "sidekiq"}}
+	meta := Metadata{DeployID: "20240102-150405-abcd12"}
+
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return len(c.Cmd) == 3 && c.Cmd[2] == "sidekiq" &&
+			len(c.ExposedPorts) == 0 &&
+			c.Labels[LabelRole] == RoleWorker &&
+			c.Labels[LabelService] == "jobs" &&
+			c.Labels[LabelDeployID] == meta.DeployID
+	}), mock.MatchedBy(func(h *container.HostConfig) bool {
+		return len(h.PortBindings) == 0 &&
+			h.NetworkMode == "web" &&
+			h.RestartPolicy.Name == "always"
+	}), mock.Anything, mock.Anything, "memos-jobs-abcd12").Return(container.CreateResponse{ID: "worker123"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "worker123", types.ContainerStartOptions{}).Return(nil)
+
+	id, err := dockerService.RunWorker(context.Background(), "example/image:latest", appCfg, worker, meta)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "worker123", id)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDockerService_FindContainer_SkipsWorkers(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	imageName := "example/image:latest"
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+		{ID: "worker123", Labels: map[string]string{LabelRole: RoleWorker}},
+		{ID: "oneoff123", Labels: map[string]string{LabelRole: RoleOneOff}},
+		{ID: "web123"},
+	}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "web123").Return(types.ContainerJSON{
+		Config: &container.Config{Image: imageName},
+	}, nil)
+
+	found := dockerService.FindContainer(context.Background(), "memos")
+
+	assert.NotNil(t, found)
+	assert.Equal(t, "web123", found.ID)
+	mockClient.AssertNotCalled(t, "ContainerInspect", mock.Anything, "worker123")
+	mockClient.AssertNotCalled(t, "ContainerInspect", mock.Anything, "oneoff123")
+}
+
+func TestDockerService_HasImage(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "memos:1").Return(types.ImageInspect{ID: "sha256:memos"}, nil, nil)
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "memos:2").Return(types.ImageInspect{}, nil, errors.New("no such image"))
+
+	assert.True(t, dockerService.HasImage(context.Background(), "memos:1"))
+	assert.False(t, dockerService.HasImage(context.Background(), "memos:2"))
+}
+
+func TestDockerService_ImagePorts(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ImagePull", mock.Anything, "nginx", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil)
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "nginx").Return(types.ImageInspect{
+		Config: &container.Config{
+			ExposedPorts: nat.PortSet{"443/tcp": {}, "80/tcp": {}, "53/udp": {}},
+		},
+	}, nil, nil)
+
+	ports, err := dockerService.ImagePorts(context.Background(), "nginx")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{80, 443}, ports)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDockerService_RunningSpec(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerInspect", mock.Anything, "abc123").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Image: "sha256:image",
+			HostConfig: &container.HostConfig{
+				Binds:       []string{"/data:/data"},
+				NetworkMode: "bridge",
+			},
+		},
+		Config: &container.Config{
+			Image: "example/image:v1",
+			Env:   []string{"PATH=/usr/bin", "LANG=C.UTF-8", "DATABASE_URL=postgres://db"},
+		},
+	}, nil)
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "sha256:image").Return(types.ImageInspect{
+		RepoDigests: []string{"example/image@sha256:aaa"},
+		Config:      &container.Config{Env: []string{"PATH=/usr/bin", "LANG=C"}},
+	}, nil, nil)
+
+	spec, err := dockerService.RunningSpec(context.Background(), "abc123")
+	assert.NoError(t, err)
+	assert.Equal(t, Spec{
+		Image:   "example/image:v1",
+		Digest:  "sha256:aaa",
+		Env:     map[string]string{"LANG": "C.UTF-8", "DATABASE_URL": "postgres://db"},
+		Volumes: []string{"/data:/data"},
+	}, spec)
+}
+
+func TestDockerService_DesiredSpec(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://db")
+
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	appCfg := config.App{
+		ImageName: "example/image:v2",
+		ENV:       []string{"DATABASE_URL", "UNSET_VARIABLE"},
+		Network:   "web",
+	}
+
+	mockClient.On("DistributionInspect", mock.Anything, "example/image:v2", mock.Anything).Return(registry.DistributionInspect{
+		Descriptor: ocispec.Descriptor{Digest: "sha256:bbb"},
+	}, nil).Once()
+
+	spec, err := dockerService.DesiredSpec(context.Background(), appCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, Spec{
+		Image:   "example/image:v2",
+		Digest:  "sha256:bbb",
+		Env:     map[string]string{"DATABASE_URL": "postgres://db"},
+		Network: "web",
+	}, spec)
+
+	// Images only built locally have no registry to ask.
+	mockClient.On("DistributionInspect", mock.Anything, "example/image:v2", mock.Anything).Return(registry.DistributionInspect{}, errors.New("unauthorized"))
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "example/image:v2").Return(types.ImageInspect{}, nil, errors.New("no such image"))
+
+	spec, err = dockerService.DesiredSpec(context.Background(), appCfg)
+	assert.NoError(t, err)
+	assert.Empty(t, spec.Digest)
+}
+
+func TestDockerService_Prune(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, types.ContainerListOptions{All: true}).Return([]types.Container{
+		{ID: "running", State: "running", ImageID: "sha256:v3", Labels: map[string]string{LabelApp: "memos"}},
+		{ID: "exited", Names: []string{"/memos-1"}, State: "exited", ImageID: "sha256:v1", Labels: map[string]string{LabelApp: "memos"}},
+		{ID: "db", Names: []string{"/memos-db"}, State: "exited", ImageID: "sha256:pg", Labels: map[string]string{LabelApp: "memos", LabelRole: RoleAccessory}},
+		{ID: "other", State: "exited", ImageID: "sha256:other", Labels: map[string]string{LabelApp: "blog"}},
+	}, nil)
+	mockClient.On("ContainerRemove", mock.Anything, "exited", types.ContainerRemoveOptions{}).Return(nil)
+	mockClient.On("ImageList", mock.Anything, types.ImageListOptions{}).Return([]types.ImageSummary{
+		{ID: "sha256:v3", RepoTags: []string{"ghcr.io/acme/memos:3"}, Size: 30},
+		{ID: "sha256:v2", RepoTags: []string{"ghcr.io/acme/memos:2"}, Size: 20},
+		{ID: "sha256:v1", RepoTags: []string{"ghcr.io/acme/memos:1", "ghcr.io/acme/memos:stable"}, Size: 10},
+		{ID: "sha256:v0", RepoTags: []string{"<none>:<none>"}, RepoDigests: []string{"ghcr.io/acme/memos@sha256:aaa"}, Size: 5},
+		{ID: "sha256:shared", RepoTags: []string{"ghcr.io/acme/memos:0", "ghcr.io/acme/base:1"}, Size: 1},
+		{ID: "sha256:pg", RepoTags: []string{"postgres:16"}, Size: 100},
+	}, nil)
+	removeOptions := types.ImageRemoveOptions{PruneChildren: true}
+	mockClient.On("ImageRemove", mock.Anything, "ghcr.io/acme/memos:1", removeOptions).Return(nil, nil)
+	mockClient.On("ImageRemove", mock.Anything, "ghcr.io/acme/memos:stable", removeOptions).Return(nil, nil)
+	mockClient.On("ImageRemove", mock.Anything, "sha256:v0", removeOptions).Return(nil, errors.New("conflict"))
+
+	report, err := dockerService.Prune(context.Background(), "memos", PruneOptions{
+		Keep: []string{"ghcr.io/acme/memos:3", "ghcr.io/acme/memos:2"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"memos-1"}, report.Containers)
+	assert.Equal(t, []string{"ghcr.io/acme/memos:1"}, report.Images)
+	assert.Equal(t, int64(10), report.SpaceReclaimed)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDockerService_Prune_DryRun(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, types.ContainerListOptions{All: true}).Return([]types.Container{
+		{ID: "exited", Names: []string{"/memos-1"}, State: "exited", ImageID: "sha256:v1", Labels: map[string]string{LabelApp: "memos"}},
+	}, nil)
+	mockClient.On("ImageList", mock.Anything, types.ImageListOptions{}).Return([]types.ImageSummary{
+		{ID: "sha256:v2", RepoTags: []string{"memos:latest"}, Size: 20},
+		{ID: "sha256:v1", RepoDigests: []string{"memos@sha256:aaa"}, Size: 10},
+	}, nil)
+
+	report, err := dockerService.Prune(context.Background(), "memos", PruneOptions{Keep: []string{"docker.io/memos"}, DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"memos-1"}, report.Containers)
+	assert.Equal(t, []string{"memos@sha256:aaa"}, report.Images)
+	mockClient.AssertNotCalled(t, "ContainerRemove", mock.Anything, mock.Anything, mock.Anything)
+	mockClient.AssertNotCalled(t, "ImageRemove", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDockerService_Prune_ListError(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, types.ContainerListOptions{All: true}).Return(nil, errors.New("daemon down"))
+
+	_, err := dockerService.Prune(context.Background(), "memos", PruneOptions{Keep: []string{"memos:1"}})
+	assert.EqualError(t, err, "daemon down")
+}
+
+func TestRepositoryOf(t *testing.T) {
+	assert.Equal(t, "memos", repositoryOf("memos:1"))
+	assert.Equal(t, "registry:5000/acme/memos", repositoryOf("registry:5000/acme/memos:1"))
+	assert.Equal(t, "registry:5000/acme/memos", repositoryOf("registry:5000/acme/memos"))
+	assert.Equal(t, "memos", repositoryOf("memos@sha256:aaa"))
+}
+
+func TestDockerService_RetireContainer(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	timeout := 15
+	mockClient.On("ContainerUpdate", mock.Anything, "abc123", container.UpdateConfig{
+		RestartPolicy: container.RestartPolicy{Name: "no"},
+	}).Return(nil)
+	mockClient.On("ContainerInspect", mock.Anything, "abc123").Return(types.ContainerJSON{Config: &container.Config{}}, nil)
+	mockClient.On("ContainerStop", mock.Anything, "abc123", container.StopOptions{Timeout: &timeout}).Return(nil)
+
+	err := dockerService.RetireContainer(context.Background(), "abc123")
+	assert.NoError(t, err)
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "ContainerRemove", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDockerService_Processes(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, types.ContainerListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", LabelApp+"=memos"),
+			filters.Arg("label", LabelDeployID+"=d1"),
+		),
+	}).Return([]types.Container{
+		{ID: "jobs", Names: []string{"/memos-jobs-d1"}, State: "exited", Labels: map[string]string{LabelRole: RoleWorker, LabelService: "jobs", LabelDeployID: "d1"}},
+		{ID: "db", Names: []string{"/memos-db"}, State: "running", Labels: map[string]string{LabelRole: RoleAccessory}},
+		{ID: "migrate", State: "running", Labels: map[string]string{LabelRole: RoleOneOff}},
+		{ID: "web", Names: []string{"/memos-d1"}, State: "running", Labels: map[string]string{LabelDeployID: "d1"}},
+	}, nil)
+
+	processes, err := dockerService.Processes(context.Background(), "memos", "d1")
+	assert.NoError(t, err)
+	assert.Equal(t, []Process{
+		{ID: "web", Name: "memos-d1", Service: ServiceWeb, DeployID: "d1", Running: true},
+		{ID: "jobs", Name: "memos-jobs-d1", Service: "jobs", DeployID: "d1"},
+	}, processes)
+}
+
+func TestDockerService_Prune_KeepDeploys(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerList", mock.Anything, types.ContainerListOptions{All: true}).Return([]types.Container{
+		{ID: "recent", State: "exited", ImageID: "sha256:v2", Labels: map[string]string{LabelApp: "memos", LabelDeployID: "d2"}},
+		{ID: "old", Names: []string{"/memos-d1"}, State: "exited", ImageID: "sha256:v1", Labels: map[string]string{LabelApp: "memos", LabelDeployID: "d1"}},
+	}, nil)
+	mockClient.On("ContainerRemove", mock.Anything, "old", types.ContainerRemoveOptions{}).Return(nil)
+	mockClient.On("ImageList", mock.Anything, types.ImageListOptions{}).Return([]types.ImageSummary{}, nil)
+
+	report, err := dockerService.Prune(context.Background(), "memos", PruneOptions{Keep: []string{"memos:3"}, KeepDeploys: []string{"d2"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"memos-d1"}, report.Containers)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDockerService_Exec(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	var stream bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&stream, stdcopy.Stdout).Write([]byte("migrated\n"))
+	_, _ = stdcopy.NewStdWriter(&stream, stdcopy.Stderr).Write([]byte("1 warning\n"))
+	conn, server := net.Pipe()
+	defer server.Close()
+
+	mockClient.On("ContainerExecCreate", mock.Anything, "abc123", types.ExecConfig{
+		Cmd:          []string{"rake", "db:migrate"},
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	}).Return(types.IDResponse{ID: "exec1"}, nil)
+	// The command answers once it has read its input.
+	output, writeOutput := io.Pipe()
+	stdin := make(chan string, 1)
+	go func() {
+		data := make([]byte, 4)
+		_, _ = io.ReadFull(server, data)
+		stdin <- string(data)
+		_, _ = io.Copy(writeOutput, &stream)
+		writeOutput.Close()
+	}()
+	mockClient.On("ContainerExecAttach", mock.Anything, "exec1", types.ExecStartCheck{}).Return(types.HijackedResponse{
+		Conn:   conn,
+		Reader: bufio.NewReader(output),
+	}, nil)
+	mockClient.On("ContainerExecInspect", mock.Anything, "exec1").Return(types.ContainerExecInspect{ExitCode: 3}, nil)
+
+	var stdout, stderr bytes.Buffer
+	code, err := dockerService.Exec(context.Background(), "abc123", ExecOptions{
+		Cmd:    []string{"rake", "db:migrate"},
+		Stdin:  strings.NewReader("yes\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "migrated\n", stdout.String())
+	assert.Equal(t, "1 warning\n", stderr.String())
+	assert.Equal(t, "yes\n", <-stdin)
+}
+
+func TestDockerService_Exec_TTY(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	conn, server := net.Pipe()
+	defer server.Close()
+	size := [2]uint{24, 80}
+
+	mockClient.On("ContainerExecCreate", mock.Anything, "abc123", types.ExecConfig{
+		Cmd:          []string{"sh"},
+		Tty:          true,
+		ConsoleSize:  &size,
+		AttachStdout: true,
+		AttachStderr: true,
+	}).Return(types.IDResponse{ID: "exec1"}, nil)
+	mockClient.On("ContainerExecAttach", mock.Anything, "exec1", types.ExecStartCheck{Tty: true, ConsoleSize: &size}).Return(types.HijackedResponse{
+		Conn:   conn,
+		Reader: bufio.NewReader(strings.NewReader("$ exit\r\n")),
+	}, nil)
+	mockClient.On("ContainerExecInspect", mock.Anything, "exec1").Return(types.ContainerExecInspect{}, nil)
+
+	var stdout bytes.Buffer
+	code, err := dockerService.Exec(context.Background(), "abc123", ExecOptions{
+		Cmd:    []string{"sh"},
+		TTY:    true,
+		Size:   size,
+		Stdout: &stdout,
+		Stderr: io.Discard,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "$ exit\r\n", stdout.String())
+}
+
+func TestDockerService_Exec_CreateError(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	dockerService := NewDockerService(mockClient)
+
+	mockClient.On("ContainerExecCreate", mock.Anything, "abc123", mock.Anything).Return(types.IDResponse{}, errors.New("container is not running"))
+
+	code, err := dockerService.Exec(context.Background(), "abc123", ExecOptions{Cmd: []string{"sh"}, Stdout: io.Discard, Stderr: io.Discard})
+	assert.EqualError(t, err, "error creating exec: container is not running")
+	assert.Equal(t, -1, code)
+}
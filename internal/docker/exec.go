@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ExecOptions describe a command run in a running container, like docker
+// exec.
+type ExecOptions struct {
+	Cmd []string
+	// TTY allocates a terminal, its output then comes as a single stream
+	// on Stdout.
+	TTY bool
+	// Size is the initial height and width of the terminal, Resize
+	// receives its later sizes.
+	Size   [2]uint
+	Resize <-chan [2]uint
+	// Stdin is passed to the command when set.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Exec runs opts.Cmd in a running container and returns its exit code.
+func (ds *DockerService) Exec(ctx context.Context, containerID string, opts ExecOptions) (int, error) {
+	execConfig := types.ExecConfig{
+		Cmd:          opts.Cmd,
+		Tty:          opts.TTY,
+		AttachStdin:  opts.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	if opts.TTY && opts.Size != [2]uint{} {
+		execConfig.ConsoleSize = &opts.Size
+	}
+
+	created, err := ds.Client.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return -1, fmt.Errorf("error creating exec: %w", err)
+	}
+
+	attached, err := ds.Client.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{Tty: opts.TTY, ConsoleSize: execConfig.ConsoleSize})
+	if err != nil {
+		return -1, fmt.Errorf("error attaching to exec: %w", err)
+	}
+	defer attached.Close()
+
+	if opts.Stdin != nil {
+		go func() {
+			_, _ = io.Copy(attached.Conn, opts.Stdin)
+			// Let the command see the end of its input.
+			_ = attached.CloseWrite()
+		}()
+	}
+
+	if opts.Resize != nil {
+		go func() {
+			for size := range opts.Resize {
+				_ = ds.Client.ContainerExecResize(ctx, created.ID, types.ResizeOptions{Height: size[0], Width: size[1]})
+			}
+		}()
+	}
+
+	if opts.TTY {
+		_, err = io.Copy(opts.Stdout, attached.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(opts.Stdout, opts.Stderr, attached.Reader)
+	}
+	if err != nil && ctx.Err() == nil {
+		return -1, fmt.Errorf("error reading exec output: %w", err)
+	}
+
+	inspected, err := ds.Client.ContainerExecInspect(context.WithoutCancel(ctx), created.ID)
+	if err != nil {
+		return -1, fmt.Errorf("error inspecting exec: %w", err)
+	}
+
+	return inspected.ExitCode, nil
+}
@@ -0,0 +1,128 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ServiceWeb is the service of the app container that takes traffic.
+const ServiceWeb = "web"
+
+// Process is a web or worker container of an app.
+type Process struct {
+	ID   string
+	Name string
+	// Service is ServiceWeb or the name of the worker.
+	Service  string
+	DeployID string
+	Running  bool
+}
+
+// Processes returns the running web and worker containers of app, web
+// first. With a deployID it returns the containers of that deploy instead,
+// running or not.
+func (ds *DockerService) Processes(ctx context.Context, app, deployID string) ([]Process, error) {
+	args := filters.NewArgs(filters.Arg("label", LabelApp+"="+app))
+	if deployID != "" {
+		args.Add("label", LabelDeployID+"="+deployID)
+	}
+
+	containers, err := ds.Client.ContainerList(ctx, types.ContainerListOptions{All: deployID != "", Filters: args})
+	if err != nil {
+		return nil, err
+	}
+
+	processes := make([]Process, 0, len(containers))
+	for _, c := range containers {
+		service := ServiceWeb
+		switch c.Labels[LabelRole] {
+		case RoleAccessory, RoleOneOff:
+			continue
+		case RoleWorker:
+			service = c.Labels[LabelService]
+		}
+
+		p := Process{
+			ID:       c.ID,
+			Name:     c.ID,
+			Service:  service,
+			DeployID: c.Labels[LabelDeployID],
+			Running:  c.State == "running",
+		}
+		if len(c.Names) > 0 {
+			p.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		processes = append(processes, p)
+	}
+
+	sort.SliceStable(processes, func(i, j int) bool {
+		a, b := processes[i], processes[j]
+		if (a.Service == ServiceWeb) != (b.Service == ServiceWeb) {
+			return a.Service == ServiceWeb
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.Name < b.Name
+	})
+
+	return processes, nil
+}
+
+// LogOptions select the logs StreamLogs writes, named after the flags of
+// docker logs.
+type LogOptions struct {
+	// Tail is the number of lines to show from the end, "all" for every line.
+	Tail string
+	// Since and Until bound the logs by a timestamp or a duration like 10m.
+	Since string
+	Until string
+	// Timestamps prefixes every line with the time it was logged.
+	Timestamps bool
+	Follow     bool
+}
+
+// StreamLogs copies the logs of a container to stdout and stderr. With
+// opts.Follow it returns once the container stops or ctx is done.
+func (ds *DockerService) StreamLogs(ctx context.Context, containerID string, opts LogOptions, stdout, stderr io.Writer) error {
+	inspected, err := ds.Client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	out, err := ds.Client.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Tail:       opts.Tail,
+		Since:      opts.Since,
+		Until:      opts.Until,
+		Timestamps: opts.Timestamps,
+	})
+	if err != nil {
+		return err
+	}
+
+	// skipcq: GO-S2307
+	defer out.Close()
+
+	// Containers with a TTY log a single raw stream, all others multiplex
+	// stdout and stderr behind a header per frame.
+	if inspected.Config != nil && inspected.Config.Tty {
+		_, err = io.Copy(stdout, out)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, out)
+	}
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("error reading logs: %w", err)
+	}
+
+	return nil
+}
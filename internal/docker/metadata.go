@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Labels set on app containers to tie them to the deploy that created them.
+const (
+	LabelApp        = "slick.app"
+	LabelDeployID   = "slick.deploy_id"
+	LabelGitSHA     = "slick.git_sha"
+	LabelDeployer   = "slick.deployer"
+	LabelConfigHash = "slick.config_hash"
+	LabelDeployedAt = "slick.deployed_at"
+)
+
+// Metadata describes the deploy that creates a container. It names the
+// container and is stored in its labels.
+type Metadata struct {
+	DeployID   string
+	GitSHA     string
+	Deployer   string
+	ConfigHash string
+	DeployedAt time.Time
+}
+
+// Labels returns the container labels for an app deployed with m, leaving
+// out the values that are not known.
+func (m Metadata) Labels(app string) map[string]string {
+	labels := map[string]string{}
+	set := func(key, value string) {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+
+	set(LabelApp, app)
+	set(LabelDeployID, m.DeployID)
+	set(LabelGitSHA, m.GitSHA)
+	set(LabelDeployer, m.Deployer)
+	set(LabelConfigHash, m.ConfigHash)
+	if !m.DeployedAt.IsZero() {
+		labels[LabelDeployedAt] = m.DeployedAt.UTC().Format(time.RFC3339)
+	}
+
+	return labels
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// sanitizeName turns an app name into something Docker accepts in
+// container names and network aliases.
+func sanitizeName(app string) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(app), "-"), "-_.")
+	if name == "" {
+		return "app"
+	}
+	return name
+}
+
+// ContainerName returns the name of the container of app created by the
+// given deploy, <app>-<short deploy id>. It is empty without a deploy id so
+// Docker picks a name.
+func ContainerName(app, deployID string) string {
+	if deployID == "" {
+		return ""
+	}
+
+	short := deployID
+	if i := strings.LastIndex(deployID, "-"); i >= 0 && i < len(deployID)-1 {
+		short = deployID[i+1:]
+	} else if len(short) > 12 {
+		short = short[:12]
+	}
+
+	return sanitizeName(app) + "-" + short
+}
+
+// newAlias returns a network alias for a new container of app that does not
+// clash with the one still serving traffic.
+func newAlias(app string) string {
+	return sanitizeName(app) + "-" + randomSuffix()
+}
+
+func randomSuffix() string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return hex.EncodeToString(suffix)
+}
+
+// resolveNameConflict frees or replaces a container name that is already in
+// use. A stopped container, left behind by an interrupted deploy, is
+// removed. A running one is left alone and a new name is returned.
+func (ds *DockerService) resolveNameConflict(ctx context.Context, name string) (string, error) {
+	existing, err := ds.Client.ContainerInspect(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("error inspecting container %s: %w", name, err)
+	}
+
+	if existing.ContainerJSONBase != nil && existing.State != nil && existing.State.Running {
+		renamed := name + "-" + randomSuffix()
+		ds.Logger.Warn("Container name is taken by a running container, using another name", "name", name, "new_name", renamed)
+		return renamed, nil
+	}
+
+	ds.Logger.Info("Removing stopped container with the same name", "name", name)
+	if err := ds.Client.ContainerRemove(ctx, existing.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+		return "", fmt.Errorf("error removing container %s: %w", name, err)
+	}
+
+	return name, nil
+}
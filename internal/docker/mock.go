@@ -9,6 +9,7 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/mock"
 )
@@ -56,6 +57,24 @@ func (m *MockDockerClient) ContainerStop(ctx context.Context, containerID string
 	return args.Error(0)
 }
 
+// ContainerRestart mocks the ContainerRestart method
+func (m *MockDockerClient) ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) error {
+	args := m.Called(ctx, containerID, options)
+	return args.Error(0)
+}
+
+// ContainerUpdate mocks the ContainerUpdate method
+func (m *MockDockerClient) ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.ContainerUpdateOKBody, error) {
+	args := m.Called(ctx, containerID, updateConfig)
+	return container.ContainerUpdateOKBody{}, args.Error(0)
+}
+
+// ContainerWait mocks the ContainerWait method
+func (m *MockDockerClient) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	args := m.Called(ctx, containerID, condition)
+	return args.Get(0).(<-chan container.WaitResponse), args.Get(1).(<-chan error)
+}
+
 // ContainerLogs mocks the ContainerLogs method
 func (m *MockDockerClient) ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
 	args := m.Called(ctx, container, options)
@@ -71,8 +90,73 @@ func (m *MockDockerClient) ContainerRemove(ctx context.Context, containerID stri
 	return args.Error(0)
 }
 
+// NetworkInspect mocks the NetworkInspect method
+func (m *MockDockerClient) NetworkInspect(ctx context.Context, networkID string, options types.NetworkInspectOptions) (types.NetworkResource, error) {
+	args := m.Called(ctx, networkID, options)
+	return args.Get(0).(types.NetworkResource), args.Error(1)
+}
+
+// NetworkCreate mocks the NetworkCreate method
+func (m *MockDockerClient) NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	args := m.Called(ctx, name, options)
+	return args.Get(0).(types.NetworkCreateResponse), args.Error(1)
+}
+
 // Close is a mock method to simulate closing the Docker client connection
 func (m *MockDockerClient) Close() error {
 	// This can be left empty or implemented if your DockerClient interface requires it
 	return nil
 }
+
+// ImageInspectWithRaw mocks the ImageInspectWithRaw method
+func (m *MockDockerClient) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	args := m.Called(ctx, imageID)
+	raw, _ := args.Get(1).([]byte)
+	return args.Get(0).(types.ImageInspect), raw, args.Error(2)
+}
+
+// DistributionInspect mocks the DistributionInspect method
+func (m *MockDockerClient) DistributionInspect(ctx context.Context, image, encodedRegistryAuth string) (registry.DistributionInspect, error) {
+	args := m.Called(ctx, image, encodedRegistryAuth)
+	return args.Get(0).(registry.DistributionInspect), args.Error(1)
+}
+
+// ImageList mocks the ImageList method
+func (m *MockDockerClient) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	args := m.Called(ctx, options)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]types.ImageSummary), args.Error(1)
+}
+
+// ImageRemove mocks the ImageRemove method
+func (m *MockDockerClient) ImageRemove(ctx context.Context, imageID string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	args := m.Called(ctx, imageID, options)
+	removed, _ := args.Get(0).([]types.ImageDeleteResponseItem)
+	return removed, args.Error(1)
+}
+
+// ContainerExecCreate mocks the ContainerExecCreate method
+func (m *MockDockerClient) ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error) {
+	args := m.Called(ctx, container, config)
+	return args.Get(0).(types.IDResponse), args.Error(1)
+}
+
+// ContainerExecAttach mocks the ContainerExecAttach method
+func (m *MockDockerClient) ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error) {
+	args := m.Called(ctx, execID, config)
+	return args.Get(0).(types.HijackedResponse), args.Error(1)
+}
+
+// ContainerExecInspect mocks the ContainerExecInspect method
+func (m *MockDockerClient) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	args := m.Called(ctx, execID)
+	return args.Get(0).(types.ContainerExecInspect), args.Error(1)
+}
+
+// ContainerExecResize mocks the ContainerExecResize method
+func (m *MockDockerClient) ContainerExecResize(ctx context.Context, execID string, options types.ResizeOptions) error {
+	args := m.Called(ctx, execID, options)
+	return args.Error(0)
+}
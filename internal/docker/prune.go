@@ -0,0 +1,194 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// PruneOptions tells Prune which images to keep.
+type PruneOptions struct {
+	// Keep are the image references that must survive, such as the images
+	// of the last deploys. Images of their repositories that are not kept
+	// and not used by any container are removed.
+	Keep []string
+	// KeepDeploys are the deploys whose stopped containers are kept, so
+	// their logs can still be read.
+	KeepDeploys []string
+	// DryRun reports what would be removed without removing anything.
+	DryRun bool
+}
+
+// PruneReport lists what Prune removed, or would remove on a dry run.
+type PruneReport struct {
+	Containers []string `json:"containers"`
+	Images     []string `json:"images"`
+	// SpaceReclaimed is the size of the removed images in bytes. Layers
+	// shared with other images may not actually be freed.
+	SpaceReclaimed int64 `json:"space_reclaimed"`
+}
+
+// Prune removes the exited containers of app and the images of its
+// repositories that opts does not keep. Accessories are left alone, a
+// stopped database is not garbage, and so are the containers of the kept
+// deploys. Images that fail to be removed are logged and skipped.
+func (ds *DockerService) Prune(ctx context.Context, app string, opts PruneOptions) (PruneReport, error) {
+	report := PruneReport{Containers: []string{}, Images: []string{}}
+
+	containers, err := ds.Client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return report, err
+	}
+
+	keepDeploys := map[string]bool{}
+	for _, id := range opts.KeepDeploys {
+		keepDeploys[id] = true
+	}
+
+	inUse := map[string]bool{}
+	for _, c := range containers {
+		exited := c.State == "exited" || c.State == "dead"
+		if !exited || c.Labels[LabelApp] != app || c.Labels[LabelRole] == RoleAccessory || keepDeploys[c.Labels[LabelDeployID]] {
+			inUse[c.ImageID] = true
+			continue
+		}
+
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		if !opts.DryRun {
+			if err := ds.Client.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{}); err != nil {
+				ds.Logger.Warn("Unable to remove container", "container", name, "error", err)
+				inUse[c.ImageID] = true
+				continue
+			}
+		}
+		report.Containers = append(report.Containers, name)
+	}
+
+	keep := map[string]bool{}
+	repositories := map[string]bool{}
+	for _, ref := range opts.Keep {
+		ref = normalizeReference(ref)
+		keep[ref] = true
+		repositories[repositoryOf(ref)] = true
+	}
+
+	images, err := ds.Client.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return report, err
+	}
+
+	for _, image := range images {
+		if inUse[image.ID] || !prunable(image, keep, repositories) {
+			continue
+		}
+
+		name := imageName(image)
+		if !opts.DryRun {
+			if err := ds.removeImage(ctx, image); err != nil {
+				ds.Logger.Warn("Unable to remove image", "image", name, "error", err)
+				continue
+			}
+		}
+		report.Images = append(report.Images, name)
+		report.SpaceReclaimed += image.Size
+	}
+
+	return report, nil
+}
+
+// removeImage removes image by its tags, all of which belong to the app's
+// repositories, and by its ID when it has none. Docker deletes the image
+// with its last tag, and refuses while a container still uses it.
+func (ds *DockerService) removeImage(ctx context.Context, image types.ImageSummary) error {
+	refs := []string{}
+	for _, tag := range image.RepoTags {
+		if tag != "<none>:<none>" {
+			refs = append(refs, tag)
+		}
+	}
+	if len(refs) == 0 {
+		refs = append(refs, image.ID)
+	}
+
+	for _, ref := range refs {
+		if _, err := ds.Client.ImageRemove(ctx, ref, types.ImageRemoveOptions{PruneChildren: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prunable reports whether image belongs to one of repositories only and
+// is not one of the kept references.
+func prunable(image types.ImageSummary, keep, repositories map[string]bool) bool {
+	refs := make([]string, 0, len(image.RepoTags)+len(image.RepoDigests))
+	for _, tag := range image.RepoTags {
+		if tag != "<none>:<none>" {
+			refs = append(refs, tag)
+		}
+	}
+	for _, digest := range image.RepoDigests {
+		if digest != "<none>@<none>" {
+			refs = append(refs, digest)
+		}
+	}
+	if len(refs) == 0 {
+		return false
+	}
+
+	for _, ref := range refs {
+		ref = normalizeReference(ref)
+		if keep[ref] || !repositories[repositoryOf(ref)] {
+			return false
+		}
+	}
+	return true
+}
+
+// imageName returns the first tag of image, or its digest or ID when it has
+// none.
+func imageName(image types.ImageSummary) string {
+	for _, tag := range image.RepoTags {
+		if tag != "<none>:<none>" {
+			return tag
+		}
+	}
+	for _, digest := range image.RepoDigests {
+		if digest != "<none>@<none>" {
+			return digest
+		}
+	}
+	id := strings.TrimPrefix(image.ID, "sha256:")
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return id
+}
+
+// normalizeReference writes ref the way Docker lists it: Docker Hub
+// images by their short name and with the implicit latest tag.
+func normalizeReference(ref string) string {
+	ref = strings.TrimPrefix(ref, "docker.io/")
+	ref = strings.TrimPrefix(ref, "library/")
+	if !strings.Contains(ref, "@") && !strings.Contains(ref[strings.LastIndex(ref, "/")+1:], ":") {
+		ref += ":latest"
+	}
+	return ref
+}
+
+// repositoryOf strips the tag or digest off ref. A colon before the last
+// slash is the port of a registry, not a tag.
+func repositoryOf(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		return ref[:i]
+	}
+	slash := strings.LastIndex(ref, "/")
+	if i := strings.LastIndex(ref, ":"); i > slash {
+		return ref[:i]
+	}
+	return ref
+}
@@ -0,0 +1,112 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/go-units"
+	"github.com/scmmishra/slick-deploy/internal/config"
+)
+
+// applyRuntimeOptions maps the container runtime options of the app onto the
+// container and host config.
+func applyRuntimeOptions(appCfg config.App, containerConfig *container.Config, hostConfig *container.HostConfig) error {
+	if len(appCfg.Command) > 0 {
+		containerConfig.Cmd = strslice.StrSlice(appCfg.Command)
+	}
+	if len(appCfg.Entrypoint) > 0 {
+		containerConfig.Entrypoint = strslice.StrSlice(appCfg.Entrypoint)
+	}
+	containerConfig.WorkingDir = appCfg.WorkingDir
+	containerConfig.User = appCfg.User
+	containerConfig.StopSignal = appCfg.StopSignal
+	if appCfg.StopTimeout > 0 {
+		timeout := appCfg.StopTimeout
+		containerConfig.StopTimeout = &timeout
+	}
+
+	if len(appCfg.Labels) > 0 {
+		if containerConfig.Labels == nil {
+			containerConfig.Labels = map[string]string{}
+		}
+		for key, value := range appCfg.Labels {
+			// The labels of slick tie the container to its app and deploy.
+			if strings.HasPrefix(key, config.ReservedLabelPrefix) {
+				continue
+			}
+			containerConfig.Labels[key] = value
+		}
+	}
+
+	if appCfg.Restart != "" {
+		name, retries, err := config.ParseRestartPolicy(appCfg.Restart)
+		if err != nil {
+			return err
+		}
+		hostConfig.RestartPolicy = container.RestartPolicy{Name: name, MaximumRetryCount: retries}
+	}
+
+	if appCfg.Memory != "" {
+		memory, err := units.RAMInBytes(appCfg.Memory)
+		if err != nil {
+			return fmt.Errorf("invalid memory %q: %w", appCfg.Memory, err)
+		}
+		hostConfig.Memory = memory
+	}
+
+	if appCfg.CPUs > 0 {
+		hostConfig.NanoCPUs = int64(appCfg.CPUs * 1e9)
+	}
+
+	if appCfg.ShmSize != "" {
+		shmSize, err := units.RAMInBytes(appCfg.ShmSize)
+		if err != nil {
+			return fmt.Errorf("invalid shm_size %q: %w", appCfg.ShmSize, err)
+		}
+		hostConfig.ShmSize = shmSize
+	}
+
+	for _, value := range appCfg.Ulimits {
+		ulimit, err := units.ParseUlimit(value)
+		if err != nil {
+			return fmt.Errorf("invalid ulimit %q: %w", value, err)
+		}
+		hostConfig.Ulimits = append(hostConfig.Ulimits, ulimit)
+	}
+
+	for _, value := range appCfg.Devices {
+		device, err := config.ParseDevice(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.Devices = append(hostConfig.Devices, container.DeviceMapping{
+			PathOnHost:        device.PathOnHost,
+			PathInContainer:   device.PathInContainer,
+			CgroupPermissions: device.CgroupPermissions,
+		})
+	}
+
+	if len(appCfg.Tmpfs) > 0 {
+		hostConfig.Tmpfs = map[string]string{}
+		for _, value := range appCfg.Tmpfs {
+			path, options := config.ParseTmpfs(value)
+			hostConfig.Tmpfs[path] = options
+		}
+	}
+
+	hostConfig.ExtraHosts = appCfg.ExtraHosts
+	hostConfig.CapAdd = strslice.StrSlice(appCfg.CapAdd)
+	hostConfig.CapDrop = strslice.StrSlice(appCfg.CapDrop)
+	hostConfig.ReadonlyRootfs = appCfg.ReadOnly
+
+	if appCfg.Logging.Driver != "" {
+		hostConfig.LogConfig = container.LogConfig{
+			Type:   appCfg.Logging.Driver,
+			Config: appCfg.Logging.Options,
+		}
+	}
+
+	return nil
+}
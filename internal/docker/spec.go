@@ -0,0 +1,108 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+)
+
+// Spec is what a deploy sets on an app container. slick diff compares the
+// spec of the running container with the one a deploy would create.
+type Spec struct {
+	Image  string
+	Digest string
+	// Env holds the variables slick passes, the ones baked into the image
+	// are left out.
+	Env     map[string]string
+	Volumes []string
+	// Network is empty for Docker's default network.
+	Network string
+}
+
+// RunningSpec returns the spec of the container with the given ID.
+func (ds *DockerService) RunningSpec(ctx context.Context, containerID string) (Spec, error) {
+	inspected, err := ds.Client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return Spec{}, err
+	}
+
+	spec := Spec{Env: map[string]string{}}
+	imageEnv := map[string]string{}
+	if inspected.ContainerJSONBase != nil {
+		image, _, err := ds.Client.ImageInspectWithRaw(ctx, inspected.Image)
+		if err == nil {
+			if image.Config != nil {
+				imageEnv = parseEnv(image.Config.Env)
+			}
+			if inspected.Config != nil {
+				spec.Digest = repoDigest(image, inspected.Config.Image)
+			}
+		}
+		if inspected.HostConfig != nil {
+			spec.Volumes = inspected.HostConfig.Binds
+			spec.Network = networkName(string(inspected.HostConfig.NetworkMode))
+		}
+	}
+
+	if inspected.Config != nil {
+		spec.Image = inspected.Config.Image
+		for key, value := range parseEnv(inspected.Config.Env) {
+			if imageValue, ok := imageEnv[key]; !ok || imageValue != value {
+				spec.Env[key] = value
+			}
+		}
+	}
+
+	return spec, nil
+}
+
+// DesiredSpec returns the spec of the container a deploy of appCfg would
+// create. The digest is looked up in the registry without pulling the
+// image, or taken from the local image when the registry cannot tell.
+func (ds *DockerService) DesiredSpec(ctx context.Context, appCfg config.App) (Spec, error) {
+	spec := Spec{
+		Image:   appCfg.ImageName,
+		Env:     parseEnv(buildEnv(appCfg)),
+		Volumes: appCfg.Volumes,
+		Network: networkName(appCfg.Network),
+	}
+
+	auth, err := encodeAuth(appCfg.Registry)
+	if err != nil {
+		return spec, err
+	}
+
+	distribution, err := ds.Client.DistributionInspect(ctx, appCfg.ImageName, auth)
+	if err == nil {
+		spec.Digest = distribution.Descriptor.Digest.String()
+		return spec, nil
+	}
+	ds.Logger.Debug("Unable to look up the image digest in the registry", "image", appCfg.ImageName, "error", err)
+
+	if image, _, err := ds.Client.ImageInspectWithRaw(ctx, appCfg.ImageName); err == nil {
+		spec.Digest = repoDigest(image, appCfg.ImageName)
+	}
+
+	return spec, nil
+}
+
+// parseEnv turns KEY=value pairs into a map.
+func parseEnv(env []string) map[string]string {
+	values := make(map[string]string, len(env))
+	for _, pair := range env {
+		key, value, _ := strings.Cut(pair, "=")
+		values[key] = value
+	}
+	return values
+}
+
+// networkName returns the network of a network mode, empty for Docker's
+// default network.
+func networkName(mode string) string {
+	switch mode {
+	case "", "default", "bridge":
+		return ""
+	}
+	return mode
+}
@@ -1,19 +1,43 @@
 package health
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/jonboulle/clockwork"
 	"github.com/scmmishra/slick-deploy/internal/config"
 )
 
-func CheckHealth(host string, cfg *config.HealthCheck) error {
-	return CheckHealthWithClock(host, cfg, clockwork.NewRealClock())
+func CheckHealth(ctx context.Context, host string, cfg *config.HealthCheck) error {
+	return CheckHealthWithClock(ctx, host, cfg, clockwork.NewRealClock())
 }
 
-func CheckHealthWithClock(host string, cfg *config.HealthCheck, clock clockwork.Clock) error {
+// CheckHealthWithClock polls the health endpoint until it responds with a
+// 2xx status, the retries run out or ctx is cancelled.
+func CheckHealthWithClock(ctx context.Context, host string, cfg *config.HealthCheck, clock clockwork.Clock) error {
+	return CheckHealthWithOptions(ctx, host, cfg, Options{Clock: clock})
+}
+
+// Options tune how the health endpoint is polled.
+type Options struct {
+	// Clock paces the retries, the real clock when nil.
+	Clock clockwork.Clock
+	// Transport sends the requests, for example through an SSH tunnel to
+	// the machine running the container. The default transport when nil.
+	Transport http.RoundTripper
+}
+
+// CheckHealthWithOptions is CheckHealth with the clock and transport of opts.
+func CheckHealthWithOptions(ctx context.Context, host string, cfg *config.HealthCheck, opts Options) error {
+	clock := opts.Clock
+	if clock == nil {
+		clock = clockwork.NewRealClock()
+	}
+
 	if cfg.Endpoint == "" || host == "" {
 		return nil
 	}
@@ -27,16 +51,25 @@ func CheckHealthWithClock(host string, cfg *config.HealthCheck, clock clockwork.
 	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
 
 	client := &http.Client{
-		Timeout: timeout,
+		Timeout:   timeout,
+		Transport: opts.Transport,
 	}
 
 	maxRetries := cfg.MaxRetries
 	delay := time.Duration(cfg.IntervalSeconds) * time.Second
 
 	for i := 0; i < maxRetries; i++ {
-		resp, err := client.Get(endpoint)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 		if err != nil {
-			clock.Sleep(delay)
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			slog.Debug("Health check failed, retrying", "endpoint", endpoint, "error", err, "attempt", i+1)
+			if err := sleep(ctx, clock, delay); err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -46,9 +79,63 @@ func CheckHealthWithClock(host string, cfg *config.HealthCheck, clock clockwork.
 			return nil
 		}
 
-		fmt.Println("  Retrying...")
-		clock.Sleep(delay)
+		slog.Info("Health check failed, retrying", "endpoint", endpoint, "status", resp.StatusCode, "attempt", i+1)
+		if err := sleep(ctx, clock, delay); err != nil {
+			return err
+		}
 	}
 
 	return fmt.Errorf("unable to reach endpoint %s after %d attempts", endpoint, maxRetries)
 }
+
+// Probe requests the health endpoint once and reports why it is unhealthy,
+// nil when it responds with a 2xx status.
+func Probe(ctx context.Context, host string, cfg config.HealthCheck, transport http.RoundTripper) error {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+
+	endpoint := host + "/" + strings.TrimPrefix(cfg.Endpoint, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded with %s", endpoint, resp.Status)
+	}
+
+	return nil
+}
+
+// sleep waits for d on clock, returning early with the context error when
+// ctx is cancelled.
+func sleep(ctx context.Context, clock clockwork.Clock, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(d)
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
@@ -1,6 +1,7 @@
 package health
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -30,7 +31,7 @@ func setupTestServer(handler http.HandlerFunc) (string, func()) {
 func TestCheckHealth_EmptyHost(t *testing.T) {
 	t.Parallel()
 
-	err := CheckHealth("", &config.HealthCheck{
+	err := CheckHealth(context.Background(), "", &config.HealthCheck{
 		Endpoint:       "/health",
 		TimeoutSeconds: 5,
 	})
@@ -41,7 +42,7 @@ func TestCheckHealth_EmptyHost(t *testing.T) {
 func TestCheckHealth_EmptyEndpoint(t *testing.T) {
 	t.Parallel()
 
-	err := CheckHealth("https://shivam.dev", &config.HealthCheck{
+	err := CheckHealth(context.Background(), "https://shivam.dev", &config.HealthCheck{
 		Endpoint:       "",
 		TimeoutSeconds: 5,
 	})
@@ -58,7 +59,7 @@ func TestCheckHealth_Success(t *testing.T) {
 	})
 	defer teardown()
 
-	err := CheckHealth(serverURL, &config.HealthCheck{
+	err := CheckHealth(context.Background(), serverURL, &config.HealthCheck{
 		Endpoint:        "/",
 		TimeoutSeconds:  5,
 		IntervalSeconds: 2,
@@ -77,7 +78,7 @@ func TestCheckHealth_ServerError(t *testing.T) {
 	})
 	defer teardown()
 
-	err := CheckHealth(serverURL, &config.HealthCheck{
+	err := CheckHealth(context.Background(), serverURL, &config.HealthCheck{
 		Endpoint:       "/health",
 		TimeoutSeconds: 5,
 	})
@@ -95,7 +96,7 @@ func TestCheckHealth_NetworkError(t *testing.T) {
 	// Close the server immediately to simulate a network error
 	teardown()
 
-	err := CheckHealth(serverURL, &config.HealthCheck{
+	err := CheckHealth(context.Background(), serverURL, &config.HealthCheck{
 		Endpoint:       "/health",
 		TimeoutSeconds: 5,
 	})
@@ -120,7 +121,7 @@ func TestCheckHealth_SleepWithError(t *testing.T) {
 		}
 	}()
 
-	err := CheckHealthWithClock(serverURL, &config.HealthCheck{
+	err := CheckHealthWithClock(context.Background(), serverURL, &config.HealthCheck{
 		Endpoint:        "/health",
 		TimeoutSeconds:  5,
 		IntervalSeconds: 2,
@@ -145,7 +146,7 @@ func TestCheckHealthWithClock_StalledServer(t *testing.T) {
 
 	// Run CheckHealthWithClock in a separate goroutine, as it will block due to the server delay
 	go func() {
-		err := CheckHealthWithClock(server.URL, &config.HealthCheck{
+		err := CheckHealthWithClock(context.Background(), server.URL, &config.HealthCheck{
 			Endpoint:        "/health",
 			TimeoutSeconds:  2, // This is less than the server delay
 			IntervalSeconds: 2,
@@ -162,3 +163,77 @@ func TestCheckHealthWithClock_StalledServer(t *testing.T) {
 		time.Sleep(1 * time.Second) // This is needed to allow the CheckHealthWithClock goroutine to progress
 	}
 }
+
+func TestCheckHealth_Cancelled(t *testing.T) {
+	t.Parallel()
+
+	serverURL, teardown := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	err := CheckHealth(ctx, serverURL, &config.HealthCheck{
+		Endpoint:        "/health",
+		TimeoutSeconds:  5,
+		IntervalSeconds: 30,
+		MaxRetries:      3,
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second, "Expected the check to stop when cancelled")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestCheckHealthWithOptions_Transport(t *testing.T) {
+	t.Parallel()
+
+	url, teardown := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	defer teardown()
+
+	var requested string
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		requested = r.URL.String()
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	err := CheckHealthWithOptions(context.Background(), url, &config.HealthCheck{
+		Endpoint:       "/health",
+		TimeoutSeconds: 5,
+		MaxRetries:     1,
+	}, Options{Transport: transport})
+
+	assert.NoError(t, err)
+	assert.Equal(t, url+"/health", requested)
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	url, teardown := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer teardown()
+
+	assert.NoError(t, Probe(context.Background(), url, config.HealthCheck{Endpoint: "/health"}, nil))
+
+	err := Probe(context.Background(), url, config.HealthCheck{Endpoint: "ready"}, nil)
+	assert.EqualError(t, err, url+"/ready responded with 503 Service Unavailable")
+}
@@ -0,0 +1,182 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type Options struct {
+	Format  string
+	Quiet   bool
+	Verbose bool
+}
+
+// progress is where carriage-return progress bars are drawn, nil when they
+// should not be drawn at all.
+var (
+	progressMu sync.Mutex
+	progress   io.Writer
+)
+
+// Setup installs the default slog logger for the given options and decides
+// whether interactive progress output is allowed.
+func Setup(opts Options, out *os.File) (*slog.Logger, error) {
+	level := slog.LevelInfo
+	switch {
+	case opts.Quiet:
+		level = slog.LevelWarn
+	case opts.Verbose:
+		level = slog.LevelDebug
+	}
+
+	var handler slog.Handler
+	switch opts.Format {
+	case "", FormatText:
+		handler = NewConsoleHandler(out, level)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level})
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", opts.Format)
+	}
+
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+
+	if opts.Format != FormatJSON && !opts.Quiet && IsTerminal(out) {
+		SetProgress(out)
+	} else {
+		SetProgress(nil)
+	}
+
+	return logger, nil
+}
+
+// IsTerminal reports whether f is attached to a terminal.
+func IsTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// SetProgress sets the writer used for progress output, nil disables it.
+func SetProgress(w io.Writer) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progress = w
+}
+
+// Progress returns the writer for progress output, or nil when progress
+// should only be logged.
+func Progress() io.Writer {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	return progress
+}
+
+// ConsoleHandler writes records as plain lines meant for humans. Attributes
+// are only shown for warnings, errors and in verbose mode.
+type ConsoleHandler struct {
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+	mu    *sync.Mutex
+}
+
+func NewConsoleHandler(w io.Writer, level slog.Leveler) *ConsoleHandler {
+	return &ConsoleHandler{w: w, level: level, mu: &sync.Mutex{}}
+}
+
+func (h *ConsoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *ConsoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+	}
+	b.WriteString(r.Message)
+
+	if r.Level >= slog.LevelWarn || h.level.Level() <= slog.LevelDebug {
+		write := func(a slog.Attr) bool {
+			if !a.Equal(slog.Attr{}) {
+				fmt.Fprintf(&b, " %s=%v", a.Key, a.Value.Resolve())
+			}
+			return true
+		}
+		for _, a := range h.attrs {
+			write(a)
+		}
+		r.Attrs(write)
+	}
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *ConsoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &next
+}
+
+// WithGroup is not meaningful for console output, groups are flattened.
+func (h *ConsoleHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
+
+// LineWriter is an io.Writer that logs every line written to it, used to
+// pass the output of hooks and one-off containers through the logger.
+type LineWriter struct {
+	Logger *slog.Logger
+	Level  slog.Level
+	buf    []byte
+}
+
+func NewLineWriter(logger *slog.Logger, level slog.Level) *LineWriter {
+	return &LineWriter{Logger: logger, Level: level}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.Logger.Log(context.Background(), w.Level, string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs any trailing output that did not end with a newline.
+func (w *LineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.Logger.Log(context.Background(), w.Level, string(w.buf))
+		w.buf = nil
+	}
+}
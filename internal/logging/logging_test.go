@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewConsoleHandler(&buf, slog.LevelInfo))
+
+	logger.Debug("hidden")
+	logger.Info("Spinning up new container", "port", 8001)
+	logger.Warn("Unable to record deployment", "error", "disk full")
+
+	assert.Equal(t, "Spinning up new container\nWarning: Unable to record deployment error=disk full\n", buf.String())
+}
+
+func TestConsoleHandler_Verbose(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewConsoleHandler(&buf, slog.LevelDebug)).With("app", "memos")
+
+	logger.Debug("Pulling layer", "id", "abc")
+
+	assert.Equal(t, "Pulling layer app=memos id=abc\n", buf.String())
+}
+
+func TestSetup_JSON(t *testing.T) {
+	original := slog.Default()
+	defer slog.SetDefault(original)
+
+	f, err := os.CreateTemp(t.TempDir(), "log")
+	require.NoError(t, err)
+	defer f.Close()
+
+	logger, err := Setup(Options{Format: FormatJSON}, f)
+	require.NoError(t, err)
+	logger.Info("Deployed successfully", "app", "memos")
+
+	data, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(data, &line))
+	assert.Equal(t, "Deployed successfully", line["msg"])
+	assert.Equal(t, "memos", line["app"])
+	assert.Nil(t, Progress())
+}
+
+func TestSetup_Quiet(t *testing.T) {
+	original := slog.Default()
+	defer slog.SetDefault(original)
+
+	f, err := os.CreateTemp(t.TempDir(), "log")
+	require.NoError(t, err)
+	defer f.Close()
+
+	logger, err := Setup(Options{Quiet: true}, f)
+	require.NoError(t, err)
+	logger.Info("not shown")
+	logger.Warn("shown")
+
+	data, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "Warning: shown\n", string(data))
+}
+
+func TestSetup_InvalidFormat(t *testing.T) {
+	_, err := Setup(Options{Format: "xml"}, os.Stdout)
+	assert.Error(t, err)
+}
+
+func TestIsTerminal_File(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "log")
+	require.NoError(t, err)
+	defer f.Close()
+
+	assert.False(t, IsTerminal(f))
+	assert.False(t, IsTerminal(nil))
+}
+
+func TestLineWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLineWriter(slog.New(NewConsoleHandler(&buf, slog.LevelInfo)), slog.LevelInfo)
+
+	_, _ = w.Write([]byte("first\nsec"))
+	_, _ = w.Write([]byte("ond\nthird"))
+	assert.Equal(t, "first\nsecond\n", buf.String())
+
+	w.Flush()
+	assert.Equal(t, "first\nsecond\nthird\n", buf.String())
+}
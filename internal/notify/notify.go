@@ -0,0 +1,279 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/deploy"
+	"github.com/scmmishra/slick-deploy/internal/logging"
+)
+
+const (
+	SignatureHeader = "X-Slick-Signature"
+	EventHeader     = "X-Slick-Event"
+
+	deliveryTimeout = 10 * time.Second
+
+	// queueSize bounds the events waiting for a slow sink, more are dropped.
+	queueSize = 64
+	// closeTimeout bounds how long Close waits for the queued events.
+	closeTimeout = 30 * time.Second
+)
+
+// Sink delivers a deployment event to a single destination.
+type Sink interface {
+	Send(e deploy.Event) error
+}
+
+// Notifier fans deployment events out to the configured sinks. Every sink
+// gets its own queue and goroutine, so a slow or unreachable one never holds
+// up the deploy or the other sinks. Close waits for the queued events.
+type Notifier struct {
+	Sinks   []Sink
+	Events  map[deploy.EventType]bool
+	OnError func(error)
+
+	start   sync.Once
+	queues  []chan deploy.Event
+	wg      sync.WaitGroup
+	errorMu sync.Mutex
+}
+
+// NewNotifier builds a notifier from the notifications section of slick.yml.
+func NewNotifier(cfg config.NotificationsConfig) *Notifier {
+	n := &Notifier{
+		OnError: func(err error) {
+			slog.Warn("Unable to deliver notification", "error", err)
+		},
+	}
+
+	if len(cfg.Events) > 0 {
+		n.Events = map[deploy.EventType]bool{}
+		for _, e := range cfg.Events {
+			n.Events[deploy.EventType(e)] = true
+		}
+	}
+
+	client := &http.Client{Timeout: deliveryTimeout}
+	for _, webhook := range cfg.Webhooks {
+		n.Sinks = append(n.Sinks, &WebhookSink{URL: webhook.URL, Secret: webhook.Secret, HTTPClient: client})
+	}
+	for _, slack := range cfg.Slack {
+		n.Sinks = append(n.Sinks, &SlackSink{WebhookURL: slack.WebhookURL, HTTPClient: client})
+	}
+	for _, command := range cfg.Commands {
+		n.Sinks = append(n.Sinks, &CommandSink{Command: command})
+	}
+
+	return n
+}
+
+// Handle is a deploy.EventHandler that queues the event for every sink.
+// Progress steps are never delivered, other events only when they pass the
+// configured filter. Handle must not be called after Close.
+func (n *Notifier) Handle(e deploy.Event) {
+	if e.Type == deploy.EventStep {
+		return
+	}
+	if n.Events != nil && !n.Events[e.Type] {
+		return
+	}
+
+	n.start.Do(n.startSinks)
+	for i, queue := range n.queues {
+		select {
+		case queue <- e:
+		default:
+			n.report(fmt.Errorf("dropped %s notification, %T is too slow", e.Type, n.Sinks[i]))
+		}
+	}
+}
+
+func (n *Notifier) startSinks() {
+	for _, sink := range n.Sinks {
+		queue := make(chan deploy.Event, queueSize)
+		n.queues = append(n.queues, queue)
+
+		n.wg.Add(1)
+		go func(sink Sink) {
+			defer n.wg.Done()
+			for e := range queue {
+				if err := sink.Send(e); err != nil {
+					n.report(err)
+				}
+			}
+		}(sink)
+	}
+}
+
+// Close waits until the queued events are delivered, at most closeTimeout.
+func (n *Notifier) Close() {
+	n.start.Do(func() {})
+	for _, queue := range n.queues {
+		close(queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+		n.report(fmt.Errorf("gave up delivering notifications after %s", closeTimeout))
+	}
+}
+
+func (n *Notifier) report(err error) {
+	if n.OnError == nil {
+		return
+	}
+	n.errorMu.Lock()
+	defer n.errorMu.Unlock()
+	n.OnError(err)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body using secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSink posts the event as JSON to a URL. When a secret is set the
+// body is signed and the signature sent in the X-Slick-Signature header.
+type WebhookSink struct {
+	URL        string
+	Secret     string
+	HTTPClient *http.Client
+}
+
+func (s *WebhookSink) Send(e deploy.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(e.Type))
+	if s.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(s.Secret, body))
+	}
+
+	return post(s.HTTPClient, req)
+}
+
+// SlackSink posts a one line summary of the event to a Slack compatible
+// incoming webhook.
+type SlackSink struct {
+	WebhookURL string
+	HTTPClient *http.Client
+}
+
+func (s *SlackSink) Send(e deploy.Event) error {
+	body, err := json.Marshal(map[string]string{"text": FormatText(e)})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return post(s.HTTPClient, req)
+}
+
+// FormatText renders the event as a short human readable line.
+func FormatText(e deploy.Event) string {
+	text := fmt.Sprintf("[%s] %s", e.App, e.Type)
+	if e.Image != "" {
+		text += fmt.Sprintf(" (%s)", e.Image)
+	}
+	if e.Message != "" {
+		text += ": " + e.Message
+	}
+	if e.Error != "" {
+		text += ": " + e.Error
+	}
+	return text
+}
+
+// CommandSink runs a shell command for every event. The event is passed as
+// JSON on stdin and its fields as SLICK_* environment variables. Its output
+// goes through the default logger.
+type CommandSink struct {
+	Command string
+}
+
+func (s *CommandSink) Send(e deploy.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", s.Command)
+	}
+	// Don't wait forever on children that keep the output open after a kill.
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(body)
+	out := logging.NewLineWriter(slog.Default().With("command", s.Command), slog.LevelInfo)
+	defer out.Flush()
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = append(os.Environ(),
+		"SLICK_EVENT="+string(e.Type),
+		"SLICK_APP="+e.App,
+		"SLICK_IMAGE="+e.Image,
+		"SLICK_DEPLOY_ID="+e.DeployID,
+		"SLICK_MESSAGE="+e.Message,
+		"SLICK_ERROR="+e.Error,
+	)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command hook %q failed: %w", s.Command, err)
+	}
+
+	return nil
+}
+
+func post(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("received non-OK response from %s: %s", req.URL.Host, resp.Status)
+	}
+
+	return nil
+}
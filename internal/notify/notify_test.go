@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	events []deploy.Event
+	err    error
+}
+
+func (s *recordingSink) Send(e deploy.Event) error {
+	s.events = append(s.events, e)
+	return s.err
+}
+
+func TestWebhookSink_SignsBody(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{URL: server.URL, Secret: "s3cret", HTTPClient: &http.Client{}}
+	err := sink.Send(deploy.Event{Type: deploy.EventDeployFinished, App: "memos"})
+	require.NoError(t, err)
+
+	var received deploy.Event
+	require.NoError(t, json.Unmarshal(body, &received))
+	assert.Equal(t, deploy.EventDeployFinished, received.Type)
+	assert.Equal(t, "deploy_finished", header.Get(EventHeader))
+	assert.Equal(t, "sha256="+Sign("s3cret", body), header.Get(SignatureHeader))
+}
+
+func TestWebhookSink_NoSecret(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{URL: server.URL, HTTPClient: &http.Client{}}
+	require.NoError(t, sink.Send(deploy.Event{Type: deploy.EventDeployStarted}))
+	assert.Empty(t, header.Get(SignatureHeader))
+}
+
+func TestWebhookSink_ErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	sink := &WebhookSink{URL: server.URL, HTTPClient: &http.Client{}}
+	err := sink.Send(deploy.Event{Type: deploy.EventDeployStarted})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "502")
+}
+
+func TestSlackSink(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := &SlackSink{WebhookURL: server.URL, HTTPClient: &http.Client{}}
+	err := sink.Send(deploy.Event{Type: deploy.EventRolledBack, App: "memos", Image: "memos:2", Error: "unhealthy"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "[memos] rolled_back (memos:2): unhealthy", payload["text"])
+}
+
+func TestCommandSink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("command hooks are exercised with sh")
+	}
+
+	out := filepath.Join(t.TempDir(), "event")
+	sink := &CommandSink{Command: `printf "%s " "$SLICK_EVENT" > ` + out + ` && cat >> ` + out}
+	err := sink.Send(deploy.Event{Type: deploy.EventDeployFinished, App: "memos"})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "deploy_finished {")
+	assert.Contains(t, string(data), `"app":"memos"`)
+}
+
+func TestCommandSink_LogsOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("command hooks are exercised with sh")
+	}
+
+	var logs bytes.Buffer
+	original := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(original)
+
+	sink := &CommandSink{Command: `echo "got $SLICK_EVENT"`}
+	err := sink.Send(deploy.Event{Type: deploy.EventDeployFinished, App: "memos"})
+	require.NoError(t, err)
+
+	assert.Contains(t, logs.String(), `msg="got deploy_finished"`)
+	assert.Contains(t, logs.String(), `command="echo \"got $SLICK_EVENT\""`)
+}
+
+func TestNotificationEvents(t *testing.T) {
+	delivered := []deploy.EventType{
+		deploy.EventDeployStarted,
+		deploy.EventImagePulled,
+		deploy.EventHealthPassed,
+		deploy.EventHealthFailed,
+		deploy.EventTrafficSwitched,
+		deploy.EventRolledBack,
+		deploy.EventHookFailed,
+		deploy.EventDeployFinished,
+		deploy.EventDeployFailed,
+	}
+
+	var names []string
+	for _, e := range delivered {
+		names = append(names, string(e))
+	}
+	assert.ElementsMatch(t, names, config.NotificationEvents)
+}
+
+func TestCommandSink_Failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("command hooks are exercised with sh")
+	}
+
+	sink := &CommandSink{Command: "exit 3"}
+	err := sink.Send(deploy.Event{Type: deploy.EventDeployFinished})
+	assert.Error(t, err)
+}
+
+func TestNotifier_Filters(t *testing.T) {
+	sink := &recordingSink{}
+	n := NewNotifier(config.NotificationsConfig{Events: []string{"deploy_finished"}})
+	n.Sinks = []Sink{sink}
+
+	n.Handle(deploy.Event{Type: deploy.EventDeployStarted})
+	n.Handle(deploy.Event{Type: deploy.EventDeployFinished})
+	n.Close()
+
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, deploy.EventDeployFinished, sink.events[0].Type)
+}
+
+func TestNotifier_SkipsStepsAndReportsErrors(t *testing.T) {
+	sink := &recordingSink{err: errors.New("boom")}
+	var reported []error
+	n := &Notifier{Sinks: []Sink{sink}, OnError: func(err error) { reported = append(reported, err) }}
+
+	n.Handle(deploy.Event{Type: deploy.EventStep, Message: "Spinning up new container"})
+	n.Handle(deploy.Event{Type: deploy.EventHealthFailed})
+	n.Close()
+
+	assert.Len(t, sink.events, 1)
+	assert.Len(t, reported, 1)
+}
+
+// blockingSink holds every event until release is closed.
+type blockingSink struct {
+	release chan struct{}
+	sent    []deploy.EventType
+}
+
+func (s *blockingSink) Send(e deploy.Event) error {
+	<-s.release
+	s.sent = append(s.sent, e.Type)
+	return nil
+}
+
+func TestNotifier_SlowSinkDoesNotBlock(t *testing.T) {
+	slow := &blockingSink{release: make(chan struct{})}
+	fast := &recordingSink{}
+	n := &Notifier{Sinks: []Sink{slow, fast}}
+
+	handled := make(chan struct{})
+	go func() {
+		n.Handle(deploy.Event{Type: deploy.EventDeployStarted})
+		n.Handle(deploy.Event{Type: deploy.EventDeployFinished})
+		close(handled)
+	}()
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("Handle waited for a slow sink")
+	}
+
+	close(slow.release)
+	n.Close()
+
+	expected := []deploy.EventType{deploy.EventDeployStarted, deploy.EventDeployFinished}
+	assert.Equal(t, expected, slow.sent)
+	assert.Len(t, fast.events, 2)
+}
+
+func TestNotifier_DropsWhenQueueIsFull(t *testing.T) {
+	slow := &blockingSink{release: make(chan struct{})}
+	var reported []error
+	n := &Notifier{Sinks: []Sink{slow}, OnError: func(err error) { reported = append(reported, err) }}
+
+	// One event is being sent, queueSize wait, the rest is dropped.
+	for i := 0; i < queueSize+3; i++ {
+		n.Handle(deploy.Event{Type: deploy.EventDeployFinished})
+	}
+	close(slow.release)
+	n.Close()
+
+	assert.GreaterOrEqual(t, len(slow.sent), queueSize)
+	assert.Len(t, reported, queueSize+3-len(slow.sent))
+}
+
+func TestNewNotifier(t *testing.T) {
+	n := NewNotifier(config.NotificationsConfig{
+		Webhooks: []config.WebhookConfig{{URL: "https://example.com"}},
+		Slack:    []config.SlackConfig{{WebhookURL: "https://hooks.slack.com"}},
+		Commands: []string{"true"},
+	})
+
+	require.Len(t, n.Sinks, 3)
+	assert.IsType(t, &WebhookSink{}, n.Sinks[0])
+	assert.IsType(t, &SlackSink{}, n.Sinks[1])
+	assert.IsType(t, &CommandSink{}, n.Sinks[2])
+	assert.Nil(t, n.Events)
+}
@@ -0,0 +1,190 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxStderr bounds how much ssh error output is kept for error messages.
+const maxStderr = 4096
+
+// commandConn is a net.Conn over the stdin and stdout of a command.
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stdout *os.File
+	addr   string
+
+	mu     sync.Mutex
+	stderr bytes.Buffer
+
+	timerMu    sync.Mutex
+	readTimer  *time.Timer
+	writeTimer *time.Timer
+
+	exited    chan struct{}
+	closeOnce sync.Once
+}
+
+func newCommandConn(cmd *exec.Cmd, addr string) (*commandConn, error) {
+	// Plain pipes instead of cmd.StdoutPipe, Wait must not close the output
+	// while it is still being read.
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, err
+	}
+
+	c := &commandConn{cmd: cmd, stdin: stdinW, stdout: stdoutR, addr: addr, exited: make(chan struct{})}
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	cmd.Stderr = (*stderrWriter)(c)
+
+	err = cmd.Start()
+	// The command holds its own copies of these ends now.
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		return nil, err
+	}
+
+	go func() {
+		_ = cmd.Wait()
+		close(c.exited)
+	}()
+
+	return c, nil
+}
+
+type stderrWriter commandConn
+
+func (w *stderrWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if room := maxStderr - w.stderr.Len(); room > 0 {
+		if len(p) > room {
+			w.stderr.Write(p[:room])
+		} else {
+			w.stderr.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// sshError returns what ssh printed on stderr, if anything.
+func (c *commandConn) sshError() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.TrimSpace(c.stderr.String())
+}
+
+// Read reads from the command. An early end of output that comes with an
+// ssh error, such as a failed login, is returned as that error.
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if errors.Is(err, io.EOF) {
+		// Give ssh a moment to write its error before it exits.
+		c.wait()
+		if msg := c.sshError(); msg != "" {
+			return n, fmt.Errorf("ssh: %s", msg)
+		}
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	n, err := c.stdin.Write(p)
+	if err != nil {
+		if msg := c.sshError(); msg != "" {
+			return n, fmt.Errorf("ssh: %s", msg)
+		}
+	}
+	return n, err
+}
+
+// CloseWrite closes the input of the command, the remote end sees EOF.
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+// Close stops the command.
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.stdin.Close()
+		if c.cmd.Process != nil {
+			_ = c.cmd.Process.Kill()
+		}
+		c.wait()
+		_ = c.stdout.Close()
+	})
+	return nil
+}
+
+// wait waits a little for the command to exit so its stderr is complete.
+func (c *commandConn) wait() {
+	select {
+	case <-c.exited:
+	case <-time.After(time.Second):
+	}
+}
+
+func (c *commandConn) LocalAddr() net.Addr  { return addr(c.addr) }
+func (c *commandConn) RemoteAddr() net.Addr { return addr(c.addr) }
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	return c.setDeadline(c.stdout, &c.readTimer, t)
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	return c.setDeadline(c.stdin, &c.writeTimer, t)
+}
+
+// setDeadline sets the deadline of one of the pipes. Where pipes have no
+// deadlines, as on Windows, the connection is closed once t passes instead,
+// so a stuck read or write still fails.
+func (c *commandConn) setDeadline(pipe *os.File, timer **time.Timer, t time.Time) error {
+	err := pipe.SetDeadline(t)
+	if !errors.Is(err, os.ErrNoDeadline) {
+		return err
+	}
+
+	c.timerMu.Lock()
+	defer c.timerMu.Unlock()
+
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if !t.IsZero() {
+		*timer = time.AfterFunc(time.Until(t), func() { _ = c.Close() })
+	}
+	return nil
+}
+
+type addr string
+
+func (a addr) Network() string { return "ssh" }
+func (a addr) String() string  { return string(a) }
@@ -0,0 +1,133 @@
+// Package remote reaches a Docker host over SSH. It runs the system ssh
+// binary, so keys, agents and ~/.ssh/config work the same as for
+// docker -H ssh://.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/scmmishra/slick-deploy/internal/docker"
+)
+
+// Host is a machine reached with ssh://[user@]host[:port].
+type Host struct {
+	User     string
+	Hostname string
+	Port     string
+
+	// SSHCommand is the ssh binary to run, "ssh" when empty.
+	SSHCommand string
+}
+
+// ParseHost parses an ssh://[user@]host[:port] URL.
+func ParseHost(raw string) (*Host, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host %q: %w", raw, err)
+	}
+	if u.Scheme != "ssh" {
+		return nil, fmt.Errorf("invalid host %q, expected ssh://[user@]host[:port]", raw)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid host %q, missing the host name", raw)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return nil, fmt.Errorf("invalid host %q, expected no path or query", raw)
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		return nil, fmt.Errorf("invalid host %q, passwords are not supported, use keys or an ssh agent", raw)
+	}
+
+	return &Host{
+		User:     u.User.Username(),
+		Hostname: u.Hostname(),
+		Port:     u.Port(),
+	}, nil
+}
+
+// String returns the host as an ssh:// URL.
+func (h *Host) String() string {
+	host := h.Hostname
+	if h.Port != "" {
+		host = net.JoinHostPort(h.Hostname, h.Port)
+	}
+	if h.User != "" {
+		host = h.User + "@" + host
+	}
+	return "ssh://" + host
+}
+
+// Name returns the host as an ssh:// URL, or "" for a nil host, which
+// stands for the local daemon in deploy records.
+func (h *Host) Name() string {
+	if h == nil {
+		return ""
+	}
+	return h.String()
+}
+
+// command returns the ssh invocation with args placed after the
+// connection options. It is not tied to a context, connections outlive the
+// request that opened them and are stopped by closing them.
+func (h *Host) command(args ...string) *exec.Cmd {
+	name := h.SSHCommand
+	if name == "" {
+		name = "ssh"
+	}
+
+	// BatchMode makes ssh fail instead of prompting, stdin carries data.
+	sshArgs := []string{"-o", "BatchMode=yes"}
+	if h.User != "" {
+		sshArgs = append(sshArgs, "-l", h.User)
+	}
+	if h.Port != "" {
+		sshArgs = append(sshArgs, "-p", h.Port)
+	}
+	sshArgs = append(sshArgs, args...)
+
+	return exec.Command(name, sshArgs...)
+}
+
+// DialDocker connects to the Docker daemon of the host through
+// docker system dial-stdio, ignoring network and addr.
+func (h *Host) DialDocker(_ context.Context, _, _ string) (net.Conn, error) {
+	return h.dial(h.command("--", h.Hostname, "docker", "system", "dial-stdio"))
+}
+
+// Dial opens a TCP connection to addr from the host, like ssh -W. Addresses
+// such as localhost:2019 are resolved on the host.
+func (h *Host) Dial(_ context.Context, network, addr string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, fmt.Errorf("unsupported network %s over ssh", network)
+	}
+	return h.dial(h.command("-W", addr, "--", h.Hostname))
+}
+
+func (h *Host) dial(cmd *exec.Cmd) (net.Conn, error) {
+	conn, err := newCommandConn(cmd, h.String())
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", h, err)
+	}
+	return conn, nil
+}
+
+// Transport returns an HTTP transport whose connections are made from the
+// host, for the Caddy admin API and health checks.
+func (h *Host) Transport() http.RoundTripper {
+	return &http.Transport{
+		DialContext: h.Dial,
+		// Every connection is an ssh process, don't keep them around.
+		DisableKeepAlives: true,
+	}
+}
+
+// DockerClient returns a Docker client for the daemon of the host.
+func (h *Host) DockerClient() (docker.DockerClient, error) {
+	return docker.NewDockerClientWithDialer(h.DialDocker)
+}
@@ -0,0 +1,366 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// errWouldBlock is returned by tryLock when another process holds the lock.
+var errWouldBlock = errors.New("lock is held by another process")
+
+// LockInfo describes the process holding the deploy lock of an app.
+type LockInfo struct {
+	App string `json:"app"`
+	// Server is the server deployed to, "" for the local machine. Host is
+	// the machine running slick.
+	Server     string    `json:"server,omitempty"`
+	PID        int       `json:"pid"`
+	Host       string    `json:"host"`
+	User       string    `json:"user"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+func (i LockInfo) String() string {
+	return fmt.Sprintf("%s@%s (pid %d) since %s",
+		i.User, i.Host, i.PID, i.AcquiredAt.Local().Format("2006-01-02 15:04:05"))
+}
+
+// LockedError is returned when a deploy of the app is already in progress.
+type LockedError struct {
+	Info LockInfo
+}
+
+func (e *LockedError) Error() string {
+	if e.Info.Server != "" {
+		return fmt.Sprintf("a deploy of %s to %s is already in progress by %s", e.Info.App, e.Info.Server, e.Info)
+	}
+	return fmt.Sprintf("a deploy of %s is already in progress by %s", e.Info.App, e.Info)
+}
+
+// Lock is a held deploy lock, released with Unlock.
+type Lock struct {
+	file   *os.File
+	path   string
+	holder string
+}
+
+// CurrentUser is the name of the user running slick.
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// CurrentLockInfo describes the running process as a lock holder.
+func CurrentLockInfo(app string) LockInfo {
+	host, _ := os.Hostname()
+
+	return LockInfo{
+		App:        app,
+		PID:        os.Getpid(),
+		Host:       host,
+		User:       CurrentUser(),
+		AcquiredAt: time.Now(),
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// serverSuffix tells the state files of different servers apart.
+func serverSuffix(server string) string {
+	if server == "" {
+		return ""
+	}
+	return "-" + unsafeFileChars.ReplaceAllString(strings.TrimPrefix(server, "ssh://"), "_")
+}
+
+// lockPath is the file the deploy lock of app on server is taken on. It
+// only ever holds the lock, so Windows, where a lock keeps others from
+// reading the file, can still tell who holds it from the holder file.
+func (s *Store) lockPath(app, server string) string {
+	return filepath.Join(s.AppDir(app), "deploy"+serverSuffix(server)+".lock")
+}
+
+// holderPath is the file describing the holder of the deploy lock of app
+// on server.
+func (s *Store) holderPath(app, server string) string {
+	return filepath.Join(s.AppDir(app), "holder"+serverSuffix(server)+".json")
+}
+
+// Lock takes the deploy lock of an app on server, "" for the local
+// machine, without waiting. It returns a *LockedError when another process
+// holds it.
+//
+// Locks live in the state directory of the machine running slick, so they
+// keep apart the deploys started from this machine only.
+func (s *Store) Lock(app, server string) (*Lock, error) {
+	if err := os.MkdirAll(s.AppDir(app), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating state directory: %w", err)
+	}
+
+	path := s.lockPath(app, server)
+	holder := s.holderPath(app, server)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+
+	if err := tryLock(f); err != nil {
+		f.Close()
+		if !errors.Is(err, errWouldBlock) {
+			return nil, fmt.Errorf("error locking %s: %w", path, err)
+		}
+
+		info, readErr := readLockInfo(holder)
+		if readErr != nil {
+			return nil, &LockedError{Info: LockInfo{App: app, Server: server}}
+		}
+		return nil, &LockedError{Info: *info}
+	}
+
+	// A force unlock removes the lock file, so the file we opened may no
+	// longer be the lock file. Start over in that case.
+	if !isLockFile(f, path) {
+		_ = unlock(f)
+		f.Close()
+		return s.Lock(app, server)
+	}
+
+	info := CurrentLockInfo(app)
+	info.Server = server
+	data, err := json.Marshal(info)
+	if err == nil {
+		err = writeFileAtomic(holder, data)
+	}
+	if err != nil {
+		_ = unlock(f)
+		f.Close()
+		return nil, fmt.Errorf("error writing lock holder: %w", err)
+	}
+
+	return &Lock{file: f, path: path, holder: holder}, nil
+}
+
+// LockWait takes the deploy lock of an app, polling until it is free or ctx
+// is done.
+func (s *Store) LockWait(ctx context.Context, app, server string, poll time.Duration) (*Lock, error) {
+	for {
+		lock, err := s.Lock(app, server)
+		var locked *LockedError
+		if !errors.As(err, &locked) {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up waiting for the deploy lock: %w", err)
+		case <-time.After(poll):
+		}
+	}
+}
+
+// LockHolder returns who holds the deploy lock of an app on server, or nil
+// when no deploy is in progress. Holder files left behind by a crashed
+// process are stale and reported as free.
+func (s *Store) LockHolder(app, server string) (*LockInfo, error) {
+	path := s.lockPath(app, server)
+	info, err := readLockInfo(s.holderPath(app, server))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+	defer f.Close()
+
+	if err := tryLock(f); err == nil {
+		// Nobody holds the lock, the holder file was left behind.
+		_ = unlock(f)
+		return nil, nil
+	}
+
+	if isStale(info) {
+		return nil, nil
+	}
+
+	return info, nil
+}
+
+// ActiveLocks returns the holders of all deploy locks in the store.
+func (s *Store) ActiveLocks() ([]LockInfo, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state directory: %w", err)
+	}
+
+	var locks []LockInfo
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		holders, err := filepath.Glob(filepath.Join(s.AppDir(entry.Name()), "holder*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range holders {
+			recorded, err := readLockInfo(path)
+			if err != nil {
+				continue
+			}
+			info, err := s.LockHolder(entry.Name(), recorded.Server)
+			if err != nil {
+				return nil, err
+			}
+			if info != nil {
+				locks = append(locks, *info)
+			}
+		}
+	}
+
+	return locks, nil
+}
+
+// ForceUnlock removes the lock files of an app on server so the next
+// deploy can take the lock, even if the holder is still running. Windows
+// refuses to remove the lock file of a running holder.
+func (s *Store) ForceUnlock(app, server string) error {
+	for _, path := range []string{s.holderPath(app, server), s.lockPath(app, server)} {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing lock file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Unlock releases the lock and removes its holder file.
+func (l *Lock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	// The holder file goes first, as the next holder writes its own once it
+	// has the lock. The lock file is kept: a waiting process may already
+	// have it open. After a force unlock both may belong to someone else
+	// and are left alone.
+	if isLockFile(l.file, l.path) {
+		_ = os.Remove(l.holder)
+	}
+	err := unlock(l.file)
+	l.file.Close()
+	l.file = nil
+	return err
+}
+
+func isLockFile(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+func readLockInfo(path string) (*LockInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("error parsing lock file: %w", err)
+	}
+
+	return &info, nil
+}
+
+// fileLockTimeout bounds how long withFileLock waits for another process
+// or goroutine to finish with the state file.
+const fileLockTimeout = 10 * time.Second
+
+// withFileLock runs fn while holding the lock file at path, waiting for
+// other holders in this or other processes. what names the guarded state
+// in errors.
+func withFileLock(path, what string, fn func() error) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening lock file: %w", err)
+	}
+	defer f.Close()
+
+	deadline := time.Now().Add(fileLockTimeout)
+	for {
+		err := tryLock(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errWouldBlock) {
+			return fmt.Errorf("error locking %s: %w", what, err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s: %w", what, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer unlock(f)
+
+	return fn()
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file in the same directory, so readers never see a partial write.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// isStale reports whether a lock was taken on this host by a process that
+// no longer exists.
+func isStale(info *LockInfo) bool {
+	host, err := os.Hostname()
+	if err != nil || info.Host != host || info.PID <= 0 {
+		return false
+	}
+	return !processAlive(info.PID)
+}
@@ -0,0 +1,153 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Lock(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	lock, err := store.Lock("memos", "")
+	require.NoError(t, err)
+
+	_, err = store.Lock("memos", "")
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, os.Getpid(), locked.Info.PID)
+	assert.Equal(t, "memos", locked.Info.App)
+
+	// Other apps are not affected
+	other, err := store.Lock("blog", "")
+	require.NoError(t, err)
+	require.NoError(t, other.Unlock())
+
+	require.NoError(t, lock.Unlock())
+
+	lock, err = store.Lock("memos", "")
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+}
+
+func TestStore_LockPerServer(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	web1, err := store.Lock("memos", "ssh://deploy@web1.example.com")
+	require.NoError(t, err)
+	defer web1.Unlock()
+
+	// Other servers of the app are not affected
+	web2, err := store.Lock("memos", "ssh://deploy@web2.example.com")
+	require.NoError(t, err)
+	require.NoError(t, web2.Unlock())
+
+	_, err = store.Lock("memos", "ssh://deploy@web1.example.com")
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, "ssh://deploy@web1.example.com", locked.Info.Server)
+	assert.Contains(t, err.Error(), "a deploy of memos to ssh://deploy@web1.example.com is already in progress")
+
+	locks, err := store.ActiveLocks()
+	require.NoError(t, err)
+	require.Len(t, locks, 1)
+	assert.Equal(t, "ssh://deploy@web1.example.com", locks[0].Server)
+}
+
+func TestStore_LockHolder(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	holder, err := store.LockHolder("memos", "")
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	lock, err := store.Lock("memos", "")
+	require.NoError(t, err)
+
+	holder, err = store.LockHolder("memos", "")
+	require.NoError(t, err)
+	require.NotNil(t, holder)
+	assert.Equal(t, os.Getpid(), holder.PID)
+
+	locks, err := store.ActiveLocks()
+	require.NoError(t, err)
+	assert.Len(t, locks, 1)
+
+	require.NoError(t, lock.Unlock())
+
+	holder, err = store.LockHolder("memos", "")
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+}
+
+func TestStore_LockHolder_LeftoverFile(t *testing.T) {
+	store := NewStore(t.TempDir())
+	require.NoError(t, os.MkdirAll(store.AppDir("memos"), 0o755))
+
+	// A holder file nobody holds the lock for, as left behind by a crashed
+	// deploy
+	data, err := json.Marshal(LockInfo{App: "memos", PID: 999999, Host: "elsewhere"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(store.holderPath("memos", ""), data, 0o644))
+
+	holder, err := store.LockHolder("memos", "")
+	require.NoError(t, err)
+	assert.Nil(t, holder)
+
+	lock, err := store.Lock("memos", "")
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+}
+
+func TestStore_LockWait(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	lock, err := store.Lock("memos", "")
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = lock.Unlock()
+	}()
+
+	waited, err := store.LockWait(context.Background(), "memos", "", 10*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, waited.Unlock())
+}
+
+func TestStore_LockWait_Cancelled(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	lock, err := store.Lock("memos", "")
+	require.NoError(t, err)
+	defer lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	_, err = store.LockWait(ctx, "memos", "", 10*time.Millisecond)
+	var locked *LockedError
+	assert.ErrorAs(t, err, &locked)
+}
+
+func TestStore_ForceUnlock(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	stuck, err := store.Lock("memos", "")
+	require.NoError(t, err)
+	defer stuck.Unlock()
+
+	require.NoError(t, store.ForceUnlock("memos", ""))
+
+	lock, err := store.Lock("memos", "")
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+
+	// Removing a missing lock is not an error
+	assert.NoError(t, store.ForceUnlock("memos", ""))
+}
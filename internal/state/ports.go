@@ -0,0 +1,129 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// portReservationTTL is how long a reserved port is held back. By then
+	// the container publishing it is running and Docker reports the port.
+	portReservationTTL = 10 * time.Minute
+)
+
+// PortReservation records a host port handed out to a deploy that may not
+// be listening on it yet.
+type PortReservation struct {
+	App        string    `json:"app"`
+	PID        int       `json:"pid"`
+	Host       string    `json:"host"`
+	ReservedAt time.Time `json:"reserved_at"`
+}
+
+// portsPath is the file holding the port reservations on server, every
+// server hands out its own ports.
+func (s *Store) portsPath(server string) string {
+	return filepath.Join(s.Dir, "ports"+serverSuffix(server)+".json")
+}
+
+// ReservePort reserves a host port on server for app. pick is called with
+// the ports reserved there by other deploys and returns the port to
+// reserve. Reservations are made under a file lock so concurrent deploys
+// never get the same port.
+func (s *Store) ReservePort(app, server string, pick func(reserved []int) (int, error)) (int, error) {
+	var port int
+	err := s.withPortsLock(server, func() error {
+		reservations, err := s.portReservations(server)
+		if err != nil {
+			return err
+		}
+
+		reserved := make([]int, 0, len(reservations))
+		for p := range reservations {
+			reserved = append(reserved, p)
+		}
+
+		port, err = pick(reserved)
+		if err != nil {
+			return err
+		}
+
+		host, _ := os.Hostname()
+		reservations[port] = PortReservation{
+			App:        app,
+			PID:        os.Getpid(),
+			Host:       host,
+			ReservedAt: time.Now(),
+		}
+		return s.writePortReservations(server, reservations)
+	})
+
+	return port, err
+}
+
+// ReleasePort drops the reservation of port on server, used when the port
+// was not used after all.
+func (s *Store) ReleasePort(server string, port int) error {
+	return s.withPortsLock(server, func() error {
+		reservations, err := s.portReservations(server)
+		if err != nil {
+			return err
+		}
+		if _, ok := reservations[port]; !ok {
+			return nil
+		}
+		delete(reservations, port)
+		return s.writePortReservations(server, reservations)
+	})
+}
+
+// portReservations reads the live reservations, dropping expired ones and
+// the ones made by processes on this host that no longer exist.
+func (s *Store) portReservations(server string) (map[int]PortReservation, error) {
+	reservations := map[int]PortReservation{}
+
+	data, err := os.ReadFile(s.portsPath(server))
+	if errors.Is(err, os.ErrNotExist) {
+		return reservations, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading port reservations: %w", err)
+	}
+	if err := json.Unmarshal(data, &reservations); err != nil {
+		return nil, fmt.Errorf("error parsing port reservations: %w", err)
+	}
+
+	for port, r := range reservations {
+		stale := isStale(&LockInfo{PID: r.PID, Host: r.Host})
+		if stale || time.Since(r.ReservedAt) > portReservationTTL {
+			delete(reservations, port)
+		}
+	}
+
+	return reservations, nil
+}
+
+func (s *Store) writePortReservations(server string, reservations map[int]PortReservation) error {
+	data, err := json.MarshalIndent(reservations, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.portsPath(server), data); err != nil {
+		return fmt.Errorf("error writing port reservations: %w", err)
+	}
+	return nil
+}
+
+// withPortsLock runs fn while holding the lock of the reservation file of
+// server.
+func (s *Store) withPortsLock(server string, fn func() error) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("error creating state directory: %w", err)
+	}
+	return withFileLock(filepath.Join(s.Dir, "ports"+serverSuffix(server)+".lock"), "port reservations", fn)
+}
@@ -0,0 +1,113 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// firstFree picks the first port from 8000 that is not reserved.
+func firstFree(reserved []int) (int, error) {
+	taken := map[int]bool{}
+	for _, p := range reserved {
+		taken[p] = true
+	}
+	for port := 8000; port < 8100; port++ {
+		if !taken[port] {
+			return port, nil
+		}
+	}
+	return 0, errors.New("no available ports")
+}
+
+func TestStore_ReservePort(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	first, err := store.ReservePort("memos", "", firstFree)
+	require.NoError(t, err)
+	second, err := store.ReservePort("memos", "", firstFree)
+	require.NoError(t, err)
+
+	assert.Equal(t, 8000, first)
+	assert.Equal(t, 8001, second)
+
+	require.NoError(t, store.ReleasePort("", first))
+
+	again, err := store.ReservePort("memos", "", firstFree)
+	require.NoError(t, err)
+	assert.Equal(t, 8000, again)
+}
+
+func TestStore_ReservePort_PerServer(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	local, err := store.ReservePort("memos", "", firstFree)
+	require.NoError(t, err)
+	web1, err := store.ReservePort("memos", "deploy@web1", firstFree)
+	require.NoError(t, err)
+	web2, err := store.ReservePort("memos", "deploy@web2", firstFree)
+	require.NoError(t, err)
+
+	assert.Equal(t, 8000, local)
+	assert.Equal(t, 8000, web1)
+	assert.Equal(t, 8000, web2)
+
+	again, err := store.ReservePort("memos", "deploy@web1", firstFree)
+	require.NoError(t, err)
+	assert.Equal(t, 8001, again)
+}
+
+func TestStore_ReservePort_Concurrent(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	var mu sync.Mutex
+	seen := map[int]bool{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			port, err := store.ReservePort("memos", "", firstFree)
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.False(t, seen[port], "port %d handed out twice", port)
+			seen[port] = true
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 20)
+}
+
+func TestStore_ReservePort_DropsExpired(t *testing.T) {
+	store := NewStore(t.TempDir())
+	require.NoError(t, os.MkdirAll(store.Dir, 0o755))
+
+	data, err := json.Marshal(map[int]PortReservation{
+		8000: {App: "memos", PID: os.Getpid(), ReservedAt: time.Now().Add(-time.Hour)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(store.portsPath(""), data, 0o644))
+
+	port, err := store.ReservePort("memos", "", firstFree)
+	require.NoError(t, err)
+	assert.Equal(t, 8000, port)
+}
+
+func TestStore_ReservePort_PickError(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	_, err := store.ReservePort("memos", "", func([]int) (int, error) {
+		return 0, errors.New("no available ports")
+	})
+	assert.EqualError(t, err, "no available ports")
+}
@@ -0,0 +1,248 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	// StatusStopped records slick stop, the app stays down until the next
+	// successful deploy.
+	StatusStopped = "stopped"
+
+	// maxHistory is the number of deployments kept per app.
+	maxHistory = 50
+)
+
+// Deployment is the record of a single deploy of an app.
+type Deployment struct {
+	ID          string    `json:"id"`
+	App         string    `json:"app"`
+	Image       string    `json:"image"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Port        int       `json:"port,omitempty"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	GitSHA      string    `json:"git_sha,omitempty"`
+	Deployer    string    `json:"deployer,omitempty"`
+	ConfigHash  string    `json:"config_hash,omitempty"`
+	Host        string    `json:"host,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+// Store persists deployment records on disk, one directory per app.
+type Store struct {
+	Dir string
+}
+
+// NewStore creates a Store rooted at dir.
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+// DefaultDir returns the state directory, $SLICK_STATE_DIR or ~/.slick.
+func DefaultDir() string {
+	if dir := os.Getenv("SLICK_STATE_DIR"); dir != "" {
+		return dir
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".slick"
+	}
+
+	return filepath.Join(home, ".slick")
+}
+
+// NewDeploymentID returns a sortable, reasonably unique deployment id.
+func NewDeploymentID(now time.Time) string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return now.UTC().Format("20060102150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// AppDir returns the directory holding the state of the given app.
+func (s *Store) AppDir(app string) string {
+	if app == "" {
+		app = "default"
+	}
+	return filepath.Join(s.Dir, app)
+}
+
+func (s *Store) historyPath(app string) string {
+	return filepath.Join(s.AppDir(app), "deployments.json")
+}
+
+// History returns the recorded deployments of an app, oldest first.
+func (s *Store) History(app string) ([]Deployment, error) {
+	data, err := os.ReadFile(s.historyPath(app))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading deploy history: %w", err)
+	}
+
+	var deployments []Deployment
+	if err := json.Unmarshal(data, &deployments); err != nil {
+		return nil, fmt.Errorf("error parsing deploy history: %w", err)
+	}
+
+	return deployments, nil
+}
+
+// Record appends a deployment to the history of its app. Records are made
+// under a file lock, so the deploys of a fleet can record at the same time.
+func (s *Store) Record(d Deployment) error {
+	if err := os.MkdirAll(s.AppDir(d.App), 0o755); err != nil {
+		return fmt.Errorf("error creating state directory: %w", err)
+	}
+
+	lockPath := filepath.Join(s.AppDir(d.App), "deployments.lock")
+	return withFileLock(lockPath, "deploy history", func() error {
+		deployments, err := s.History(d.App)
+		if err != nil {
+			return err
+		}
+
+		deployments = append(deployments, d)
+		if len(deployments) > maxHistory {
+			deployments = deployments[len(deployments)-maxHistory:]
+		}
+
+		data, err := json.MarshalIndent(deployments, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		// A crash never leaves a truncated history behind.
+		if err := writeFileAtomic(s.historyPath(d.App), data); err != nil {
+			return fmt.Errorf("error writing deploy history: %w", err)
+		}
+		return nil
+	})
+}
+
+// LastSuccessful returns the most recent successful deployment of an app,
+// or nil if there is none.
+func (s *Store) LastSuccessful(app string) (*Deployment, error) {
+	deployments, err := s.History(app)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(deployments) - 1; i >= 0; i-- {
+		if deployments[i].Status == StatusSucceeded {
+			return &deployments[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// LastSuccessfulOn returns the most recent successful deployment of app on
+// host, the ssh:// URL of a server or "" for the local machine.
+func (s *Store) LastSuccessfulOn(app, host string) (*Deployment, error) {
+	deployments, err := s.History(app)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(deployments) - 1; i >= 0; i-- {
+		if deployments[i].Status == StatusSucceeded && deployments[i].Host == host {
+			return &deployments[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// LastOn returns the most recent deployment of app on host, whatever its
+// outcome.
+func (s *Store) LastOn(app, host string) (*Deployment, error) {
+	deployments, err := s.History(app)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(deployments) - 1; i >= 0; i-- {
+		if deployments[i].Host == host {
+			return &deployments[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// StoppedOn returns the record of slick stop when app on host was stopped
+// and no deploy succeeded since, or nil while it is up.
+func (s *Store) StoppedOn(app, host string) (*Deployment, error) {
+	deployments, err := s.History(app)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(deployments) - 1; i >= 0; i-- {
+		if deployments[i].Host != host {
+			continue
+		}
+		switch deployments[i].Status {
+		case StatusStopped:
+			return &deployments[i], nil
+		case StatusSucceeded:
+			return nil, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// RecentOn returns the last n deployments of app on host, newest first,
+// whatever their outcome.
+func (s *Store) RecentOn(app, host string, n int) ([]Deployment, error) {
+	deployments, err := s.History(app)
+	if err != nil {
+		return nil, err
+	}
+
+	recent := []Deployment{}
+	for i := len(deployments) - 1; i >= 0 && len(recent) < n; i-- {
+		if deployments[i].Host == host {
+			recent = append(recent, deployments[i])
+		}
+	}
+
+	return recent, nil
+}
+
+// RecentImages returns the distinct images of the last n successful
+// deployments of app on host, newest first. These are the images a rollback
+// can go back to.
+func (s *Store) RecentImages(app, host string, n int) ([]string, error) {
+	deployments, err := s.History(app)
+	if err != nil {
+		return nil, err
+	}
+
+	images := []string{}
+	seen := map[string]bool{}
+	for i := len(deployments) - 1; i >= 0 && len(images) < n; i-- {
+		d := deployments[i]
+		if d.Status != StatusSucceeded || d.Host != host || d.Image == "" || seen[d.Image] {
+			continue
+		}
+		seen[d.Image] = true
+		images = append(images, d.Image)
+	}
+
+	return images, nil
+}
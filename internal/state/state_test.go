@@ -0,0 +1,211 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_RecordAndHistory(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	history, err := store.History("memos")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	require.NoError(t, store.Record(Deployment{ID: "1", App: "memos", Image: "memos:1", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "2", App: "memos", Image: "memos:2", Status: StatusFailed}))
+
+	history, err = store.History("memos")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "1", history[0].ID)
+	assert.Equal(t, "2", history[1].ID)
+}
+
+func TestStore_RecordConcurrent(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, store.Record(Deployment{ID: strconv.Itoa(i), App: "memos", Status: StatusSucceeded}))
+		}(i)
+	}
+	wg.Wait()
+
+	history, err := store.History("memos")
+	require.NoError(t, err)
+	ids := make([]string, 0, len(history))
+	for _, d := range history {
+		ids = append(ids, d.ID)
+	}
+	assert.Len(t, ids, 20)
+	for i := 0; i < 20; i++ {
+		assert.Contains(t, ids, strconv.Itoa(i))
+	}
+
+	// No temporary files are left behind.
+	matches, err := filepath.Glob(filepath.Join(store.AppDir("memos"), "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestStore_RecordTrimsHistory(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	for i := 0; i < maxHistory+5; i++ {
+		require.NoError(t, store.Record(Deployment{App: "memos", Status: StatusSucceeded}))
+	}
+
+	history, err := store.History("memos")
+	require.NoError(t, err)
+	assert.Len(t, history, maxHistory)
+}
+
+func TestStore_LastSuccessful(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	last, err := store.LastSuccessful("memos")
+	require.NoError(t, err)
+	assert.Nil(t, last)
+
+	require.NoError(t, store.Record(Deployment{ID: "1", App: "memos", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "2", App: "memos", Status: StatusFailed}))
+
+	last, err = store.LastSuccessful("memos")
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, "1", last.ID)
+}
+
+func TestStore_LastSuccessfulOn(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	require.NoError(t, store.Record(Deployment{ID: "1", App: "memos", Image: "memos:1", Host: "ssh://web1", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "2", App: "memos", Image: "memos:2", Host: "ssh://web2", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "3", App: "memos", Image: "memos:3", Host: "ssh://web1", Status: StatusFailed}))
+	require.NoError(t, store.Record(Deployment{ID: "4", App: "memos", Image: "memos:4", Status: StatusSucceeded}))
+
+	last, err := store.LastSuccessfulOn("memos", "ssh://web1")
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, "memos:1", last.Image)
+
+	last, err = store.LastSuccessfulOn("memos", "")
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, "memos:4", last.Image)
+
+	last, err = store.LastSuccessfulOn("memos", "ssh://web3")
+	require.NoError(t, err)
+	assert.Nil(t, last)
+}
+
+func TestStore_LastOn(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	require.NoError(t, store.Record(Deployment{ID: "1", App: "memos", Host: "ssh://web1", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "2", App: "memos", Host: "ssh://web1", Status: StatusFailed}))
+	require.NoError(t, store.Record(Deployment{ID: "3", App: "memos", Status: StatusSucceeded}))
+
+	last, err := store.LastOn("memos", "ssh://web1")
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, "2", last.ID)
+
+	last, err = store.LastOn("memos", "ssh://web2")
+	require.NoError(t, err)
+	assert.Nil(t, last)
+}
+
+func TestStore_RecentOn(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	require.NoError(t, store.Record(Deployment{ID: "1", App: "memos", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "2", App: "memos", Host: "ssh://web1", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "3", App: "memos", Status: StatusFailed}))
+	require.NoError(t, store.Record(Deployment{ID: "4", App: "memos", Status: StatusSucceeded}))
+
+	recent, err := store.RecentOn("memos", "", 2)
+	require.NoError(t, err)
+	require.Len(t, recent, 2)
+	assert.Equal(t, "4", recent[0].ID)
+	assert.Equal(t, "3", recent[1].ID)
+}
+
+func TestStore_StoppedOn(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	require.NoError(t, store.Record(Deployment{ID: "1", App: "memos", Status: StatusSucceeded}))
+	stopped, err := store.StoppedOn("memos", "")
+	require.NoError(t, err)
+	assert.Nil(t, stopped)
+
+	require.NoError(t, store.Record(Deployment{ID: "2", App: "memos", Status: StatusStopped}))
+	// A failed start leaves the app stopped, other servers do not count.
+	require.NoError(t, store.Record(Deployment{ID: "3", App: "memos", Status: StatusFailed}))
+	require.NoError(t, store.Record(Deployment{ID: "4", App: "memos", Host: "ssh://web1", Status: StatusSucceeded}))
+	stopped, err = store.StoppedOn("memos", "")
+	require.NoError(t, err)
+	require.NotNil(t, stopped)
+	assert.Equal(t, "2", stopped.ID)
+
+	require.NoError(t, store.Record(Deployment{ID: "5", App: "memos", Status: StatusSucceeded}))
+	stopped, err = store.StoppedOn("memos", "")
+	require.NoError(t, err)
+	assert.Nil(t, stopped)
+}
+
+func TestStore_RecentImages(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	require.NoError(t, store.Record(Deployment{ID: "1", App: "memos", Image: "memos:1", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "2", App: "memos", Image: "memos:2", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "3", App: "memos", Image: "memos:3", Status: StatusFailed}))
+	require.NoError(t, store.Record(Deployment{ID: "4", App: "memos", Image: "memos:2", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "5", App: "memos", Image: "memos:5", Host: "ssh://web1", Status: StatusSucceeded}))
+	require.NoError(t, store.Record(Deployment{ID: "6", App: "memos", Image: "memos:6", Status: StatusSucceeded}))
+
+	images, err := store.RecentImages("memos", "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"memos:6", "memos:2"}, images)
+
+	images, err = store.RecentImages("memos", "", 5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"memos:6", "memos:2", "memos:1"}, images)
+
+	images, err = store.RecentImages("other", "", 3)
+	require.NoError(t, err)
+	assert.Empty(t, images)
+}
+
+func TestStore_HistoryCorrupt(t *testing.T) {
+	store := NewStore(t.TempDir())
+	require.NoError(t, os.MkdirAll(store.AppDir("memos"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(store.AppDir("memos"), "deployments.json"), []byte("{"), 0o644))
+
+	_, err := store.History("memos")
+	assert.Error(t, err)
+}
+
+func TestDefaultDir(t *testing.T) {
+	t.Setenv("SLICK_STATE_DIR", "/tmp/slick-state")
+	assert.Equal(t, "/tmp/slick-state", DefaultDir())
+}
+
+func TestNewDeploymentID(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	id := NewDeploymentID(now)
+
+	assert.Regexp(t, `^20240102030405-[0-9a-f]{6}$`, id)
+	assert.NotEqual(t, id, NewDeploymentID(now))
+}
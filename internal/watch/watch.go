@@ -0,0 +1,151 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/health"
+	"github.com/scmmishra/slick-deploy/internal/state"
+)
+
+const (
+	EventHealthy    = "healthy"
+	EventUnhealthy  = "unhealthy"
+	EventMissing    = "missing"
+	EventRestarted  = "restarted"
+	EventRedeployed = "redeployed"
+	EventError      = "error"
+)
+
+// Event describes something the watcher observed or did.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	App         string    `json:"app"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Failures    int       `json:"failures,omitempty"`
+	Message     string    `json:"message,omitempty"`
+}
+
+// Watcher periodically checks the health of the live app container and
+// restarts or redeploys it after too many consecutive failures.
+type Watcher struct {
+	Config   config.DeploymentConfig
+	Docker   *docker.DockerService
+	Store    *state.Store
+	Clock    clockwork.Clock
+	Redeploy func(ctx context.Context, cfg config.DeploymentConfig) error
+	// Host is the server watched, as recorded in the deploy history, ""
+	// for the local machine.
+	Host string
+	// Transport sends the health checks, the default transport when nil.
+	Transport http.RoundTripper
+	Emit      func(Event)
+
+	failures int
+}
+
+// Run checks the app every watch interval until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := time.Duration(w.Config.Watch.IntervalSeconds) * time.Second
+
+	for {
+		w.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.Clock.After(interval):
+		}
+	}
+}
+
+func (w *Watcher) check(ctx context.Context) {
+	// An app stopped with slick stop is down on purpose.
+	if stopped, err := w.Store.StoppedOn(w.Config.App.Name, w.Host); err == nil && stopped != nil {
+		w.failures = 0
+		return
+	}
+
+	current := w.Docker.FindContainer(ctx, w.Config.App.Name)
+	if current == nil {
+		w.failures++
+		w.emit(Event{Type: EventMissing, Failures: w.failures, Message: "no running container found"})
+		w.recoverIfNeeded(ctx, nil)
+		return
+	}
+
+	// A single probe per tick, the watch interval takes care of retries.
+	probe := w.Config.HealthCheck
+	probe.MaxRetries = 1
+	probe.IntervalSeconds = 0
+
+	host := "http://" + current.Address()
+	if err := health.CheckHealthWithOptions(ctx, host, &probe, health.Options{Clock: w.Clock, Transport: w.Transport}); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		w.failures++
+		w.emit(Event{Type: EventUnhealthy, ContainerID: current.ID, Failures: w.failures, Message: err.Error()})
+		w.recoverIfNeeded(ctx, current)
+		return
+	}
+
+	if w.failures > 0 {
+		w.emit(Event{Type: EventHealthy, ContainerID: current.ID, Message: "container recovered"})
+	}
+	w.failures = 0
+}
+
+func (w *Watcher) recoverIfNeeded(ctx context.Context, current *docker.Container) {
+	if w.failures < w.Config.Watch.FailureThreshold {
+		return
+	}
+	w.failures = 0
+
+	if current != nil && w.Config.Watch.Action == "restart" {
+		err := w.Docker.RestartContainer(ctx, current.ID)
+		if err == nil {
+			w.emit(Event{Type: EventRestarted, ContainerID: current.ID})
+			return
+		}
+		w.emit(Event{Type: EventError, ContainerID: current.ID, Message: fmt.Sprintf("restart failed: %v", err)})
+	}
+
+	w.redeploy(ctx)
+}
+
+// redeploy rolls out the image of the last successful deployment on the
+// watched host, falling back to the configured image when there is none.
+func (w *Watcher) redeploy(ctx context.Context) {
+	cfg := w.Config
+
+	last, err := w.Store.LastSuccessfulOn(cfg.App.Name, w.Host)
+	if err != nil {
+		w.emit(Event{Type: EventError, Message: err.Error()})
+	}
+	if last != nil && last.Image != "" {
+		cfg.App.ImageName = last.Image
+	}
+
+	if err := w.Redeploy(ctx, cfg); err != nil {
+		w.emit(Event{Type: EventError, Message: fmt.Sprintf("redeploy of %s failed: %v", cfg.App.ImageName, err)})
+		return
+	}
+
+	w.emit(Event{Type: EventRedeployed, Message: cfg.App.ImageName})
+}
+
+func (w *Watcher) emit(e Event) {
+	if w.Emit == nil {
+		return
+	}
+	e.Time = w.Clock.Now()
+	e.App = w.Config.App.Name
+	w.Emit(e)
+}
@@ -0,0 +1,239 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/jonboulle/clockwork"
+	"github.com/scmmishra/slick-deploy/internal/config"
+	"github.com/scmmishra/slick-deploy/internal/docker"
+	"github.com/scmmishra/slick-deploy/internal/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestWatcher wires a watcher to a mock Docker client that reports one
+// container of the app image published on the port of serverURL.
+func newTestWatcher(t *testing.T, serverURL string, action string) (*Watcher, *docker.MockDockerClient, *[]Event) {
+	t.Helper()
+
+	u, err := url.Parse(serverURL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+
+	mockClient := new(docker.MockDockerClient)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+		{ID: "container123", Ports: []types.Port{{PrivatePort: 8080, PublicPort: uint16(port), Type: "tcp"}}},
+	}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container123").Return(types.ContainerJSON{
+		Config: &container.Config{Image: "example/image:latest"},
+	}, nil)
+
+	events := &[]Event{}
+	w := &Watcher{
+		Config: config.DeploymentConfig{
+			App:         config.App{Name: "test-app", ImageName: "example/image:latest"},
+			HealthCheck: config.HealthCheck{Endpoint: "/health", TimeoutSeconds: 1},
+			Watch:       config.WatchConfig{IntervalSeconds: 1, FailureThreshold: 2, Action: action},
+		},
+		Docker: docker.NewDockerService(mockClient),
+		Store:  state.NewStore(t.TempDir()),
+		Clock:  clockwork.NewFakeClock(),
+		Redeploy: func(context.Context, config.DeploymentConfig) error {
+			return nil
+		},
+		Emit: func(e Event) { *events = append(*events, e) },
+	}
+
+	return w, mockClient, events
+}
+
+func TestWatcher_Healthy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	w, _, events := newTestWatcher(t, server.URL, "restart")
+	w.check(context.Background())
+
+	assert.Empty(t, *events)
+	assert.Equal(t, 0, w.failures)
+}
+
+func TestWatcher_RestartsAfterThreshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	w, mockClient, events := newTestWatcher(t, server.URL, "restart")
+	mockClient.On("ContainerRestart", mock.Anything, "container123", mock.Anything).Return(nil)
+
+	w.check(context.Background())
+	mockClient.AssertNotCalled(t, "ContainerRestart", mock.Anything, mock.Anything, mock.Anything)
+
+	w.check(context.Background())
+	mockClient.AssertCalled(t, "ContainerRestart", mock.Anything, "container123", mock.Anything)
+
+	require.Len(t, *events, 3)
+	assert.Equal(t, EventUnhealthy, (*events)[0].Type)
+	assert.Equal(t, 2, (*events)[1].Failures)
+	assert.Equal(t, EventRestarted, (*events)[2].Type)
+	assert.Equal(t, 0, w.failures)
+}
+
+func TestWatcher_RedeploysLastKnownGood(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	w, mockClient, events := newTestWatcher(t, server.URL, "redeploy")
+	require.NoError(t, w.Store.Record(state.Deployment{App: "test-app", Image: "example/image:v1", Status: state.StatusSucceeded}))
+	require.NoError(t, w.Store.Record(state.Deployment{App: "test-app", Image: "example/image:v2", Status: state.StatusFailed}))
+
+	var redeployed string
+	w.Redeploy = func(_ context.Context, cfg config.DeploymentConfig) error {
+		redeployed = cfg.App.ImageName
+		return nil
+	}
+
+	w.check(context.Background())
+	w.check(context.Background())
+
+	assert.Equal(t, "example/image:v1", redeployed)
+	assert.Equal(t, EventRedeployed, (*events)[len(*events)-1].Type)
+	mockClient.AssertNotCalled(t, "ContainerRestart", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWatcher_RedeploysImageOfWatchedHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	w, _, _ := newTestWatcher(t, server.URL, "redeploy")
+	w.Host = "ssh://web1.example.com"
+	require.NoError(t, w.Store.Record(state.Deployment{App: "test-app", Host: "ssh://web1.example.com", Image: "example/image:v1", Status: state.StatusSucceeded}))
+	require.NoError(t, w.Store.Record(state.Deployment{App: "test-app", Host: "ssh://web2.example.com", Image: "example/image:v2", Status: state.StatusSucceeded}))
+
+	var redeployed string
+	w.Redeploy = func(_ context.Context, cfg config.DeploymentConfig) error {
+		redeployed = cfg.App.ImageName
+		return nil
+	}
+
+	w.check(context.Background())
+	w.check(context.Background())
+
+	assert.Equal(t, "example/image:v1", redeployed)
+}
+
+func TestWatcher_RestartFailureFallsBackToRedeploy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	w, mockClient, events := newTestWatcher(t, server.URL, "restart")
+	mockClient.On("ContainerRestart", mock.Anything, "container123", mock.Anything).Return(errors.New("restart error"))
+
+	redeploys := 0
+	w.Redeploy = func(_ context.Context, cfg config.DeploymentConfig) error {
+		redeploys++
+		assert.Equal(t, "example/image:latest", cfg.App.ImageName)
+		return nil
+	}
+
+	w.check(context.Background())
+	w.check(context.Background())
+
+	assert.Equal(t, 1, redeploys)
+	kinds := []string{}
+	for _, e := range *events {
+		kinds = append(kinds, e.Type)
+	}
+	assert.Equal(t, []string{EventUnhealthy, EventUnhealthy, EventError, EventRedeployed}, kinds)
+}
+
+func TestWatcher_Missing(t *testing.T) {
+	mockClient := new(docker.MockDockerClient)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+
+	var events []Event
+	w := &Watcher{
+		Config: config.DeploymentConfig{
+			App:   config.App{Name: "test-app", ImageName: "example/image:latest"},
+			Watch: config.WatchConfig{IntervalSeconds: 1, FailureThreshold: 5, Action: "restart"},
+		},
+		Docker: docker.NewDockerService(mockClient),
+		Store:  state.NewStore(t.TempDir()),
+		Clock:  clockwork.NewFakeClock(),
+		Emit:   func(e Event) { events = append(events, e) },
+	}
+
+	w.check(context.Background())
+
+	require.Len(t, events, 1)
+	assert.Equal(t, EventMissing, events[0].Type)
+	assert.Equal(t, "test-app", events[0].App)
+}
+
+func TestWatcher_Stopped(t *testing.T) {
+	mockClient := new(docker.MockDockerClient)
+
+	var events []Event
+	w := &Watcher{
+		Config: config.DeploymentConfig{
+			App:   config.App{Name: "test-app", ImageName: "example/image:latest"},
+			Watch: config.WatchConfig{IntervalSeconds: 1, FailureThreshold: 1, Action: "redeploy"},
+		},
+		Docker: docker.NewDockerService(mockClient),
+		Store:  state.NewStore(t.TempDir()),
+		Clock:  clockwork.NewFakeClock(),
+		Redeploy: func(context.Context, config.DeploymentConfig) error {
+			t.Fatal("a stopped app must not be redeployed")
+			return nil
+		},
+		Emit: func(e Event) { events = append(events, e) },
+	}
+	require.NoError(t, w.Store.Record(state.Deployment{App: "test-app", Status: state.StatusStopped}))
+
+	w.check(context.Background())
+
+	assert.Empty(t, events)
+	mockClient.AssertNotCalled(t, "ContainerList", mock.Anything, mock.Anything)
+}
+
+func TestWatcher_RunStopsOnCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	w, _, _ := newTestWatcher(t, server.URL, "restart")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher did not stop after cancel")
+	}
+}
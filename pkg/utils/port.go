@@ -3,12 +3,16 @@ package utils
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
-	"time"
 )
 
 // PortManager manages the allocation and deallocation of network ports.
 type PortManager struct {
+	// Host is the address ports are probed on, all interfaces when empty.
+	Host string
+	// SkipProbe disables the bind test, for ports on another machine.
+	SkipProbe     bool
 	StartPort     int
 	MaxPort       int
 	Allocated     map[int]bool
@@ -21,36 +25,60 @@ func NewPortManager(startPort, maxPort, portIncrement int) *PortManager {
 	return &PortManager{
 		StartPort:     startPort,
 		MaxPort:       maxPort,
+		Allocated:     make(map[int]bool),
 		PortIncrement: portIncrement,
 	}
 }
 
-// IsPortAvailable checks if a port is available for use.
+// IsPortAvailable checks if a port is available for use by binding it on
+// Host, the address the port will be published on.
 func (pm *PortManager) IsPortAvailable(port int) bool {
-	address := fmt.Sprintf("127.0.0.1:%d", port)
-
-	// Attempt to connect to the port
-	conn, err := net.DialTimeout("tcp", address, 2*time.Second)
+	if pm.SkipProbe {
+		return true
+	}
 
-	// If connection is successful, close it and return false (port is not available)
-	if err == nil {
-		conn.Close()
+	ln, err := net.Listen("tcp", net.JoinHostPort(pm.Host, strconv.Itoa(port)))
+	if err != nil {
 		return false
 	}
+	ln.Close()
 
 	return true
 }
 
+// Reserve marks ports as taken without probing them, for ports that are
+// in use but not bound yet, such as ports reserved by another deploy.
+func (pm *PortManager) Reserve(ports ...int) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for _, port := range ports {
+		pm.Allocated[port] = true
+	}
+}
+
 // AllocatePort finds and allocates an available port.
 func (pm *PortManager) AllocatePort() (int, error) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
 	for port := pm.StartPort; port <= pm.MaxPort; port += pm.PortIncrement {
+		if pm.Allocated[port] {
+			continue
+		}
 		if pm.IsPortAvailable(port) {
+			pm.Allocated[port] = true
 			return port, nil
 		}
 	}
 
 	return 0, fmt.Errorf("no available ports")
 }
+
+// ReleasePort makes an allocated port available again.
+func (pm *PortManager) ReleasePort(port int) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	delete(pm.Allocated, port)
+}
@@ -44,3 +44,58 @@ func TestNoAvailablePorts(t *testing.T) {
 	_, err = pm.AllocatePort()
 	assert.NotNil(t, err, "Error should occur when no ports are available")
 }
+
+func TestIsPortAvailable_BoundOnOtherInterface(t *testing.T) {
+	pm := NewPortManager(3000, 4000, 1)
+
+	// Listening on an ephemeral port of the loopback interface only
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	assert.False(t, pm.IsPortAvailable(port), "Port bound on loopback should not be available")
+}
+
+func TestAllocatePort_SkipsAllocated(t *testing.T) {
+	pm := NewPortManager(3000, 3001, 1)
+
+	first, err := pm.AllocatePort()
+	assert.Nil(t, err)
+	second, err := pm.AllocatePort()
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second, "The same port should not be allocated twice")
+
+	_, err = pm.AllocatePort()
+	assert.NotNil(t, err, "Error should occur when all ports are allocated")
+
+	pm.ReleasePort(first)
+	port, err := pm.AllocatePort()
+	assert.Nil(t, err)
+	assert.Equal(t, first, port)
+}
+
+func TestAllocatePort_SkipsReserved(t *testing.T) {
+	pm := NewPortManager(3000, 3001, 1)
+	pm.Reserve(3000)
+
+	port, err := pm.AllocatePort()
+	assert.Nil(t, err)
+	assert.Equal(t, 3001, port)
+}
+
+func TestIsPortAvailable_IPv6(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback is not available: %v", err)
+	}
+	defer ln.Close()
+
+	pm := NewPortManager(3000, 4000, 1)
+	pm.Host = "::1"
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	assert.False(t, pm.IsPortAvailable(port), "Port bound on the IPv6 loopback should not be available")
+}